@@ -0,0 +1,286 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package ann provides an approximate nearest neighbor index for maximum inner product search over latent vectors.
+package ann
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Config controls the accuracy and speed of an index. More trees and a larger search size give better recall at the
+// cost of memory and query time respectively.
+type Config struct {
+	// NumTree is the number of random projection trees in the forest.
+	NumTree int
+
+	// LeafSize is the maximum number of items in a leaf.
+	LeafSize int
+
+	// SearchSize is the minimum number of candidates that are scored exactly for every query.
+	SearchSize int
+
+	// Seed makes the random hyperplanes, and thus the index, reproducible.
+	Seed int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		NumTree:    10,
+		LeafSize:   32,
+		SearchSize: 2000,
+		Seed:       1,
+	}
+}
+
+// Result is an item returned by a query together with its exact inner product with the query.
+type Result struct {
+	ID    uint
+	Score float64
+}
+
+// Index is a forest of random projection trees. Trees answer nearest neighbor queries in Euclidean space, so every
+// item x is augmented with an extra coordinate sqrt(Φ² - |x|²), where Φ is the largest norm among items, and every
+// query q with a zero. Then |q' - x'|² = |q|² + Φ² - 2 q·x, i.e. the nearest augmented item is the one with the
+// largest inner product with the query.
+//
+// An index is immutable once it is built, it is safe for concurrent queries.
+type Index struct {
+	dim       int
+	ids       []uint
+	vectors   [][]float64
+	augmented [][]float64
+	roots     []*node
+	config    Config
+}
+
+type node struct {
+	// Split nodes send an item to the right if normal·x > offset.
+	normal      []float64
+	offset      float64
+	left, right *node
+
+	// Leaf nodes hold the positions of their items in the index.
+	items []int
+}
+
+// NewIndex builds an index over the given vectors, where ids[i] identifies vectors[i]. Vectors must all have the same
+// dimension, and they are not copied.
+func NewIndex(ids []uint, vectors [][]float64, config Config) (*Index, error) {
+	if len(ids) != len(vectors) {
+		return nil, errors.New("number of IDs does not match number of vectors")
+	}
+
+	if len(vectors) == 0 {
+		return nil, errors.New("cannot build an index without vectors")
+	}
+
+	if config.NumTree < 1 || config.LeafSize < 1 {
+		return nil, errors.New("index needs at least one tree and a positive leaf size")
+	}
+
+	dim := len(vectors[0])
+	maxSqNorm := 0.0
+	for _, vector := range vectors {
+		if len(vector) != dim {
+			return nil, errors.New("dimension mismatch")
+		}
+
+		maxSqNorm = math.Max(maxSqNorm, dot(vector, vector))
+	}
+
+	augmented := make([][]float64, len(vectors))
+	for i, vector := range vectors {
+		augmented[i] = make([]float64, dim+1)
+		copy(augmented[i], vector)
+		augmented[i][dim] = math.Sqrt(math.Max(0, maxSqNorm-dot(vector, vector)))
+	}
+
+	index := &Index{
+		dim:       dim,
+		ids:       ids,
+		vectors:   vectors,
+		augmented: augmented,
+		roots:     make([]*node, config.NumTree),
+		config:    config,
+	}
+
+	random := rand.New(rand.NewSource(config.Seed))
+	items := make([]int, len(vectors))
+	for i := range items {
+		items[i] = i
+	}
+
+	for t := 0; t < config.NumTree; t += 1 {
+		itemsCopy := make([]int, len(items))
+		copy(itemsCopy, items)
+		index.roots[t] = index.build(itemsCopy, random)
+	}
+
+	return index, nil
+}
+
+// Len returns the number of items in the index.
+func (idx *Index) Len() int {
+	return len(idx.ids)
+}
+
+// Dim returns the dimension of the vectors in the index, which is also the dimension that queries must have.
+func (idx *Index) Dim() int {
+	return idx.dim
+}
+
+// build splits items by the hyperplane that perpendicularly bisects two random items, until every leaf has at most
+// LeafSize items.
+func (idx *Index) build(items []int, random *rand.Rand) *node {
+	if len(items) <= idx.config.LeafSize {
+		return &node{items: items}
+	}
+
+	// When many items share the same vector, e.g. movies that were never rated, a random pair may not separate them.
+	// After a few attempts the items are split in half arbitrarily so that the recursion always terminates.
+	for attempt := 0; attempt < 5; attempt += 1 {
+		a := idx.augmented[items[random.Intn(len(items))]]
+		b := idx.augmented[items[random.Intn(len(items))]]
+
+		normal := make([]float64, len(a))
+		midpoint := make([]float64, len(a))
+		for k := range a {
+			normal[k] = a[k] - b[k]
+			midpoint[k] = (a[k] + b[k]) / 2
+		}
+
+		offset := dot(normal, midpoint)
+
+		left := make([]int, 0, len(items)/2)
+		right := make([]int, 0, len(items)/2)
+		for _, item := range items {
+			if dot(normal, idx.augmented[item]) > offset {
+				right = append(right, item)
+			} else {
+				left = append(left, item)
+			}
+		}
+
+		if len(left) > 0 && len(right) > 0 {
+			return &node{
+				normal: normal,
+				offset: offset,
+				left:   idx.build(left, random),
+				right:  idx.build(right, random),
+			}
+		}
+	}
+
+	half := len(items) / 2
+	return &node{
+		normal: make([]float64, idx.dim+1),
+		left:   idx.build(items[:half], random),
+		right:  idx.build(items[half:], random),
+	}
+}
+
+// Search returns up to n items with the largest inner product with the query, in descending order of score. Items
+// for which accept returns false are skipped; accept may be nil. The forest is searched best first across all trees,
+// leaves closest to the query are visited first, until SearchSize accepted candidates are collected. Candidates are
+// then ranked by their exact inner product.
+func (idx *Index) Search(query []float64, n int, accept func(id uint) bool) ([]Result, error) {
+	if len(query) != idx.dim {
+		return nil, errors.New("query dimension does not match index dimension")
+	}
+
+	if n <= 0 {
+		return []Result{}, nil
+	}
+
+	augmentedQuery := make([]float64, idx.dim+1)
+	copy(augmentedQuery, query)
+
+	searchSize := idx.config.SearchSize
+	if searchSize < n*idx.config.NumTree {
+		searchSize = n * idx.config.NumTree
+	}
+
+	queue := &nodeQueue{}
+	for _, root := range idx.roots {
+		heap.Push(queue, &queuedNode{node: root, margin: math.Inf(1)})
+	}
+
+	visited := make(map[int]bool)
+	candidates := make([]int, 0, searchSize)
+	for queue.Len() > 0 && len(candidates) < searchSize {
+		current := heap.Pop(queue).(*queuedNode)
+		if current.node.items != nil {
+			for _, item := range current.node.items {
+				if visited[item] {
+					continue
+				}
+
+				visited[item] = true
+				if accept == nil || accept(idx.ids[item]) {
+					candidates = append(candidates, item)
+				}
+			}
+
+			continue
+		}
+
+		// The side of the hyperplane that the query is on keeps the margin of its parent, the other side is only as
+		// promising as the distance from the query to the hyperplane.
+		margin := dot(current.node.normal, augmentedQuery) - current.node.offset
+		heap.Push(queue, &queuedNode{node: current.node.right, margin: math.Min(current.margin, margin)})
+		heap.Push(queue, &queuedNode{node: current.node.left, margin: math.Min(current.margin, -margin)})
+	}
+
+	results := make([]Result, len(candidates))
+	for i, item := range candidates {
+		results[i] = Result{ID: idx.ids[item], Score: dot(query, idx.vectors[item])}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > n {
+		results = results[:n]
+	}
+
+	return results, nil
+}
+
+type queuedNode struct {
+	node   *node
+	margin float64
+}
+
+// nodeQueue is a max heap of tree nodes ordered by margin.
+type nodeQueue []*queuedNode
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].margin > q[j].margin }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(*queuedNode)) }
+
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
+func dot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+
+	return sum
+}
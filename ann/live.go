@@ -0,0 +1,36 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package ann provides an approximate nearest neighbor index for maximum inner product search over latent vectors.
+package ann
+
+import "sync"
+
+// Live holds the index that is currently serving queries. A new index is built in the background while the old one
+// keeps serving, and then swapped in.
+type Live struct {
+	mutex sync.RWMutex
+	index *Index
+}
+
+// NewLive returns a holder for the given index, which may be nil until the first index is built.
+func NewLive(index *Index) *Live {
+	return &Live{index: index}
+}
+
+// Index returns the current index, or nil if none has been built yet. Callers should query the returned index rather
+// than call Index repeatedly, so one request is served by one consistent index.
+func (l *Live) Index() *Index {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.index
+}
+
+// Swap replaces the current index.
+func (l *Live) Swap(index *Index) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.index = index
+}
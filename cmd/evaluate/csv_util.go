@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Rating is one row of a MovieLens ratings file.
+type Rating struct {
+	UserID    int
+	MovieID   int
+	Value     float64
+	Timestamp int64
+}
+
+func loadRatingsCSVFile(filepath string) ([]Rating, error) {
+	if csvFile, err := os.Open(filepath); err != nil {
+		return nil, err
+	} else {
+		defer csvFile.Close()
+
+		reader := csv.NewReader(bufio.NewReader(csvFile))
+		ratings := []Rating{}
+		for {
+			row, readerErr := reader.Read()
+			if readerErr != nil {
+				if readerErr == io.EOF {
+					break
+				} else {
+					fmt.Printf("Unexpected reader error: %v\n", readerErr)
+					continue
+				}
+			}
+
+			// The header row fails to parse and is skipped like any malformed row.
+			userID, parseErr := strconv.Atoi(row[0])
+			if parseErr != nil {
+				continue
+			}
+
+			movieID, parseErr := strconv.Atoi(row[1])
+			if parseErr != nil {
+				continue
+			}
+
+			value, parseErr := strconv.ParseFloat(row[2], 64)
+			if parseErr != nil {
+				continue
+			}
+
+			timestamp, parseErr := strconv.ParseInt(row[3], 10, 64)
+			if parseErr != nil {
+				continue
+			}
+
+			ratings = append(ratings, Rating{UserID: userID, MovieID: movieID, Value: value, Timestamp: timestamp})
+		}
+
+		return ratings, nil
+	}
+}
+
+// MovieCluster is one row of the clusters file written by cmd/cluster.
+type MovieCluster struct {
+	ClusterID        string
+	NearestClusters  []string
+	FarthestClusters []string
+}
+
+func loadClustersCSVFile(filepath string) (map[int]*MovieCluster, error) {
+	if csvFile, err := os.Open(filepath); err != nil {
+		return nil, err
+	} else {
+		defer csvFile.Close()
+
+		reader := csv.NewReader(bufio.NewReader(csvFile))
+		clusterMapByMovieID := make(map[int]*MovieCluster)
+		for {
+			row, readerErr := reader.Read()
+			if readerErr != nil {
+				if readerErr == io.EOF {
+					break
+				} else {
+					fmt.Printf("Unexpected reader error: %v\n", readerErr)
+					continue
+				}
+			}
+
+			movieID, parseErr := strconv.Atoi(row[0])
+			if parseErr != nil || len(row) < 10 {
+				continue
+			}
+
+			clusterMapByMovieID[movieID] = &MovieCluster{
+				ClusterID:        row[1],
+				NearestClusters:  row[2:6],
+				FarthestClusters: row[6:10],
+			}
+		}
+
+		return clusterMapByMovieID, nil
+	}
+}
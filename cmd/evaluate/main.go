@@ -0,0 +1,157 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"popcorn/lowrank"
+	"text/tabwriter"
+)
+
+var (
+	modelPath = flag.String(
+		"model",
+		"datasets/production/model.bin",
+		"model artifact written by cmd/train",
+	)
+	ratingsPath = flag.String(
+		"ratings",
+		"datasets/100k/ratings.csv",
+		"MovieLens ratings file with timestamps",
+	)
+	clustersPath = flag.String(
+		"clusters",
+		"datasets/production/clusters.csv",
+		"movie clusters written by cmd/cluster, the cluster baseline is skipped if the file does not exist",
+	)
+	splitMethod = flag.String(
+		"split",
+		"time",
+		"time: test on the most recent ratings of everyone, leave-last: test on the last -n ratings of every user",
+	)
+	leaveLastN = flag.Int(
+		"n",
+		5,
+		"number of ratings per user to hold out with -split=leave-last",
+	)
+	testFraction = flag.Float64(
+		"test-fraction",
+		0.1,
+		"fraction of ratings to hold out with -split=time",
+	)
+	k = flag.Int(
+		"k",
+		10,
+		"number of recommendations per user",
+	)
+	threshold = flag.Float64(
+		"threshold",
+		4.0,
+		"minimum test rating for a movie to count as relevant",
+	)
+	reg = flag.Float64(
+		"reg",
+		0.1,
+		"regularization for folding users into the model",
+	)
+	seed = flag.Int64(
+		"seed",
+		1,
+		"seed of the random baseline",
+	)
+	output = flag.String(
+		"output",
+		"",
+		"write the reports as JSON to this file",
+	)
+)
+
+func init() {
+	logrus.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+}
+
+func main() {
+	flag.Parse()
+
+	modelFile, err := os.Open(*modelPath)
+	if err != nil {
+		logrus.Fatal("Failed to open model artifact:", err)
+	}
+
+	artifact, err := lowrank.ReadArtifact(modelFile)
+	modelFile.Close()
+	if err != nil {
+		logrus.Fatal("Failed to read model artifact:", err)
+	}
+
+	ratings, err := loadRatingsCSVFile(*ratingsPath)
+	if err != nil {
+		logrus.Fatal("Failed to load ratings:", err)
+	}
+
+	var split *Split
+	switch *splitMethod {
+	case "time":
+		split = SplitByTime(ratings, *testFraction)
+	case "leave-last":
+		split = SplitLeaveLastN(ratings, *leaveLastN)
+	default:
+		logrus.Fatalf("Unknown split method %s", *splitMethod)
+	}
+
+	logrus.Infof("Split %d ratings into %d training users and %d test users", len(ratings), len(split.Training),
+		len(split.Test))
+
+	catalog := NewCatalog(split.Training)
+
+	recommenders := []NamedRecommender{
+		{artifact.Algorithm, NewModelRecommender(artifact, catalog, *reg)},
+		{"popularity", NewPopularityRecommender(catalog)},
+		{"random", NewRandomRecommender(catalog, *seed)},
+	}
+
+	if clusterMap, err := loadClustersCSVFile(*clustersPath); err != nil {
+		logrus.Warn("Skipping cluster baseline:", err)
+	} else {
+		recommenders = append(recommenders, NamedRecommender{"cluster", NewClusterRecommender(catalog, clusterMap)})
+	}
+
+	reports := make([]*Report, 0, len(recommenders))
+	for _, recommender := range recommenders {
+		logrus.Infof("Evaluating %s", recommender.Name)
+		reports = append(reports,
+			Evaluate(recommender.Name, recommender.Recommend, split, catalog, artifact.MovieLatentMap, *k, *threshold),
+		)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(writer, "recommender\tusers\tprecision@%d\trecall@%d\tndcg@%d\tmap@%d\tcoverage\tnovelty\tdiversity\t\n",
+		*k, *k, *k, *k)
+	for _, report := range reports {
+		fmt.Fprintf(writer, "%s\t%d\t%.4f\t%.4f\t%.4f\t%.4f\t%.4f\t%.4f\t%.4f\t\n",
+			report.Name, report.NumUser, report.Precision, report.Recall, report.NDCG, report.MAP, report.Coverage,
+			report.Novelty, report.Diversity,
+		)
+	}
+
+	writer.Flush()
+
+	if *output != "" {
+		bytes, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(*output, bytes, 0644); err != nil {
+			logrus.Fatal("Failed to write reports:", err)
+		}
+	}
+}
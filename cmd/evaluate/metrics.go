@@ -0,0 +1,167 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"math"
+	"popcorn/lowrank"
+)
+
+// Report holds the metrics of one recommender averaged over every evaluated user. Precision, recall, NDCG and MAP are
+// computed at k and measure accuracy. Coverage is the fraction of the catalog that is recommended to anyone, novelty is
+// the mean self-information -log2(p) of recommended movies where p is the fraction of users who rated the movie, and
+// diversity is the mean pairwise cosine distance between the latent features of the movies recommended to a user.
+type Report struct {
+	Name      string  `json:"name"`
+	NumUser   int     `json:"num_user"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	NDCG      float64 `json:"ndcg"`
+	MAP       float64 `json:"map"`
+	Coverage  float64 `json:"coverage"`
+	Novelty   float64 `json:"novelty"`
+	Diversity float64 `json:"diversity"`
+}
+
+// Evaluate asks the recommender for k movies for every user who has at least one relevant test rating, i.e. a rating of
+// at least threshold. Movie latents are only used for diversity.
+func Evaluate(name string, recommend Recommender, split *Split, catalog *Catalog, latentMap map[int][]float64,
+	k int, threshold float64) *Report {
+	report := &Report{Name: name}
+
+	recommended := make(map[int]bool)
+	noveltySum, noveltyCount := 0.0, 0
+	diversityCount := 0
+	for userID, testRatings := range split.Test {
+		relevant := make(map[int]bool)
+		for movieID, value := range testRatings {
+			if value >= threshold {
+				relevant[movieID] = true
+			}
+		}
+
+		if len(relevant) == 0 {
+			continue
+		}
+
+		recommendations := recommend(userID, split.Training[userID], k)
+
+		report.NumUser += 1
+		report.Precision += precisionAtK(recommendations, relevant, k)
+		report.Recall += recallAtK(recommendations, relevant, k)
+		report.NDCG += ndcgAtK(recommendations, relevant, k)
+		report.MAP += averagePrecisionAtK(recommendations, relevant, k)
+
+		for _, movieID := range recommendations {
+			recommended[movieID] = true
+			if count := catalog.NumRatingMap[movieID]; count > 0 {
+				noveltySum += -math.Log2(float64(count) / float64(catalog.NumUser))
+				noveltyCount += 1
+			}
+		}
+
+		if diversity, ok := intraListDiversity(recommendations, latentMap); ok {
+			report.Diversity += diversity
+			diversityCount += 1
+		}
+	}
+
+	if report.NumUser > 0 {
+		report.Precision /= float64(report.NumUser)
+		report.Recall /= float64(report.NumUser)
+		report.NDCG /= float64(report.NumUser)
+		report.MAP /= float64(report.NumUser)
+	}
+
+	if len(catalog.MovieIDs) > 0 {
+		report.Coverage = float64(len(recommended)) / float64(len(catalog.MovieIDs))
+	}
+
+	if noveltyCount > 0 {
+		report.Novelty = noveltySum / float64(noveltyCount)
+	}
+
+	if diversityCount > 0 {
+		report.Diversity /= float64(diversityCount)
+	}
+
+	return report
+}
+
+func precisionAtK(recommendations []int, relevant map[int]bool, k int) float64 {
+	hits := 0
+	for i, movieID := range recommendations {
+		if i < k && relevant[movieID] {
+			hits += 1
+		}
+	}
+
+	return float64(hits) / float64(k)
+}
+
+func recallAtK(recommendations []int, relevant map[int]bool, k int) float64 {
+	hits := 0
+	for i, movieID := range recommendations {
+		if i < k && relevant[movieID] {
+			hits += 1
+		}
+	}
+
+	return float64(hits) / float64(len(relevant))
+}
+
+// ndcgAtK uses binary relevance, the ideal ranking places every relevant movie at the top.
+func ndcgAtK(recommendations []int, relevant map[int]bool, k int) float64 {
+	dcg := 0.0
+	for i, movieID := range recommendations {
+		if i < k && relevant[movieID] {
+			dcg += 1 / math.Log2(float64(i+2))
+		}
+	}
+
+	idcg := 0.0
+	for i := 0; i < k && i < len(relevant); i += 1 {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+
+	return dcg / idcg
+}
+
+func averagePrecisionAtK(recommendations []int, relevant map[int]bool, k int) float64 {
+	hits := 0
+	sum := 0.0
+	for i, movieID := range recommendations {
+		if i < k && relevant[movieID] {
+			hits += 1
+			sum += float64(hits) / float64(i+1)
+		}
+	}
+
+	return sum / math.Min(float64(k), float64(len(relevant)))
+}
+
+// intraListDiversity returns the mean cosine distance over all pairs of recommended movies that have latent features.
+// It is not defined for fewer than two such movies.
+func intraListDiversity(recommendations []int, latentMap map[int][]float64) (float64, bool) {
+	latents := make([][]float64, 0, len(recommendations))
+	for _, movieID := range recommendations {
+		if latent, ok := latentMap[movieID]; ok {
+			latents = append(latents, latent)
+		}
+	}
+
+	if len(latents) < 2 {
+		return 0, false
+	}
+
+	sum, count := 0.0, 0
+	for i := 0; i < len(latents); i += 1 {
+		for j := i + 1; j < len(latents); j += 1 {
+			sum += 1 - lowrank.CosineSimilarity(latents[i], latents[j])
+			count += 1
+		}
+	}
+
+	return sum / float64(count), true
+}
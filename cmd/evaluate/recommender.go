@@ -0,0 +1,241 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"math/rand"
+	"popcorn/lowrank"
+	"sort"
+	"strconv"
+)
+
+// Recommender returns the IDs of the k movies it would recommend to a user with the given training ratings, best
+// first. Movies the user has rated must not be recommended.
+type Recommender func(userID int, ratings map[int]float64, k int) []int
+
+// NamedRecommender is a recommender with the name it is reported under.
+type NamedRecommender struct {
+	Name      string
+	Recommend Recommender
+}
+
+// Catalog is what every recommender may choose from, the movies that appear in the training set ordered by how many
+// users rated them.
+type Catalog struct {
+	MovieIDs     []int
+	NumRatingMap map[int]int
+	NumUser      int
+}
+
+func NewCatalog(training map[int]map[int]float64) *Catalog {
+	numRatingMap := make(map[int]int)
+	for _, ratings := range training {
+		for movieID := range ratings {
+			numRatingMap[movieID] += 1
+		}
+	}
+
+	movieIDs := make([]int, 0, len(numRatingMap))
+	for movieID := range numRatingMap {
+		movieIDs = append(movieIDs, movieID)
+	}
+
+	sort.Slice(movieIDs, func(i, j int) bool {
+		if numRatingMap[movieIDs[i]] == numRatingMap[movieIDs[j]] {
+			return movieIDs[i] < movieIDs[j]
+		}
+
+		return numRatingMap[movieIDs[i]] > numRatingMap[movieIDs[j]]
+	})
+
+	return &Catalog{
+		MovieIDs:     movieIDs,
+		NumRatingMap: numRatingMap,
+		NumUser:      len(training),
+	}
+}
+
+// NewModelRecommender folds every user into the trained model from their training ratings, the same way the server
+// folds in app users, and ranks movies by predicted rating. Only user vectors are re-learned; movie latents are taken as
+// they are, so the model should be trained on data that does not include the test ratings.
+func NewModelRecommender(artifact *lowrank.Artifact, catalog *Catalog, reg float64) Recommender {
+	return func(userID int, ratings map[int]float64, k int) []int {
+		features := [][]float64{}
+		targets := []float64{}
+		userBias := 0.0
+		for movieID, value := range ratings {
+			if latent, ok := artifact.MovieLatentMap[movieID]; ok {
+				features = append(features, latent)
+				targets = append(targets, value-artifact.MovieBiasMap[movieID])
+				userBias += value - artifact.MovieBiasMap[movieID]
+			}
+		}
+
+		if len(targets) == 0 {
+			return []int{}
+		}
+
+		// The user bias only shifts every prediction of the user, it does not change the ranking, but the latent
+		// preference should not have to account for it.
+		userBias /= float64(len(targets))
+		for i := range targets {
+			targets[i] -= userBias
+		}
+
+		preference, err := lowrank.LeastSquaresLatent(features, targets, artifact.FeatureDim, reg)
+		if err != nil {
+			return []int{}
+		}
+
+		scoreMap := make(map[int]float64)
+		for _, movieID := range catalog.MovieIDs {
+			if latent, ok := artifact.MovieLatentMap[movieID]; ok {
+				if _, rated := ratings[movieID]; !rated {
+					score, _ := lowrank.DotProduct(preference, latent)
+					scoreMap[movieID] = score + artifact.MovieBiasMap[movieID]
+				}
+			}
+		}
+
+		return topK(scoreMap, k)
+	}
+}
+
+// NewPopularityRecommender recommends the most rated movies that the user has not rated.
+func NewPopularityRecommender(catalog *Catalog) Recommender {
+	return func(userID int, ratings map[int]float64, k int) []int {
+		recommendations := make([]int, 0, k)
+		for _, movieID := range catalog.MovieIDs {
+			if len(recommendations) == k {
+				break
+			}
+
+			if _, rated := ratings[movieID]; !rated {
+				recommendations = append(recommendations, movieID)
+			}
+		}
+
+		return recommendations
+	}
+}
+
+// NewRandomRecommender recommends movies uniformly at random.
+func NewRandomRecommender(catalog *Catalog, seed int64) Recommender {
+	random := rand.New(rand.NewSource(seed))
+	return func(userID int, ratings map[int]float64, k int) []int {
+		recommendations := make([]int, 0, k)
+		for _, i := range random.Perm(len(catalog.MovieIDs)) {
+			if len(recommendations) == k {
+				break
+			}
+
+			if _, rated := ratings[catalog.MovieIDs[i]]; !rated {
+				recommendations = append(recommendations, catalog.MovieIDs[i])
+			}
+		}
+
+		return recommendations
+	}
+}
+
+// NewClusterRecommender follows the logic of the movie recommendation handler. Highly rated movies vote for their own
+// cluster and its nearest clusters, poorly rated movies for their farthest clusters, and the five clusters with the
+// most votes are the best clusters. The handler draws randomly from the popular movies of those clusters; here they are
+// taken in order, movies of the best clusters first, then of the voted clusters, then the most popular movies overall.
+func NewClusterRecommender(catalog *Catalog, clusterMap map[int]*MovieCluster) Recommender {
+	moviesByCluster := make(map[string][]int)
+	for _, movieID := range catalog.MovieIDs {
+		if cluster, ok := clusterMap[movieID]; ok {
+			moviesByCluster[cluster.ClusterID] = append(moviesByCluster[cluster.ClusterID], movieID)
+		}
+	}
+
+	return func(userID int, ratings map[int]float64, k int) []int {
+		highRatedClusters := []string{}
+		lowRatedClusters := []string{}
+		for movieID, value := range ratings {
+			cluster, ok := clusterMap[movieID]
+			if !ok {
+				continue
+			}
+
+			if value > 3.5 {
+				highRatedClusters = append(highRatedClusters, cluster.NearestClusters...)
+				highRatedClusters = append(highRatedClusters, cluster.ClusterID)
+			} else if value < 2.5 {
+				lowRatedClusters = append(lowRatedClusters, cluster.FarthestClusters...)
+			}
+		}
+
+		voteMap := make(map[string]int)
+		for _, clusterID := range highRatedClusters {
+			voteMap[clusterID] += 1
+		}
+
+		for _, clusterID := range lowRatedClusters {
+			if voteMap[clusterID] == 0 {
+				voteMap[clusterID] = 1
+			}
+		}
+
+		votedClusters := make([]string, 0, len(voteMap))
+		for clusterID := range voteMap {
+			votedClusters = append(votedClusters, clusterID)
+		}
+
+		sort.Slice(votedClusters, func(i, j int) bool {
+			if voteMap[votedClusters[i]] == voteMap[votedClusters[j]] {
+				a, _ := strconv.Atoi(votedClusters[i])
+				b, _ := strconv.Atoi(votedClusters[j])
+				return a < b
+			}
+
+			return voteMap[votedClusters[i]] > voteMap[votedClusters[j]]
+		})
+
+		recommendations := make([]int, 0, k)
+		seen := make(map[int]bool)
+		add := func(movieIDs []int) {
+			for _, movieID := range movieIDs {
+				if len(recommendations) == k {
+					return
+				}
+
+				if _, rated := ratings[movieID]; !rated && !seen[movieID] {
+					seen[movieID] = true
+					recommendations = append(recommendations, movieID)
+				}
+			}
+		}
+
+		for _, clusterID := range votedClusters {
+			add(moviesByCluster[clusterID])
+		}
+
+		add(catalog.MovieIDs)
+
+		return recommendations
+	}
+}
+
+func topK(scoreMap map[int]float64, k int) []int {
+	movieIDs := make([]int, 0, len(scoreMap))
+	for movieID := range scoreMap {
+		movieIDs = append(movieIDs, movieID)
+	}
+
+	sort.Slice(movieIDs, func(i, j int) bool {
+		if scoreMap[movieIDs[i]] == scoreMap[movieIDs[j]] {
+			return movieIDs[i] < movieIDs[j]
+		}
+
+		return scoreMap[movieIDs[i]] > scoreMap[movieIDs[j]]
+	})
+
+	if len(movieIDs) > k {
+		movieIDs = movieIDs[:k]
+	}
+
+	return movieIDs
+}
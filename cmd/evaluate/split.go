@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import "sort"
+
+// Split holds the ratings of every user, keyed by user ID and then movie ID, divided into what recommenders may learn
+// from and what they are judged against.
+type Split struct {
+	Training map[int]map[int]float64
+	Test     map[int]map[int]float64
+}
+
+func newSplit() *Split {
+	return &Split{
+		Training: make(map[int]map[int]float64),
+		Test:     make(map[int]map[int]float64),
+	}
+}
+
+func (s *Split) add(ratingMap map[int]map[int]float64, rating Rating) {
+	if _, ok := ratingMap[rating.UserID]; !ok {
+		ratingMap[rating.UserID] = make(map[int]float64)
+	}
+
+	ratingMap[rating.UserID][rating.MovieID] = rating.Value
+}
+
+// SplitByTime puts the most recent testFraction of all ratings into the test set, which mimics training on the past
+// and recommending in the future. Users who only appear after the cutoff have nothing to learn from and are dropped.
+func SplitByTime(ratings []Rating, testFraction float64) *Split {
+	timestamps := make([]int64, len(ratings))
+	for i, rating := range ratings {
+		timestamps[i] = rating.Timestamp
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	split := newSplit()
+	if len(timestamps) == 0 {
+		return split
+	}
+
+	cutoff := timestamps[int(float64(len(timestamps)-1)*(1-testFraction))]
+	for _, rating := range ratings {
+		if rating.Timestamp <= cutoff {
+			split.add(split.Training, rating)
+		}
+	}
+
+	for _, rating := range ratings {
+		if _, ok := split.Training[rating.UserID]; ok && rating.Timestamp > cutoff {
+			split.add(split.Test, rating)
+		}
+	}
+
+	return split
+}
+
+// SplitLeaveLastN puts the last n ratings of every user into the test set. Users with n or fewer ratings stay
+// entirely in the training set.
+func SplitLeaveLastN(ratings []Rating, n int) *Split {
+	ratingsByUser := make(map[int][]Rating)
+	for _, rating := range ratings {
+		ratingsByUser[rating.UserID] = append(ratingsByUser[rating.UserID], rating)
+	}
+
+	split := newSplit()
+	for _, userRatings := range ratingsByUser {
+		sort.Slice(userRatings, func(i, j int) bool {
+			if userRatings[i].Timestamp == userRatings[j].Timestamp {
+				return userRatings[i].MovieID < userRatings[j].MovieID
+			}
+
+			return userRatings[i].Timestamp < userRatings[j].Timestamp
+		})
+
+		cutoff := len(userRatings) - n
+		if cutoff <= 0 {
+			cutoff = len(userRatings)
+		}
+
+		for i, rating := range userRatings {
+			if i < cutoff {
+				split.add(split.Training, rating)
+			} else {
+				split.add(split.Test, rating)
+			}
+		}
+	}
+
+	return split
+}
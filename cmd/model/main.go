@@ -0,0 +1,164 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/sirupsen/logrus"
+	"os"
+	"popcorn/lowrank"
+	"popcorn/model"
+	"popcorn/registry"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	LocalDBUser     = "popcorn"
+	LocalDBPassword = "popcorn"
+	LocalDBName     = "popcorn_development"
+	LocalSSLMode    = "disable"
+)
+
+const Usage = `Usage: model <command> [flags]
+
+Commands:
+  list                     list every registered model version
+  register -file model.bin register an artifact written by cmd/train, -activate to serve it right away
+  activate -id N           serve the features of model version N
+  rollback                 serve the previously active model version again`
+
+func init() {
+	logrus.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(Usage)
+		os.Exit(1)
+	}
+
+	var dbCredentials string
+	if os.Getenv("HEROKU_POSTGRESQL_BROWN_URL") != "" {
+		dbCredentials = os.Getenv("HEROKU_POSTGRESQL_BROWN_URL")
+	} else if os.Getenv("DATABASE_URL") != "" {
+		dbCredentials = os.Getenv("DATABASE_URL")
+	} else {
+		dbCredentials = fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s",
+			LocalDBUser, LocalDBPassword, LocalDBName, LocalSSLMode,
+		)
+	}
+
+	db, err := gorm.Open("postgres", dbCredentials)
+	if err != nil {
+		logrus.Fatal("Cannot connect to database:", err)
+	}
+
+	defer db.Close()
+
+	db.AutoMigrate(&model.ModelVersion{}, &model.ModelActivation{}, &model.Movie{})
+
+	switch os.Args[1] {
+	case "list":
+		list(db)
+	case "register":
+		register(db, os.Args[2:])
+	case "activate":
+		activate(db, os.Args[2:])
+	case "rollback":
+		version, err := registry.Rollback(db)
+		if err != nil {
+			logrus.Fatal("Failed to roll back:", err)
+		}
+
+		logrus.Infof("Rolled back to model version %d", version.ID)
+	default:
+		fmt.Println(Usage)
+		os.Exit(1)
+	}
+}
+
+func list(db *gorm.DB) {
+	versions, err := registry.List(db)
+	if err != nil {
+		logrus.Fatal("Failed to list model versions:", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tACTIVE\tALGORITHM\tK\tRMSE\tCREATED\tACTIVATED\tDATASET\tHYPERPARAMETERS")
+	for _, version := range versions {
+		activatedAt := "-"
+		if version.ActivatedAt != nil {
+			activatedAt = version.ActivatedAt.Format(time.RFC3339)
+		}
+
+		active := ""
+		if version.Active {
+			active = "*"
+		}
+
+		datasetHash := version.DatasetHash
+		if len(datasetHash) > 12 {
+			datasetHash = datasetHash[:12]
+		}
+
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%d\t%.6f\t%s\t%s\t%s\t%s\n",
+			version.ID, active, version.Algorithm, version.FeatureDim, version.RootMeanSqError,
+			version.CreatedAt.Format(time.RFC3339), activatedAt, datasetHash, string(version.Hyperparameters),
+		)
+	}
+
+	writer.Flush()
+}
+
+func register(db *gorm.DB, args []string) {
+	flags := flag.NewFlagSet("register", flag.ExitOnError)
+	filepath := flags.String("file", "datasets/production/model.bin", "path to the model artifact")
+	shouldActivate := flags.Bool("activate", false, "activate the model version after registering it")
+	flags.Parse(args)
+
+	file, err := os.Open(*filepath)
+	if err != nil {
+		logrus.Fatal("Failed to open model artifact:", err)
+	}
+
+	defer file.Close()
+
+	artifact, err := lowrank.ReadArtifact(file)
+	if err != nil {
+		logrus.Fatal("Failed to read model artifact:", err)
+	}
+
+	version, err := registry.Register(db, artifact)
+	if err != nil {
+		logrus.Fatal("Failed to register model version:", err)
+	}
+
+	logrus.Infof("Registered %s as model version %d with RMSE %.6f", *filepath, version.ID, version.RootMeanSqError)
+
+	if *shouldActivate {
+		if _, err := registry.Activate(db, version.ID); err != nil {
+			logrus.Fatal("Failed to activate model version:", err)
+		}
+	}
+}
+
+func activate(db *gorm.DB, args []string) {
+	flags := flag.NewFlagSet("activate", flag.ExitOnError)
+	id := flags.Uint("id", 0, "ID of the model version to activate")
+	flags.Parse(args)
+
+	if *id == 0 {
+		logrus.Fatal("Please provide the ID of a model version with -id")
+	}
+
+	if _, err := registry.Activate(db, *id); err != nil {
+		logrus.Fatal("Failed to activate model version:", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/sirupsen/logrus"
+	"os"
+	"popcorn/model"
+	"popcorn/retrain"
+)
+
+const (
+	LocalDBUser     = "popcorn"
+	LocalDBPassword = "popcorn"
+	LocalDBName     = "popcorn_development"
+	LocalSSLMode    = "disable"
+)
+
+var (
+	inputDir = flag.String(
+		"input",
+		"datasets/100k/",
+		"directory of the MovieLens ratings.csv and movies.csv that the served model was trained on",
+	)
+	steps = flag.Int(
+		"steps",
+		5,
+		"number of steps to train from the served features",
+	)
+	reg = flag.Float64(
+		"reg",
+		0.03,
+		"regularization strength",
+	)
+	learnRate = flag.Float64(
+		"learn-rate",
+		0.005,
+		"learning rate, only used when the served model is biased",
+	)
+	cluster = flag.Bool(
+		"cluster",
+		true,
+		"re-cluster the movies with the new features",
+	)
+	implicit = flag.Bool(
+		"implicit",
+		false,
+		"train the weighted implicit model on the skips and views of app users as well as on the ratings",
+	)
+)
+
+func init() {
+	logrus.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+}
+
+func main() {
+	flag.Parse()
+
+	var dbCredentials string
+	if os.Getenv("HEROKU_POSTGRESQL_BROWN_URL") != "" {
+		dbCredentials = os.Getenv("HEROKU_POSTGRESQL_BROWN_URL")
+	} else if os.Getenv("DATABASE_URL") != "" {
+		dbCredentials = os.Getenv("DATABASE_URL")
+	} else {
+		dbCredentials = fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s",
+			LocalDBUser, LocalDBPassword, LocalDBName, LocalSSLMode,
+		)
+	}
+
+	db, err := gorm.Open("postgres", dbCredentials)
+	if err != nil {
+		logrus.Fatal("Cannot connect to database:", err)
+	}
+
+	defer db.Close()
+
+	db.AutoMigrate(&model.ModelVersion{}, &model.ModelActivation{}, &model.Movie{}, &model.Interaction{})
+
+	config := retrain.DefaultConfig(*inputDir)
+	config.Steps = *steps
+	config.Reg = *reg
+	config.LearnRate = *learnRate
+	config.Cluster = *cluster
+	config.Implicit = *implicit
+
+	version, err := retrain.Run(db, config)
+	if err != nil {
+		logrus.Fatal("Failed to retrain:", err)
+	}
+
+	logrus.Infof("Model version %d is trained on app ratings and activated", version.ID)
+}
@@ -12,10 +12,17 @@ import (
 	"os"
 	"popcorn/model"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// NoGenres is how the MovieLens catalog marks a movie without genres.
+const NoGenres = "(no genres listed)"
+
+// MaxTagsPerMovie is the number of tags kept for a movie, the long tail of tags is mostly noise.
+const MaxTagsPerMovie = 20
+
 func loadPopularityCSVFile(filepath string) (map[uint]map[string]float64, error) {
 	if csvFile, err := os.Open(filepath); err != nil {
 		return nil, err
@@ -111,6 +118,47 @@ func loadFeatureCSVFile(filepath string) (map[uint][]float64, error) {
 	}
 }
 
+func loadBiasCSVFile(filepath string) (map[uint]float64, error) {
+	if csvFile, err := os.Open(filepath); err != nil {
+		return nil, err
+	} else {
+		reader := csv.NewReader(bufio.NewReader(csvFile))
+		biasByMovieID := make(map[uint]float64)
+		for {
+			var rowRecord []string
+			var readerErr error
+
+			rowRecord, readerErr = reader.Read()
+			if readerErr != nil {
+				if readerErr == io.EOF {
+					break
+				} else {
+					fmt.Printf("Unexpected reader error: %v\n", readerErr)
+					continue
+				}
+			}
+
+			var movieID int64
+			var bias float64
+			var parseErr error
+
+			movieID, parseErr = strconv.ParseInt(rowRecord[0], 10, 64)
+			if parseErr != nil {
+				continue
+			}
+
+			bias, parseErr = strconv.ParseFloat(rowRecord[1], 64)
+			if parseErr != nil {
+				continue
+			}
+
+			biasByMovieID[uint(movieID)] = bias
+		}
+
+		return biasByMovieID, nil
+	}
+}
+
 func loadMetadataCSVFile(filepath string) (map[uint]map[string]string, error) {
 	if csvFile, err := os.Open(filepath); err != nil {
 		return nil, err
@@ -185,11 +233,18 @@ func loadMoviesCSVFile(filepath string) (map[uint]*model.Movie, error) {
 					continue
 				}
 
+				genres := pq.StringArray{}
+				if len(row) > 2 && row[2] != NoGenres {
+					genres = strings.Split(row[2], "|")
+				}
+
 				movieById[uint(id)] = &model.Movie{
 					ID:      uint(id),
 					Year:    uint(year),
 					Title:   trimmedTitle,
 					Feature: pq.Float64Array{},
+					Genres:  genres,
+					Tags:    pq.StringArray{},
 				}
 			}
 		}
@@ -200,6 +255,71 @@ func loadMoviesCSVFile(filepath string) (map[uint]*model.Movie, error) {
 	}
 }
 
+// loadTagsCSVFile returns the distinct tags of every movie, the tags applied by the most users first. Tags are lower
+// cased because users spell the same tag with different cases, and only the first MaxTagsPerMovie are kept.
+func loadTagsCSVFile(filepath string) (map[uint][]string, error) {
+	csvFile, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer csvFile.Close()
+
+	reader := csv.NewReader(bufio.NewReader(csvFile))
+	tagCountByMovieID := make(map[uint]map[string]int)
+	for {
+		row, readerErr := reader.Read()
+		if readerErr != nil {
+			if readerErr == io.EOF {
+				break
+			} else {
+				fmt.Printf("Unexpected reader error: %v\n", readerErr)
+				continue
+			}
+		}
+
+		movieID, parseErr := strconv.ParseUint(row[1], 10, 64)
+		if parseErr != nil {
+			continue
+		}
+
+		tag := strings.ToLower(strings.TrimSpace(row[2]))
+		if tag == "" {
+			continue
+		}
+
+		if _, ok := tagCountByMovieID[uint(movieID)]; !ok {
+			tagCountByMovieID[uint(movieID)] = make(map[string]int)
+		}
+
+		tagCountByMovieID[uint(movieID)][tag] += 1
+	}
+
+	tagsByMovieID := make(map[uint][]string)
+	for movieID, tagCount := range tagCountByMovieID {
+		tags := make([]string, 0, len(tagCount))
+		for tag := range tagCount {
+			tags = append(tags, tag)
+		}
+
+		sort.Slice(tags, func(i, j int) bool {
+			if tagCount[tags[i]] == tagCount[tags[j]] {
+				return tags[i] < tags[j]
+			}
+
+			return tagCount[tags[i]] > tagCount[tags[j]]
+		})
+
+		if len(tags) > MaxTagsPerMovie {
+			tags = tags[:MaxTagsPerMovie]
+		}
+
+		tagsByMovieID[movieID] = tags
+	}
+
+	return tagsByMovieID, nil
+}
+
 func loadMovieClusterCSVFile(filepath string) (map[uint]uint, error) {
 	if csvFile, err := os.Open(filepath); err != nil {
 		return nil, err
@@ -21,6 +21,10 @@ const (
 
 const DIR = "datasets/production/"
 
+// TagsFile is the tags file of the full MovieLens snapshot that the production movies come from, the same snapshot
+// that cmd/train reads. It is too large to be checked in, so movies are seeded without tags unless it is downloaded.
+const TagsFile = "datasets/26m/tags.csv"
+
 func init() {
 	logrus.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp: true,
@@ -49,9 +53,11 @@ func main() {
 	var movieModelsMap map[uint]*model.Movie
 	var moviePopularityMap map[uint]map[string]float64
 	var featuresMap map[uint][]float64
+	var biasesMap map[uint]float64
 	var metadataMap map[uint]map[string]string
 	var movieClusterMap map[uint]uint
 	var movieClusterRelationMap map[uint]map[string][]string
+	var tagsMap map[uint][]string
 	var loadError error
 
 	movieModelsMap, loadError = loadMoviesCSVFile(DIR + "movies.csv")
@@ -85,6 +91,13 @@ func main() {
 		logrus.Info("Movie features are loaded from csv files")
 	}
 
+	biasesMap, loadError = loadBiasCSVFile(DIR + "biases.csv")
+	if loadError != nil {
+		logrus.Error("Failed to load movie biases from CSV data:", loadError)
+	} else {
+		logrus.Info("Movie biases are loaded from csv files")
+	}
+
 	movieClusterMap, loadError = loadMovieClusterCSVFile(DIR + "clusters.csv")
 	if loadError != nil {
 		logrus.Error("Failed to load movie clusters from CSV data:", loadError)
@@ -99,15 +112,20 @@ func main() {
 		logrus.Info("Movie clusters relations are loaded from csv files")
 	}
 
-	if db.HasTable(&model.Movie{}) {
-		db.DropTable(&model.Movie{})
-		logrus.Info("Existing \"movies\" table is dropped")
+	tagsMap, loadError = loadTagsCSVFile(TagsFile)
+	if loadError != nil {
+		logrus.Error("Failed to load movie tags from CSV data:", loadError)
+	} else {
+		logrus.Info("Movie tags are loaded from csv files")
 	}
 
-	db.CreateTable(&model.Movie{})
-	logrus.Info("New \"movies\" table is created")
+	if err := createStagingTable(db); err != nil {
+		logrus.Fatal("Failed to create staging table:", err)
+	} else {
+		logrus.Infof("New \"%s\" table is created", StagingTable)
+	}
 
-	count := 0
+	movies := make([]*model.Movie, 0, len(movieModelsMap))
 	for movieID := range movieModelsMap {
 		movie := movieModelsMap[movieID]
 
@@ -127,21 +145,46 @@ func main() {
 			}
 		}
 
+		// Features from CSV files do not belong to any registered model version. If a version is active, the server
+		// puts its features back once it notices the movies have changed.
 		if featuresMap != nil {
 			if value, ok := featuresMap[movieID]; ok {
 				movie.Feature = value
 			}
 		}
 
+		if biasesMap != nil {
+			if value, ok := biasesMap[movieID]; ok {
+				movie.Bias = value
+			}
+		}
+
+		if tagsMap != nil {
+			if value, ok := tagsMap[movieID]; ok {
+				movie.Tags = value
+			}
+		}
+
 		if dict, ok := movieClusterRelationMap[movieID]; ok {
 			movie.NearestClusters = dict["closest"]
 			movie.FarthestClusters = dict["farthest"]
 		}
 
-		if db.Create(movie).Error == nil {
-			count += 1
-		}
+		movies = append(movies, movie)
+	}
+
+	if err := insertStagingMovies(db, movies); err != nil {
+		logrus.Fatal("Failed to load movies into staging table:", err)
+	} else {
+		logrus.Infof("Loaded %d movies into \"%s\" table", len(movies), StagingTable)
+	}
+
+	upserted, removed, retained, err := mergeStagingTable(db)
+	if err != nil {
+		logrus.Fatal("Failed to merge staging table into \"movies\" table:", err)
 	}
 
-	logrus.Infof("Completed seeding %d movies", count)
+	logrus.Infof("Completed seeding: %d movies inserted or updated, %d removed, %d kept because users rated them",
+		upserted, removed, retained,
+	)
 }
@@ -0,0 +1,144 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"popcorn/model"
+	"strings"
+	"time"
+)
+
+// StagingTable is where a new catalog is loaded before it is merged into the live movies table.
+const StagingTable = "movies_staging"
+
+// InsertBatchSize is the number of movies per INSERT statement. Postgres allows at most 65535 bind parameters in one
+// statement, so batch size times the number of columns must stay below that.
+const InsertBatchSize = 500
+
+// MovieColumns are the columns that are loaded from CSV files. The primary key is the MovieLens movie ID, which is what
+// lets the staging table be matched against the live table.
+var MovieColumns = []string{
+	"id", "created_at", "updated_at", "title", "year", "imdb_id", "tmdb_id", "imdb_rating", "num_rating", "cluster_id",
+	"average_rating", "feature", "bias", "nearest_clusters", "farthest_clusters", "model_version_id", "genres", "tags",
+}
+
+// createStagingTable creates an empty staging table with the same columns, defaults and indices as the live table.
+func createStagingTable(db *gorm.DB) error {
+	// Ratings and interactions are checked before a movie is removed, so their tables must exist as well.
+	if err := db.AutoMigrate(&model.Movie{}, &model.Rating{}, &model.Interaction{}).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", StagingTable)).Error; err != nil {
+		return err
+	}
+
+	return db.Exec(fmt.Sprintf("CREATE TABLE %s (LIKE movies INCLUDING ALL)", StagingTable)).Error
+}
+
+// insertStagingMovies loads movies into the staging table with multi-row inserts of InsertBatchSize movies each. The
+// live table is untouched.
+func insertStagingMovies(db *gorm.DB, movies []*model.Movie) error {
+	now := time.Now()
+	for start := 0; start < len(movies); start += InsertBatchSize {
+		end := start + InsertBatchSize
+		if end > len(movies) {
+			end = len(movies)
+		}
+
+		rows := make([]string, 0, end-start)
+		values := make([]interface{}, 0, (end-start)*len(MovieColumns))
+		for _, movie := range movies[start:end] {
+			// Array columns are converted to their Postgres literals up front, gorm would otherwise expand a slice
+			// argument into a list of bind parameters.
+			feature, _ := movie.Feature.Value()
+			nearestClusters, _ := movie.NearestClusters.Value()
+			farthestClusters, _ := movie.FarthestClusters.Value()
+			genres, _ := movie.Genres.Value()
+			tags, _ := movie.Tags.Value()
+
+			rows = append(rows, "("+strings.TrimSuffix(strings.Repeat("?, ", len(MovieColumns)), ", ")+")")
+			values = append(values, movie.ID, now, now, movie.Title, movie.Year, movie.IMDBID, movie.TMDBID,
+				movie.IMDBRating, movie.NumRating, movie.ClusterID, movie.AverageRating, feature, movie.Bias,
+				nearestClusters, farthestClusters, movie.ModelVersionID, genres, tags,
+			)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+			StagingTable, strings.Join(MovieColumns, ", "), strings.Join(rows, ", "),
+		)
+
+		if err := db.Exec(query, values...).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeStagingTable upserts the staging table into the live movies table in one transaction, so the site never sees a
+// partially loaded catalog. Rows that did not change are left alone. Movies that are no longer in the catalog are only
+// removed if no user has rated or interacted with them, hence ratings never point to a missing movie. It returns the
+// number of inserted or updated movies, removed movies, and movies that were kept because users depend on them.
+func mergeStagingTable(db *gorm.DB) (upserted, removed, retained int64, err error) {
+	// created_at of an existing movie is kept, every other column takes the value from the catalog.
+	assignments := make([]string, 0, len(MovieColumns))
+	current := make([]string, 0, len(MovieColumns))
+	incoming := make([]string, 0, len(MovieColumns))
+	for _, column := range MovieColumns {
+		if column == "id" || column == "created_at" || column == "updated_at" {
+			continue
+		}
+
+		assignments = append(assignments, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+		current = append(current, "movies."+column)
+		incoming = append(incoming, "EXCLUDED."+column)
+	}
+
+	assignments = append(assignments, "updated_at = EXCLUDED.updated_at")
+
+	upsert := fmt.Sprintf(`INSERT INTO movies (%s) SELECT %s FROM %s
+		ON CONFLICT (id) DO UPDATE SET %s
+		WHERE (%s) IS DISTINCT FROM (%s)`,
+		strings.Join(MovieColumns, ", "), strings.Join(MovieColumns, ", "), StagingTable,
+		strings.Join(assignments, ", "),
+		strings.Join(current, ", "), strings.Join(incoming, ", "),
+	)
+
+	// Deleted movies are those that are not in the catalog anymore and nobody depends on.
+	obsolete := fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s s WHERE s.id = movies.id)", StagingTable)
+	referenced := `(EXISTS (SELECT 1 FROM ratings r WHERE r.movie_id = movies.id)
+		OR EXISTS (SELECT 1 FROM interactions i WHERE i.movie_id = movies.id))`
+
+	tx := db.Begin()
+
+	result := tx.Exec(upsert)
+	if result.Error != nil {
+		tx.Rollback()
+		return 0, 0, 0, result.Error
+	}
+
+	upserted = result.RowsAffected
+
+	if err := tx.Model(&model.Movie{}).Where(obsolete + " AND " + referenced).Count(&retained).Error; err != nil {
+		tx.Rollback()
+		return 0, 0, 0, err
+	}
+
+	result = tx.Exec("DELETE FROM movies WHERE " + obsolete + " AND NOT " + referenced)
+	if result.Error != nil {
+		tx.Rollback()
+		return 0, 0, 0, result.Error
+	}
+
+	removed = result.RowsAffected
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, 0, 0, err
+	}
+
+	return upserted, removed, retained, db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", StagingTable)).Error
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"os"
+	"popcorn/lowrank"
+)
+
+// writeArtifactToFile writes the trained model in the binary artifact format, which can be registered with the model
+// registry through cmd/model.
+func writeArtifactToFile(filepath string, artifact *lowrank.Artifact) error {
+	file, fileErr := os.Create(filepath)
+	if fileErr != nil {
+		return fileErr
+	}
+
+	if err := artifact.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -81,3 +81,31 @@ func writeFeaturesToCSV(filepath string, movieFeatures map[int][]float64, featur
 
 	return nil
 }
+
+func writeBiasesToCSV(filepath string, movieBiases map[int]float64) error {
+	csvFile, fileErr := os.Create(filepath)
+	if fileErr != nil {
+		return fileErr
+	}
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	// Write the header first
+	var writerError error
+	writerError = writer.Write([]string{"movieId", "bias"})
+	if writerError != nil {
+		return writerError
+	}
+
+	for movieID, bias := range movieBiases {
+		row := []string{strconv.Itoa(movieID), strconv.FormatFloat(bias, 'f', 6, 64)}
+
+		writerError = writer.Write(row)
+		if writerError != nil {
+			logrus.Errorf("Failed to write row: %s\n", row)
+		}
+	}
+
+	return nil
+}
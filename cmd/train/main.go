@@ -12,6 +12,12 @@ import (
 )
 
 var (
+	algorithm = flag.String(
+		"algorithm",
+		"gd",
+		"training algorithm, either gd, sgd, als or biased for gradient descent, stochastic gradient descent, "+
+			"alternating least squares or biased matrix factorization",
+	)
 	isVectorized = flag.Bool(
 		"vectorized",
 		true,
@@ -27,11 +33,42 @@ var (
 		1,
 		"number of steps per epoch or per report interval",
 	)
+	batchSize = flag.Int(
+		"batch-size",
+		1,
+		"number of ratings per mini-batch for stochastic gradient descent",
+	)
+	optimizer = flag.String(
+		"optimizer",
+		lowrank.OptimizerSGD,
+		"optimizer for stochastic gradient descent, either sgd, momentum or adam",
+	)
+	learnRate = flag.Float64(
+		"learn-rate",
+		0.01,
+		"initial learning rate for stochastic gradient descent and biased matrix factorization",
+	)
+	decay = flag.Float64(
+		"decay",
+		0.0,
+		"learning rate decay per epoch for stochastic gradient descent",
+	)
+	momentum = flag.Float64(
+		"momentum",
+		0.9,
+		"velocity coefficient for the momentum optimizer",
+	)
+	patience = flag.Int(
+		"patience",
+		0,
+		"number of epochs without test RMSE improvement before stopping early, zero disables early stopping",
+	)
 )
 
 const InputDir = "datasets/26m/"
 const OutputDir = "datasets/production/"
 const FeatureDim = 10
+const Reg = 0.03
 
 func init() {
 	logrus.SetFormatter(&logrus.TextFormatter{
@@ -42,7 +79,109 @@ func init() {
 func main() {
 	flag.Parse()
 
-	if *isVectorized {
+	if *algorithm != "gd" && *algorithm != "sgd" && *algorithm != "als" && *algorithm != "biased" {
+		logrus.Fatalf("unknown training algorithm %s", *algorithm)
+	}
+
+	datasetHash, err := lowrank.HashDataset(InputDir+"ratings.csv", InputDir+"movies.csv")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	// Every algorithm fills in the artifact, which is written next to the CSV files at the end.
+	artifact := &lowrank.Artifact{
+		ArtifactHeader: lowrank.ArtifactHeader{
+			Algorithm:   *algorithm,
+			FeatureDim:  FeatureDim,
+			DatasetHash: datasetHash,
+			Hyperparameters: map[string]float64{
+				"feature_dim": FeatureDim,
+				"reg":         Reg,
+				"steps":       float64(*steps),
+			},
+		},
+	}
+
+	if *algorithm == "biased" {
+		biasedFact, err := lowrank.NewBiasedFactorizer(InputDir+"ratings.csv", InputDir+"movies.csv", FeatureDim)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		startTime := time.Now()
+
+		biasedFact.Train(*steps, *epoch, Reg, *learnRate)
+
+		endTime := time.Now()
+
+		logrus.Infof("Training took %s seconds", endTime.Sub(startTime))
+
+		_, artifact.RootMeanSqError, _ = biasedFact.Loss(Reg)
+		artifact.Hyperparameters["learn_rate"] = *learnRate
+		artifact.MovieLatentMap = biasedFact.MovieLatentMap
+		artifact.MovieBiasMap = biasedFact.MovieOffsetMap()
+		artifact.UserLatentMap = biasedFact.UserLatentMap
+
+		writeFeaturesToCSV(OutputDir+"features.csv", biasedFact.MovieLatentMap, FeatureDim)
+		writeBiasesToCSV(OutputDir+"biases.csv", biasedFact.MovieOffsetMap())
+		writePopularityToCSV(OutputDir+"popularity.csv", biasedFact.MovieMap)
+	} else if *algorithm == "sgd" {
+		iterativeFact, err := lowrank.NewIterativeFactorizer(InputDir+"ratings.csv", InputDir+"movies.csv", FeatureDim)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		// Steps are treated as the number of passes over the training ratings.
+		config := lowrank.DefaultSGDConfig()
+		config.Reg = Reg
+		config.Epochs = *steps
+		config.BatchSize = *batchSize
+		config.Optimizer = *optimizer
+		config.LearnRate = *learnRate
+		config.Decay = *decay
+		config.Momentum = *momentum
+		config.Patience = *patience
+
+		startTime := time.Now()
+
+		if err := iterativeFact.TrainSGD(config); err != nil {
+			logrus.Fatal(err)
+		}
+
+		endTime := time.Now()
+
+		logrus.Infof("Training took %s seconds", endTime.Sub(startTime))
+
+		_, artifact.RootMeanSqError, _ = iterativeFact.Loss(Reg)
+		artifact.Hyperparameters["learn_rate"] = *learnRate
+		artifact.Hyperparameters["batch_size"] = float64(*batchSize)
+		artifact.Hyperparameters["decay"] = *decay
+		artifact.MovieLatentMap = iterativeFact.MovieLatentMap
+		artifact.UserLatentMap = iterativeFact.UserLatentMap
+
+		writeFeaturesToCSV(OutputDir+"features.csv", iterativeFact.MovieLatentMap, FeatureDim)
+		writePopularityToCSV(OutputDir+"popularity.csv", iterativeFact.MovieMap)
+	} else if *algorithm == "als" {
+		alsFact, err := lowrank.NewALSFactorizer(InputDir+"ratings.csv", InputDir+"movies.csv", FeatureDim)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		startTime := time.Now()
+
+		alsFact.Train(*steps, *epoch, Reg)
+
+		endTime := time.Now()
+
+		logrus.Infof("Training took %s seconds", endTime.Sub(startTime))
+
+		_, artifact.RootMeanSqError, _ = alsFact.Loss(Reg)
+		artifact.MovieLatentMap = alsFact.MovieLatentMap
+		artifact.UserLatentMap = alsFact.UserLatentMap
+
+		writeFeaturesToCSV(OutputDir+"features.csv", alsFact.MovieLatentMap, FeatureDim)
+		writePopularityToCSV(OutputDir+"popularity.csv", alsFact.MovieMap)
+	} else if *isVectorized {
 		converter, err := lowrank.NewMatrixConverter(InputDir+"ratings.csv", InputDir+"movies.csv")
 		if err != nil {
 			logrus.Fatal(err)
@@ -52,7 +191,7 @@ func main() {
 		startTime := time.Now()
 
 		// Start training
-		fact.Train(*steps, *epoch, 0.03, 1e-5)
+		fact.Train(*steps, *epoch, Reg, 1e-5)
 
 		endTime := time.Now()
 
@@ -67,26 +206,49 @@ func main() {
 			featureMapByMovieID[movieID] = features
 		}
 
+		I, _ := fact.UserLatent.Dims()
+		preferenceMapByUserID := make(map[int][]float64)
+		for i := 0; i < I; i += 1 {
+			userID := converter.UserIndexToID[i]
+			preference := make([]float64, FeatureDim)
+			mat.Row(preference, i, fact.UserLatent)
+			preferenceMapByUserID[userID] = preference
+		}
+
+		_, artifact.RootMeanSqError, _ = fact.Loss(Reg)
+		artifact.Algorithm = "gd-vectorized"
+		artifact.Hyperparameters["learn_rate"] = 1e-5
+		artifact.MovieLatentMap = featureMapByMovieID
+		artifact.UserLatentMap = preferenceMapByUserID
+
 		writeFeaturesToCSV(OutputDir+"features.csv", featureMapByMovieID, FeatureDim)
 		writePopularityToCSV(OutputDir+"popularity.csv", converter.MovieMap)
 	} else {
-		var iterativeFact *lowrank.IterativeFactorizer
-		var err error
-
-		iterativeFact, err = lowrank.NewIterativeFactorizer(InputDir+"ratings.csv", InputDir+"movies.csv", FeatureDim)
+		iterativeFact, err := lowrank.NewIterativeFactorizer(InputDir+"ratings.csv", InputDir+"movies.csv", FeatureDim)
 		if err != nil {
 			logrus.Fatal(err)
 		}
 
 		startTime := time.Now()
 
-		iterativeFact.Train(*steps, *epoch, 0.03, 3e-5)
+		iterativeFact.Train(*steps, *epoch, Reg, 3e-5)
 
 		endTime := time.Now()
 
 		logrus.Infof("Training took %s seconds", endTime.Sub(startTime))
 
+		_, artifact.RootMeanSqError, _ = iterativeFact.Loss(Reg)
+		artifact.Hyperparameters["learn_rate"] = 3e-5
+		artifact.MovieLatentMap = iterativeFact.MovieLatentMap
+		artifact.UserLatentMap = iterativeFact.UserLatentMap
+
 		writeFeaturesToCSV(OutputDir+"features.csv", iterativeFact.MovieLatentMap, FeatureDim)
 		writePopularityToCSV(OutputDir+"popularity.csv", iterativeFact.MovieMap)
 	}
+
+	if err := writeArtifactToFile(OutputDir+"model.bin", artifact); err != nil {
+		logrus.Fatal("Failed to write model artifact:", err)
+	}
+
+	logrus.Infof("Model artifact is written to %s with RMSE %1.8f", OutputDir+"model.bin", artifact.RootMeanSqError)
 }
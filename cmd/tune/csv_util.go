@@ -0,0 +1,163 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"popcorn/lowrank"
+	"strconv"
+)
+
+func writeTrialsToCSV(filepath string, trials []*Trial) error {
+	csvFile, fileErr := os.Create(filepath)
+	if fileErr != nil {
+		return fileErr
+	}
+
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	header := []string{"id", "featureDim", "reg", "learnRate", "steps", "rmse", "seconds", "error"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, trial := range trials {
+		row := []string{
+			strconv.Itoa(trial.ID),
+			strconv.Itoa(trial.FeatureDim),
+			strconv.FormatFloat(trial.Reg, 'g', 6, 64),
+			strconv.FormatFloat(trial.LearnRate, 'g', 6, 64),
+			strconv.Itoa(trial.Steps),
+			strconv.FormatFloat(trial.RootMeanSqError, 'f', 6, 64),
+			strconv.FormatFloat(trial.Seconds, 'f', 1, 64),
+			trial.Error,
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeTrialsToJSON(filepath string, trials []*Trial) error {
+	bytes, err := json.MarshalIndent(trials, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath, bytes, 0644)
+}
+
+// The following writers produce the same production files as cmd/train, which cmd/seed and cmd/cluster read.
+
+func writeFeaturesToCSV(filepath string, movieFeatures map[int][]float64, featureDim int) error {
+	csvFile, fileErr := os.Create(filepath)
+	if fileErr != nil {
+		return fileErr
+	}
+
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	header := []string{"movieId"}
+	for i := 1; i <= featureDim; i += 1 {
+		header = append(header, fmt.Sprintf("f%v", i))
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for movieID, features := range movieFeatures {
+		row := []string{strconv.Itoa(movieID)}
+		for _, feature := range features {
+			row = append(row, strconv.FormatFloat(feature, 'f', 6, 64))
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeBiasesToCSV(filepath string, movieBiases map[int]float64) error {
+	csvFile, fileErr := os.Create(filepath)
+	if fileErr != nil {
+		return fileErr
+	}
+
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"movieId", "bias"}); err != nil {
+		return err
+	}
+
+	for movieID, bias := range movieBiases {
+		if err := writer.Write([]string{strconv.Itoa(movieID), strconv.FormatFloat(bias, 'f', 6, 64)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writePopularityToCSV(filepath string, movieMap map[int]*lowrank.Movie) error {
+	csvFile, fileErr := os.Create(filepath)
+	if fileErr != nil {
+		return fileErr
+	}
+
+	defer csvFile.Close()
+
+	writer := csv.NewWriter(csvFile)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"movieId", "avgRating", "numRating"}); err != nil {
+		return err
+	}
+
+	for movieID, movie := range movieMap {
+		row := []string{
+			strconv.Itoa(movieID),
+			strconv.FormatFloat(movie.AvgRating, 'f', 2, 64),
+			strconv.Itoa(len(movie.Ratings)),
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeArtifactToFile(filepath string, artifact *lowrank.Artifact) error {
+	file, fileErr := os.Create(filepath)
+	if fileErr != nil {
+		return fileErr
+	}
+
+	if err := artifact.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"flag"
+	"github.com/sirupsen/logrus"
+	"math/rand"
+	"os"
+	"popcorn/lowrank"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	algorithm = flag.String(
+		"algorithm",
+		"als",
+		"als, biased, sgd or gd",
+	)
+	search = flag.String(
+		"search",
+		"grid",
+		"grid: try every combination of the values, random: sample -trials configurations from their ranges",
+	)
+	numTrial = flag.Int(
+		"trials",
+		20,
+		"number of configurations to sample with -search=random",
+	)
+	featureDims = flag.String(
+		"k",
+		"5,10,20",
+		"comma separated feature dimensions",
+	)
+	regs = flag.String(
+		"reg",
+		"0.01,0.03,0.1",
+		"comma separated regularization strengths",
+	)
+	learnRates = flag.String(
+		"learn-rate",
+		"0.005,0.01",
+		"comma separated learning rates, ignored by als",
+	)
+	steps = flag.String(
+		"steps",
+		"10,20",
+		"comma separated numbers of steps, which are epochs for sgd",
+	)
+	numParallel = flag.Int(
+		"parallel",
+		runtime.NumCPU(),
+		"number of trials to train at the same time",
+	)
+	seed = flag.Int64(
+		"seed",
+		1,
+		"seed of random search",
+	)
+	inputDir = flag.String(
+		"input",
+		"datasets/100k/",
+		"directory of the MovieLens ratings.csv and movies.csv",
+	)
+	outputDir = flag.String(
+		"output",
+		"datasets/tune/",
+		"directory for results.csv and results.json",
+	)
+	promote = flag.Bool(
+		"promote",
+		false,
+		"write the features of the best trial to the production directory, like cmd/train does",
+	)
+)
+
+const ProductionDir = "datasets/production/"
+
+func init() {
+	logrus.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+}
+
+func main() {
+	flag.Parse()
+
+	space := Space{
+		FeatureDims: parseInts(*featureDims),
+		Regs:        parseFloats(*regs),
+		LearnRates:  parseFloats(*learnRates),
+		Steps:       parseInts(*steps),
+	}
+
+	// Alternating least squares has no learning rate, searching over it would only repeat the same trials.
+	if *algorithm == "als" {
+		space.LearnRates = []float64{0}
+	}
+
+	var configs []Config
+	switch *search {
+	case "grid":
+		configs = space.Grid()
+	case "random":
+		configs = space.Random(*numTrial, rand.New(rand.NewSource(*seed)))
+	default:
+		logrus.Fatalf("Unknown search %s", *search)
+	}
+
+	// Every trial is evaluated against the same held-out test ratings, otherwise the comparison is meaningless.
+	dataset, err := lowrank.LoadDataset(*inputDir+"ratings.csv", *inputDir+"movies.csv")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if *numParallel < 1 {
+		*numParallel = 1
+	}
+
+	// Alternating least squares is parallel within a trial as well, split the cores between trials.
+	numWorker := runtime.NumCPU() / *numParallel
+	if numWorker < 1 {
+		numWorker = 1
+	}
+
+	logrus.Infof("Running %d %s trials of %s, %d at a time", len(configs), *search, *algorithm, *numParallel)
+	trials, best := runTrials(dataset, *algorithm, configs, *numParallel, numWorker)
+
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		logrus.Fatal(err)
+	}
+
+	if err := writeTrialsToCSV(*outputDir+"results.csv", trials); err != nil {
+		logrus.Fatal("Failed to write results:", err)
+	}
+
+	if err := writeTrialsToJSON(*outputDir+"results.json", trials); err != nil {
+		logrus.Fatal("Failed to write results:", err)
+	}
+
+	ranked := make([]*Trial, 0, len(trials))
+	for _, trial := range trials {
+		if trial.Error == "" {
+			ranked = append(ranked, trial)
+		}
+	}
+
+	if len(ranked) == 0 || best == nil {
+		logrus.Fatal("Every trial has failed")
+	}
+
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].RootMeanSqError < ranked[j].RootMeanSqError })
+	logrus.Infof("Best trial %d: K=%d reg=%.4g learn rate=%.4g steps=%d with RMSE %1.6f",
+		ranked[0].ID, ranked[0].FeatureDim, ranked[0].Reg, ranked[0].LearnRate, ranked[0].Steps,
+		ranked[0].RootMeanSqError,
+	)
+
+	if *promote {
+		promoteArtifact(best, dataset)
+	}
+}
+
+// promoteArtifact writes the best model to the production directory in the same files that cmd/train produces, so it
+// can be seeded or registered with cmd/model.
+func promoteArtifact(artifact *lowrank.Artifact, dataset *lowrank.Dataset) {
+	datasetHash, err := lowrank.HashDataset(*inputDir+"ratings.csv", *inputDir+"movies.csv")
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	artifact.DatasetHash = datasetHash
+
+	err = writeFeaturesToCSV(ProductionDir+"features.csv", artifact.MovieLatentMap, artifact.FeatureDim)
+	if err != nil {
+		logrus.Fatal("Failed to write features:", err)
+	}
+
+	if err := writePopularityToCSV(ProductionDir+"popularity.csv", dataset.MovieMap); err != nil {
+		logrus.Fatal("Failed to write popularity:", err)
+	}
+
+	if len(artifact.MovieBiasMap) > 0 {
+		if err := writeBiasesToCSV(ProductionDir+"biases.csv", artifact.MovieBiasMap); err != nil {
+			logrus.Fatal("Failed to write biases:", err)
+		}
+	}
+
+	if err := writeArtifactToFile(ProductionDir+"model.bin", artifact); err != nil {
+		logrus.Fatal("Failed to write model artifact:", err)
+	}
+
+	logrus.Infof("Promoted the best %s model to %s", artifact.Algorithm, ProductionDir)
+}
+
+func logTrial(trial *Trial, total int) {
+	if trial.Error != "" {
+		logrus.Warnf("trial %3d/%d K=%d reg=%.4g learn rate=%.4g steps=%d failed: %s",
+			trial.ID, total, trial.FeatureDim, trial.Reg, trial.LearnRate, trial.Steps, trial.Error)
+	} else {
+		logrus.Infof("trial %3d/%d K=%d reg=%.4g learn rate=%.4g steps=%d RMSE %1.6f in %.1fs",
+			trial.ID, total, trial.FeatureDim, trial.Reg, trial.LearnRate, trial.Steps, trial.RootMeanSqError,
+			trial.Seconds)
+	}
+}
+
+func parseInts(list string) []int {
+	values := []int{}
+	for _, field := range strings.Split(list, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			logrus.Fatalf("%s is not an integer", field)
+		}
+
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func parseFloats(list string) []float64 {
+	values := []float64{}
+	for _, field := range strings.Split(list, ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			logrus.Fatalf("%s is not a number", field)
+		}
+
+		values = append(values, value)
+	}
+
+	return values
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Config is one point in the hyperparameter space. Learning rate is ignored by alternating least squares.
+type Config struct {
+	FeatureDim int     `json:"feature_dim"`
+	Reg        float64 `json:"reg"`
+	LearnRate  float64 `json:"learn_rate"`
+	Steps      int     `json:"steps"`
+}
+
+// Space lists the values to search for every hyperparameter. Grid search tries every combination of them, random
+// search samples uniformly between the smallest and largest value of each list, on a log scale for regularization and
+// learning rate since they span orders of magnitude.
+type Space struct {
+	FeatureDims []int
+	Regs        []float64
+	LearnRates  []float64
+	Steps       []int
+}
+
+// Grid returns every combination of the values in the space.
+func (s Space) Grid() []Config {
+	configs := []Config{}
+	for _, featureDim := range s.FeatureDims {
+		for _, reg := range s.Regs {
+			for _, learnRate := range s.LearnRates {
+				for _, steps := range s.Steps {
+					configs = append(configs, Config{
+						FeatureDim: featureDim,
+						Reg:        reg,
+						LearnRate:  learnRate,
+						Steps:      steps,
+					})
+				}
+			}
+		}
+	}
+
+	return configs
+}
+
+// Random returns n configurations sampled from the ranges of the space.
+func (s Space) Random(n int, random *rand.Rand) []Config {
+	configs := make([]Config, 0, n)
+	for i := 0; i < n; i += 1 {
+		configs = append(configs, Config{
+			FeatureDim: uniformInt(s.FeatureDims, random),
+			Reg:        logUniform(s.Regs, random),
+			LearnRate:  logUniform(s.LearnRates, random),
+			Steps:      uniformInt(s.Steps, random),
+		})
+	}
+
+	return configs
+}
+
+func uniformInt(values []int, random *rand.Rand) int {
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+
+	min, max := sorted[0], sorted[len(sorted)-1]
+	return min + random.Intn(max-min+1)
+}
+
+func logUniform(values []float64, random *rand.Rand) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	if sorted[0] == sorted[len(sorted)-1] {
+		return sorted[0]
+	}
+
+	min, max := math.Log(sorted[0]), math.Log(sorted[len(sorted)-1])
+	return math.Exp(min + random.Float64()*(max-min))
+}
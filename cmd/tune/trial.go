@@ -0,0 +1,147 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"errors"
+	"math"
+	"popcorn/lowrank"
+	"time"
+)
+
+// Trial is the outcome of training one configuration. RMSE is measured on the held-out test ratings of the dataset,
+// which no trial trains on.
+type Trial struct {
+	ID int `json:"id"`
+	Config
+	RootMeanSqError float64 `json:"rmse"`
+	Seconds         float64 `json:"seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// runTrial trains a model of the given algorithm on the shared dataset and returns it as an artifact, so the best one
+// can be promoted without training it again.
+func runTrial(dataset *lowrank.Dataset, algorithm string, config Config, numWorker int) (*lowrank.Artifact, error) {
+	artifact := &lowrank.Artifact{
+		ArtifactHeader: lowrank.ArtifactHeader{
+			Algorithm:  algorithm,
+			FeatureDim: config.FeatureDim,
+			Hyperparameters: map[string]float64{
+				"feature_dim": float64(config.FeatureDim),
+				"reg":         config.Reg,
+				"steps":       float64(config.Steps),
+			},
+		},
+	}
+
+	// Every trial only logs its initial loss, the results table is what matters.
+	epochSize := config.Steps + 1
+
+	var err error
+	switch algorithm {
+	case "als":
+		alsFact := lowrank.NewALSFactorizerFromDataset(dataset, config.FeatureDim)
+		alsFact.NumWorker = numWorker
+		alsFact.Train(config.Steps, epochSize, config.Reg)
+
+		_, artifact.RootMeanSqError, err = alsFact.Loss(config.Reg)
+		artifact.MovieLatentMap = alsFact.MovieLatentMap
+		artifact.UserLatentMap = alsFact.UserLatentMap
+	case "biased":
+		biasedFact := lowrank.NewBiasedFactorizerFromDataset(dataset, config.FeatureDim)
+		biasedFact.Train(config.Steps, epochSize, config.Reg, config.LearnRate)
+
+		_, artifact.RootMeanSqError, err = biasedFact.Loss(config.Reg)
+		artifact.Hyperparameters["learn_rate"] = config.LearnRate
+		artifact.MovieLatentMap = biasedFact.MovieLatentMap
+		artifact.MovieBiasMap = biasedFact.MovieOffsetMap()
+		artifact.UserLatentMap = biasedFact.UserLatentMap
+	case "sgd":
+		iterativeFact := lowrank.NewIterativeFactorizerFromDataset(dataset, config.FeatureDim)
+
+		sgdConfig := lowrank.DefaultSGDConfig()
+		sgdConfig.Epochs = config.Steps
+		sgdConfig.Reg = config.Reg
+		sgdConfig.LearnRate = config.LearnRate
+		if err := iterativeFact.TrainSGD(sgdConfig); err != nil {
+			return nil, err
+		}
+
+		_, artifact.RootMeanSqError, err = iterativeFact.Loss(config.Reg)
+		artifact.Hyperparameters["learn_rate"] = config.LearnRate
+		artifact.MovieLatentMap = iterativeFact.MovieLatentMap
+		artifact.UserLatentMap = iterativeFact.UserLatentMap
+	case "gd":
+		iterativeFact := lowrank.NewIterativeFactorizerFromDataset(dataset, config.FeatureDim)
+		iterativeFact.Train(config.Steps, epochSize, config.Reg, config.LearnRate)
+
+		_, artifact.RootMeanSqError, err = iterativeFact.Loss(config.Reg)
+		artifact.Hyperparameters["learn_rate"] = config.LearnRate
+		artifact.MovieLatentMap = iterativeFact.MovieLatentMap
+		artifact.UserLatentMap = iterativeFact.UserLatentMap
+	default:
+		return nil, errors.New("unknown algorithm " + algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if math.IsNaN(artifact.RootMeanSqError) || math.IsInf(artifact.RootMeanSqError, 0) {
+		return nil, errors.New("training diverged")
+	}
+
+	return artifact, nil
+}
+
+// runTrials trains every configuration with numParallel trials at a time. Only the artifact of the best trial is kept
+// in memory.
+func runTrials(dataset *lowrank.Dataset, algorithm string, configs []Config, numParallel,
+	numWorker int) ([]*Trial, *lowrank.Artifact) {
+	type outcome struct {
+		trial    *Trial
+		artifact *lowrank.Artifact
+	}
+
+	queue := make(chan *Trial)
+	outcomes := make(chan outcome)
+	for n := 0; n < numParallel; n += 1 {
+		go func() {
+			for trial := range queue {
+				start := time.Now()
+				artifact, err := runTrial(dataset, algorithm, trial.Config, numWorker)
+				trial.Seconds = time.Since(start).Seconds()
+				if err != nil {
+					trial.Error = err.Error()
+				} else {
+					trial.RootMeanSqError = artifact.RootMeanSqError
+				}
+
+				outcomes <- outcome{trial: trial, artifact: artifact}
+			}
+		}()
+	}
+
+	go func() {
+		for i, config := range configs {
+			queue <- &Trial{ID: i + 1, Config: config}
+		}
+
+		close(queue)
+	}()
+
+	trials := make([]*Trial, len(configs))
+	var best *lowrank.Artifact
+	for range configs {
+		result := <-outcomes
+		trials[result.trial.ID-1] = result.trial
+		if result.artifact != nil && (best == nil || result.artifact.RootMeanSqError < best.RootMeanSqError) {
+			best = result.artifact
+		}
+
+		logTrial(result.trial, len(configs))
+	}
+
+	return trials, best
+}
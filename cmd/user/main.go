@@ -0,0 +1,91 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/sirupsen/logrus"
+	"os"
+	"popcorn/model"
+)
+
+const (
+	LocalDBUser     = "popcorn"
+	LocalDBPassword = "popcorn"
+	LocalDBName     = "popcorn_development"
+	LocalSSLMode    = "disable"
+)
+
+const Usage = `Usage: user <command> [flags]
+
+Commands:
+  promote -username name   give the user the admin role
+  demote -username name    take the admin role away from the user`
+
+func init() {
+	logrus.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println(Usage)
+		os.Exit(1)
+	}
+
+	var dbCredentials string
+	if os.Getenv("HEROKU_POSTGRESQL_BROWN_URL") != "" {
+		dbCredentials = os.Getenv("HEROKU_POSTGRESQL_BROWN_URL")
+	} else if os.Getenv("DATABASE_URL") != "" {
+		dbCredentials = os.Getenv("DATABASE_URL")
+	} else {
+		dbCredentials = fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s",
+			LocalDBUser, LocalDBPassword, LocalDBName, LocalSSLMode,
+		)
+	}
+
+	db, err := gorm.Open("postgres", dbCredentials)
+	if err != nil {
+		logrus.Fatal("Cannot connect to database:", err)
+	}
+
+	defer db.Close()
+
+	db.AutoMigrate(&model.User{})
+
+	switch os.Args[1] {
+	case "promote":
+		setRole(db, os.Args[2:], model.RoleAdmin)
+	case "demote":
+		setRole(db, os.Args[2:], model.RoleUser)
+	default:
+		fmt.Println(Usage)
+		os.Exit(1)
+	}
+}
+
+func setRole(db *gorm.DB, args []string, role string) {
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	username := flags.String("username", "", "name of the user")
+	flags.Parse(args)
+
+	if *username == "" {
+		logrus.Fatal("Please provide the name of a user with -username")
+	}
+
+	result := db.Model(&model.User{}).Where("username = ?", *username).Update("role", role)
+	if result.Error != nil {
+		logrus.Fatal("Failed to update the role of the user:", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		logrus.Fatalf("User %s does not exist", *username)
+	}
+
+	logrus.Infof("User %s is now %s", *username, role)
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package content recommends movies by how similar their genres and user tags are, which works for movies that nobody
+// has rated and therefore have no latent feature.
+package content
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Vector is a sparse TF-IDF vector mapping term index to weight. Vectors of an index have unit length.
+type Vector map[int]float64
+
+// Result is a movie with its cosine similarity to the query.
+type Result struct {
+	ID    uint
+	Score float64
+}
+
+// Index holds the TF-IDF vector of every movie that has genres or tags. Every term appears at most once per movie, so
+// the weight of a term is its inverse document frequency; a genre shared by a third of the catalog tells little about a
+// movie, a tag only a handful of movies have tells a lot.
+type Index struct {
+	termMap   map[string]int
+	vectorMap map[uint]Vector
+	movieIDs  []uint
+}
+
+// Terms turns the genres and tags of a movie into the terms it is indexed by. Genres and tags live in separate
+// namespaces, a movie tagged "comedy" is not the same as a movie of the Comedy genre.
+func Terms(genres, tags []string) []string {
+	terms := make([]string, 0, len(genres)+len(tags))
+	for _, genre := range genres {
+		terms = append(terms, "genre:"+strings.ToLower(strings.TrimSpace(genre)))
+	}
+
+	for _, tag := range tags {
+		terms = append(terms, "tag:"+strings.ToLower(strings.TrimSpace(tag)))
+	}
+
+	return terms
+}
+
+// NewIndex builds the index from the terms of every movie. Movies without terms are left out.
+func NewIndex(termsByMovieID map[uint][]string) *Index {
+	idx := &Index{
+		termMap:   make(map[string]int),
+		vectorMap: make(map[uint]Vector),
+		movieIDs:  make([]uint, 0, len(termsByMovieID)),
+	}
+
+	docFreq := make(map[int]int)
+	termIDsByMovieID := make(map[uint][]int)
+	for movieID, terms := range termsByMovieID {
+		seen := make(map[int]bool)
+		for _, term := range terms {
+			termID, ok := idx.termMap[term]
+			if !ok {
+				termID = len(idx.termMap)
+				idx.termMap[term] = termID
+			}
+
+			if !seen[termID] {
+				seen[termID] = true
+				docFreq[termID] += 1
+				termIDsByMovieID[movieID] = append(termIDsByMovieID[movieID], termID)
+			}
+		}
+	}
+
+	N := float64(len(termIDsByMovieID))
+	for movieID, termIDs := range termIDsByMovieID {
+		vector := make(Vector, len(termIDs))
+		for _, termID := range termIDs {
+			vector[termID] = math.Log((1+N)/(1+float64(docFreq[termID]))) + 1
+		}
+
+		idx.vectorMap[movieID] = normalize(vector)
+		idx.movieIDs = append(idx.movieIDs, movieID)
+	}
+
+	sort.Slice(idx.movieIDs, func(i, j int) bool { return idx.movieIDs[i] < idx.movieIDs[j] })
+
+	return idx
+}
+
+// Len returns the number of indexed movies.
+func (idx *Index) Len() int {
+	return len(idx.movieIDs)
+}
+
+// Vector returns the TF-IDF vector of a movie, or false if the movie has neither genres nor tags.
+func (idx *Index) Vector(movieID uint) (Vector, bool) {
+	vector, ok := idx.vectorMap[movieID]
+	return vector, ok
+}
+
+// Profile sums the vectors of the movies a user has rated, each weighted by how far the rating is above or below the
+// average rating of the user, so the profile points towards what the user likes and away from what they dislike. A
+// user who gave every movie the same rating has nothing to contrast, their movies count equally. It returns an empty
+// vector if none of the rated movies is indexed.
+func (idx *Index) Profile(ratings map[uint]float64) Vector {
+	mean, count := 0.0, 0.0
+	for movieID, value := range ratings {
+		if _, ok := idx.vectorMap[movieID]; ok {
+			mean += value
+			count += 1
+		}
+	}
+
+	profile := make(Vector)
+	if count == 0 {
+		return profile
+	}
+
+	mean /= count
+
+	uniform := true
+	for movieID, value := range ratings {
+		if _, ok := idx.vectorMap[movieID]; ok && value != mean {
+			uniform = false
+			break
+		}
+	}
+
+	for movieID, value := range ratings {
+		vector, ok := idx.vectorMap[movieID]
+		if !ok {
+			continue
+		}
+
+		weight := value - mean
+		if uniform {
+			weight = 1
+		}
+
+		for termID, termWeight := range vector {
+			profile[termID] += weight * termWeight
+		}
+	}
+
+	return normalize(profile)
+}
+
+// Score returns the cosine similarity between a profile and a movie, zero if the movie is not indexed.
+func (idx *Index) Score(profile Vector, movieID uint) float64 {
+	return dot(profile, idx.vectorMap[movieID])
+}
+
+// Search returns up to n accepted movies that are the most similar to the profile, most similar first. Accept may be
+// nil to accept every movie.
+func (idx *Index) Search(profile Vector, n int, accept func(uint) bool) []Result {
+	results := make([]Result, 0, len(idx.movieIDs))
+	for _, movieID := range idx.movieIDs {
+		if accept == nil || accept(movieID) {
+			results = append(results, Result{ID: movieID, Score: dot(profile, idx.vectorMap[movieID])})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+
+	if len(results) > n {
+		results = results[:n]
+	}
+
+	return results
+}
+
+// dot iterates over the shorter vector, profiles tend to have many more terms than a single movie.
+func dot(a, b Vector) float64 {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	sum := 0.0
+	for termID, weight := range a {
+		sum += weight * b[termID]
+	}
+
+	return sum
+}
+
+func normalize(vector Vector) Vector {
+	norm := math.Sqrt(dot(vector, vector))
+	if norm == 0 {
+		return vector
+	}
+
+	for termID := range vector {
+		vector[termID] /= norm
+	}
+
+	return vector
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package content
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// testTerms has a comedy genre shared by three movies and tags that only one or two movies have.
+var testTerms = map[uint][]string{
+	1: Terms([]string{"Comedy", "Romance"}, []string{"Paris"}),
+	2: Terms([]string{"Comedy"}, []string{"Paris", "Bittersweet"}),
+	3: Terms([]string{"Comedy", "Horror"}, []string{"Zombies"}),
+	4: Terms([]string{"Horror"}, []string{"Zombies", "Gore"}),
+	5: nil,
+}
+
+func TestTerms(t *testing.T) {
+	expected := []string{"genre:comedy", "genre:sci-fi", "tag:comedy", "tag:time travel"}
+	actual := Terms([]string{"Comedy", "Sci-Fi"}, []string{" comedy", "Time Travel "})
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Terms = %q, expected %q", actual, expected)
+	}
+}
+
+func TestNewIndex(t *testing.T) {
+	idx := NewIndex(testTerms)
+	if idx.Len() != 4 {
+		t.Errorf("Len() = %d, expected 4 because movie 5 has no terms", idx.Len())
+	}
+
+	for movieID := uint(1); movieID <= 4; movieID += 1 {
+		vector, ok := idx.Vector(movieID)
+		if !ok {
+			t.Fatalf("movie %d is not indexed", movieID)
+		}
+
+		if norm := math.Sqrt(dot(vector, vector)); math.Abs(norm-1) > 1e-9 {
+			t.Errorf("vector of movie %d has length %f, expected 1", movieID, norm)
+		}
+	}
+
+	// Comedy is shared by three movies and tells less about movie 2 than the Paris tag shared by two.
+	vector, _ := idx.Vector(2)
+	if vector[idx.termMap["genre:comedy"]] >= vector[idx.termMap["tag:paris"]] {
+		t.Errorf("common genre weighs %f, more than the rarer tag at %f", vector[idx.termMap["genre:comedy"]],
+			vector[idx.termMap["tag:paris"]])
+	}
+}
+
+func TestIndexProfile(t *testing.T) {
+	idx := NewIndex(testTerms)
+
+	tests := []struct {
+		name    string
+		ratings map[uint]float64
+		// A movie the profile should be more similar to than to another.
+		closest  uint
+		farthest uint
+	}{
+		{"single rating", map[uint]float64{1: 5}, 1, 4},
+		{"likes romance over horror", map[uint]float64{1: 5, 4: 1}, 2, 4},
+		{"likes horror over romance", map[uint]float64{1: 1, 4: 5}, 3, 2},
+		{"uniform ratings count equally", map[uint]float64{2: 4, 3: 4}, 3, 4},
+		{"unindexed movies are ignored", map[uint]float64{1: 5, 5: 1, 42: 1}, 1, 4},
+	}
+
+	for _, test := range tests {
+		profile := idx.Profile(test.ratings)
+		if norm := math.Sqrt(dot(profile, profile)); math.Abs(norm-1) > 1e-9 {
+			t.Errorf("%s: profile has length %f, expected 1", test.name, norm)
+		}
+
+		if idx.Score(profile, test.closest) <= idx.Score(profile, test.farthest) {
+			t.Errorf("%s: movie %d scores %f, not more than movie %d at %f", test.name, test.closest,
+				idx.Score(profile, test.closest), test.farthest, idx.Score(profile, test.farthest))
+		}
+	}
+}
+
+func TestIndexProfileEmpty(t *testing.T) {
+	idx := NewIndex(testTerms)
+	for _, ratings := range []map[uint]float64{nil, {}, {5: 4, 42: 3}} {
+		if profile := idx.Profile(ratings); len(profile) != 0 {
+			t.Errorf("Profile(%v) = %v, expected an empty vector", ratings, profile)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex(testTerms)
+	profile, _ := idx.Vector(4)
+
+	results := idx.Search(profile, 2, func(movieID uint) bool { return movieID != 4 })
+	if len(results) != 2 || results[0].ID != 3 {
+		t.Errorf("Search = %v, expected movie 3 first and 2 results", results)
+	}
+
+	for _, result := range results {
+		if result.ID == 4 {
+			t.Error("Search returned a movie that was not accepted")
+		}
+	}
+}
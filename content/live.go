@@ -0,0 +1,35 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package content recommends movies by how similar their genres and user tags are, which works for movies that nobody
+// has rated and therefore have no latent feature.
+package content
+
+import "sync"
+
+// Live holds the index that is currently serving queries, a new index is swapped in whenever the movies change.
+type Live struct {
+	mutex sync.RWMutex
+	index *Index
+}
+
+// NewLive returns a holder for the given index, which may be nil until the first index is built.
+func NewLive(index *Index) *Live {
+	return &Live{index: index}
+}
+
+// Index returns the current index, or nil if none has been built yet.
+func (l *Live) Index() *Index {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.index
+}
+
+// Swap replaces the current index.
+func (l *Live) Swap(index *Index) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.index = index
+}
@@ -39,7 +39,30 @@ func SetupDatabase() (*gorm.DB, error) {
 		return nil, err
 	}
 
-	db.AutoMigrate(&model.Movie{}, &model.MovieDetail{}, &model.MovieTrailer{}, &model.User{}, &model.Rating{})
+	// Ratings became unique per user and movie after duplicates had already been stored, those have to go before the
+	// unique index can be created.
+	if err := removeDuplicateRatings(db); err != nil {
+		return nil, err
+	}
+
+	db.AutoMigrate(&model.Movie{}, &model.MovieDetail{}, &model.MovieTrailer{}, &model.User{}, &model.Rating{},
+		&model.Group{}, &model.Interaction{}, &model.ModelVersion{}, &model.PreferenceJob{},
+		&model.Session{}, &model.APIToken{}, &model.GroupInvitation{}, &model.LoginFailure{},
+		&model.ModelActivation{})
 
 	return db, nil
 }
+
+// removeDuplicateRatings keeps the most recently updated rating of every user and movie and deletes the others.
+func removeDuplicateRatings(db *gorm.DB) error {
+	if !db.HasTable(&model.Rating{}) {
+		return nil
+	}
+
+	return db.Exec(`
+		DELETE FROM ratings
+		USING ratings AS newer
+		WHERE newer.user_id = ratings.user_id
+			AND newer.movie_id = ratings.movie_id
+			AND (newer.updated_at, newer.id) > (ratings.updated_at, ratings.id)`).Error
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
-	"github.com/gorilla/websocket"
+	"errors"
+	"fmt"
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"gonum.org/v1/gonum/mat"
+	"popcorn/hub"
 	"popcorn/lowrank"
 	"popcorn/model"
 )
@@ -14,93 +17,222 @@ type OnlineLearningEngine struct {
 	// open from separate go routines.
 	DBConn *gorm.DB
 
-	// Connection map handles the mapping of user ID to web socket connection to whichever client who initiated the long
-	// running task. We definitely need a sync/mutex for writing to ConnMap in handlers.
-	ConnMap map[uint]*websocket.Conn
+	// Connection hub holds the web socket connections of every signed in user, the engine notifies every tab of a user
+	// when a long running task of theirs is done.
+	ConnHub *hub.Hub
+
+	// Movie features only change when a model version is activated or the movies are reseeded, they are kept in memory
+	// rather than loaded for every job.
+	movieCache *MovieCache
 }
 
-func NewOnlineLearningEngine(db *gorm.DB, connMap map[uint]*websocket.Conn) *OnlineLearningEngine {
+func NewOnlineLearningEngine(db *gorm.DB, connHub *hub.Hub) *OnlineLearningEngine {
 	return &OnlineLearningEngine{
-		DBConn:  db,
-		ConnMap: connMap,
+		DBConn:     db,
+		ConnHub:    connHub,
+		movieCache: &MovieCache{},
 	}
 }
 
+// Kinds of notifications that are pushed to clients.
+const (
+	NotificationPreferenceReady = "preference_ready"
+)
+
 type Notification struct {
 	UserID  uint   `json:"user_id"`
+	Kind    string `json:"kind"`
 	Message string `json:"message"`
 }
 
-func (re *OnlineLearningEngine) ListenToInbound(queue chan *model.User) {
-	for user := range queue {
-		var movies []model.Movie
-		if err := re.DBConn.Order("id asc").Find(&movies).Error; err != nil {
-			logrus.WithField(
-				"src", "engine.go",
-			).Error("OnlineLearningEngine has failed to load all movies from database", err)
-			continue
-		}
+// MinExplicitRatings is the number of ratings a user needs before the engine trusts explicit ratings alone. Users who
+// rarely rate are folded into the model together with their implicit feedback.
+const MinExplicitRatings = 10
+
+// RecomputePreference folds a user into the model from their ratings, or from their implicit feedback as well if they
+// have rated only a few movies, and saves the new preference. It is run by the workers of the preference queue.
+func (re *OnlineLearningEngine) RecomputePreference(userID uint) error {
+	var user model.User
+	if err := re.DBConn.Where("id = ?", userID).Preload("Ratings").First(&user).Error; err != nil {
+		return err
+	}
+
+	movies, err := re.movieCache.Movies(re.DBConn)
+	if err != nil {
+		return err
+	}
 
-		// In case that database was not seeded properly and no movies are found in the database, we should not proceed
-		// with the algorithm.
-		if len(movies) == 0 {
-			logrus.WithField("src", "main.engine").Error("No movies are found in the database!")
-			continue
+	// In case that database was not seeded properly and no movies are found in the database, we should not proceed
+	// with the algorithm.
+	if len(movies) == 0 {
+		return errors.New("no movies are found in the database")
+	}
+
+	var interactions []model.Interaction
+	if err := re.DBConn.Where("user_id = ?", user.ID).Find(&interactions).Error; err != nil {
+		return err
+	}
+
+	if len(user.Ratings) < MinExplicitRatings && len(interactions) > 0 {
+		err = re.approximateImplicitUserPreference(&user, movies, interactions)
+	} else {
+		err = re.approximateUserPreference(&user, movies)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = re.DBConn.Model(&user).Updates(map[string]interface{}{
+		"preference": pq.Float64Array(user.Preference),
+		"bias":       user.Bias,
+	}).Error
+
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("src", "main.engine").Infof("preference for user %s is saved", user.Username)
+	re.ConnHub.Notify(user.ID, Notification{
+		UserID:  user.ID,
+		Kind:    NotificationPreferenceReady,
+		Message: "Preference is ready!",
+	})
+
+	return nil
+}
+
+// featureDimension returns the dimension of latent features in the database. Movies that were never rated in the
+// training set do not have a feature vector, so the first movie that has one is used.
+func featureDimension(movies []model.Movie) int {
+	for _, movie := range movies {
+		if len(movie.Feature) > 0 {
+			return len(movie.Feature)
 		}
+	}
+
+	return 0
+}
 
-		featureDim := len(movies[0].Feature)
+// approximateUserPreference runs gradient descent on the user's latent preference and bias against the features of
+// the movies that the user has rated.
+func (re *OnlineLearningEngine) approximateUserPreference(user *model.User, movies []model.Movie) error {
+	featureDim := featureDimension(movies)
+	if featureDim == 0 {
+		return errors.New("no movies have latent features")
+	}
+
+	// Construct a user rating map, mapping movie ID to user submitted movie rating value.
+	ratingMapByID := make(map[uint]float64)
+	for _, rating := range user.Ratings {
+		ratingMapByID[rating.MovieID] = rating.Value
+	}
 
-		// Construct a user rating map, mapping movie ID to user submitted movie rating value.
-		ratingMapByID := make(map[uint]float64)
-		for _, rating := range user.Ratings {
-			ratingMapByID[rating.MovieID] = rating.Value
+	// Allocate 0 length and K * M capacity for latent feature slice. Note: K is feature dimension and M is number of
+	// rated movies by the user that have a latent feature. Also create a rating matrix, which has a dimension of (1, M).
+	// Because we are only computing latent preference for one user.
+	movieFeatureData := make([]float64, 0, featureDim*len(ratingMapByID))
+	movieBiasData := make([]float64, 0, len(ratingMapByID))
+	ratingData := make([]float64, 0, len(ratingMapByID))
+	for _, movie := range movies {
+		if val, ok := ratingMapByID[movie.ID]; ok && len(movie.Feature) == featureDim {
+			movieFeatureData = append(movieFeatureData, movie.Feature...)
+			movieBiasData = append(movieBiasData, movie.Bias)
+			ratingData = append(ratingData, val)
 		}
+	}
+
+	M := len(ratingData)
+	if M == 0 {
+		return fmt.Errorf("user %s has not rated any movie with latent features", user.Username)
+	}
+
+	preference := user.Preference
+	if len(preference) != featureDim {
+		preference = nil
+	}
+
+	approximator := lowrank.NewFactorizer(nil, mat.NewDense(1, M, ratingData), featureDim)
+	approximator.MovieLatent = mat.NewDense(M, featureDim, movieFeatureData)
+	approximator.UserLatent = mat.NewDense(1, featureDim, preference)
+
+	// Movie biases are all zero when the features were trained without the biased model; the user bias then simply
+	// absorbs how far the user's ratings are from the dot products.
+	approximator.MovieBias = movieBiasData
+	approximator.UserBias = []float64{user.Bias}
+	approximator.ApproximateUserLatent(300, 50, 0, 0.005)
+
+	if len(approximator.UserLatent.RawRowView(0)) != featureDim {
+		return fmt.Errorf(`something went wrong with approximator, user latent preference vector does not have
+			the correct length; it has %d but expected %d`,
+			len(approximator.UserLatent.RawRowView(0)),
+			featureDim,
+		)
+	}
+
+	user.Preference = approximator.UserLatent.RawRowView(0)
+	user.Bias = approximator.UserBias[0]
+
+	return nil
+}
+
+// approximateImplicitUserPreference folds a user who has rated only a few movies into the model with the weighted
+// implicit least squares of Hu, Koren and Volinsky. The user bias is the average offset of the explicit ratings from
+// the movie biases; every rating and interaction then becomes a target offset from that baseline, and every movie the
+// user has not touched is softly pulled towards the baseline.
+func (re *OnlineLearningEngine) approximateImplicitUserPreference(user *model.User, movies []model.Movie,
+	interactions []model.Interaction) error {
+	featureDim := featureDimension(movies)
+	if featureDim == 0 {
+		return errors.New("no movies have latent features")
+	}
 
-		// Allocate 0 length and K * M capacity for latent feature slice. Note: K is feature dimension and M is number of
-		// rated movies by the user. Also create a rating matrix, which has a dimension of (1, M). Because we are only
-		// computing latent preference for one user.
-		M := len(ratingMapByID)
-		movieFeatureData := make([]float64, 0, featureDim*M)
-		ratingMat := mat.NewDense(1, M, nil)
-		j := 0
-		for _, movie := range movies {
-			if val, ok := ratingMapByID[movie.ID]; ok {
-				movieFeatureData = append(movieFeatureData, movie.Feature...)
-				ratingMat.Set(0, j, val)
-				j += 1
-			}
+	movieLatentMap := make(map[int][]float64)
+	movieBiasMap := make(map[int]float64)
+	for _, movie := range movies {
+		if len(movie.Feature) == featureDim {
+			movieLatentMap[int(movie.ID)] = movie.Feature
+			movieBiasMap[int(movie.ID)] = movie.Bias
 		}
+	}
 
-		approximator := lowrank.NewFactorizer(nil, ratingMat, featureDim)
-		approximator.MovieLatent = mat.NewDense(M, featureDim, movieFeatureData)
-		approximator.UserLatent = mat.NewDense(1, featureDim, user.Preference)
-		approximator.ApproximateUserLatent(300, 50, 0, 0.005)
-
-		if len(approximator.UserLatent.RawRowView(0)) == featureDim {
-			user.Preference = approximator.UserLatent.RawRowView(0)
-			if err := re.DBConn.Save(user).Error; err != nil {
-				logrus.WithField(
-					"src", "main.engine",
-				).Error("failed to save preference to user model", err)
-			} else {
-				logrus.WithField(
-					"src", "main.engine",
-				).Infof("preference for user %s is saved", user.Username)
-				// re.ConnMap[user.ID].WriteJSON(Notification{UserID: user.ID, Message: "Preference is ready!"})
-			}
-		} else {
-			logrus.WithField(
-				"src", "main.engine",
-			).Errorf(`something went wrong with approximator, user latent preference vector does not have
-				the correct length; it has %d but expected %d`,
-				len(approximator.UserLatent.RawRowView(0)),
-				featureDim,
-			)
+	userBias := 0.0
+	ratingCount := 0.0
+	for _, rating := range user.Ratings {
+		if _, ok := movieLatentMap[int(rating.MovieID)]; ok {
+			userBias += rating.Value - movieBiasMap[int(rating.MovieID)]
+			ratingCount += 1
 		}
 	}
-}
 
-func (re *OnlineLearningEngine) approximateUserPreference(user *model.User) error {
-	// Refactor the above logic into here.
+	if ratingCount > 0 {
+		userBias /= ratingCount
+	}
+
+	weightMap := make(map[int]float64)
+	for _, interaction := range interactions {
+		weightMap[int(interaction.MovieID)] += model.InteractionWeights[interaction.Kind]
+	}
+
+	offsetMap := make(map[int]float64)
+	for _, rating := range user.Ratings {
+		offsetMap[int(rating.MovieID)] = rating.Value - userBias - movieBiasMap[int(rating.MovieID)]
+	}
+
+	feedback := lowrank.NewUserFeedback(offsetMap, weightMap)
+
+	gramian, err := lowrank.Gramian(movieLatentMap)
+	if err != nil {
+		return err
+	}
+
+	preference, err := lowrank.ImplicitLeastSquaresLatent(gramian, movieLatentMap, feedback, lowrank.ImplicitReg)
+	if err != nil {
+		return err
+	}
+
+	user.Preference = preference
+	user.Bias = userBias
+
 	return nil
 }
@@ -35,6 +35,49 @@ class Recommender extends React.Component {
     dispatchRecommendedMoviesFetch: PropTypes.func.isRequired,
   };
 
+  componentWillUnmount() {
+    this.closeNotificationSocket();
+  }
+
+  componentDidUpdate(prevProps) {
+    if (prevProps.session.currentUser !== this.props.session.currentUser) {
+      this.closeNotificationSocket();
+      this.openNotificationSocket();
+    }
+  }
+
+  /**
+   * The server notifies every open tab of a signed in user when their preference has been recomputed from their latest
+   * ratings, which is when the personalized recommendations are worth fetching again.
+   */
+  openNotificationSocket() {
+    if (this.props.session.currentUser === null || typeof WebSocket === 'undefined') {
+      return;
+    }
+
+    const scheme = window.location.protocol === 'https:' ? 'wss' : 'ws';
+    this.notificationSocket = new WebSocket(`${scheme}://${window.location.host}/api/ws`);
+    this.notificationSocket.onmessage = (event) => {
+      const notification = JSON.parse(event.data);
+      if (notification.kind === 'preference_ready' && Object.keys(this.props.movieRatings).length >= 10) {
+        this.props.dispatchPersonalizedRecommendedMoviesFetch(
+          this.props.session,
+          this.props.movieYearRange,
+          this.props.moviePopularityPercentile,
+          this.props.movies.skipped
+        );
+      }
+    };
+  }
+
+  closeNotificationSocket() {
+    if (this.notificationSocket) {
+      this.notificationSocket.onmessage = null;
+      this.notificationSocket.close();
+      this.notificationSocket = null;
+    }
+  }
+
   componentWillReceiveProps(nextProps) {
     let remainingRecommendedItems = nextProps.movies.recommended.size;
 
@@ -85,6 +128,8 @@ class Recommender extends React.Component {
   }
 
   componentDidMount() {
+    this.openNotificationSocket();
+
     if (Object.keys(this.props.movies.all).length === 0) {
       this.props.dispatchAllMovieFetch();
     }
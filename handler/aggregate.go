@@ -0,0 +1,87 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import "errors"
+
+// Aggregation strategies for combining the predicted ratings of every member of a group into one group score.
+const (
+	AggregateAverage      = "average"
+	AggregateLeastMisery  = "least_misery"
+	AggregateMostPleasure = "most_pleasure"
+	AggregateFairness     = "fairness"
+)
+
+// DefaultFairnessWeight is used by the fairness strategy when the request does not provide a weight.
+const DefaultFairnessWeight = 0.5
+
+// Aggregator reduces the predicted ratings of a group for one movie into a single score.
+type Aggregator func(ratings []float64) float64
+
+// NewAggregator returns the aggregator for the given strategy. An empty strategy falls back to average. The fairness
+// weight is only used by the fairness strategy; it blends the group average with the least happy member's rating, i.e.
+// a weight of 0 is the plain average and a weight of 1 is least misery.
+func NewAggregator(strategy string, fairnessWeight float64) (Aggregator, error) {
+	switch strategy {
+	case "", AggregateAverage:
+		return average, nil
+	case AggregateLeastMisery:
+		return minimum, nil
+	case AggregateMostPleasure:
+		return maximum, nil
+	case AggregateFairness:
+		if fairnessWeight < 0 || fairnessWeight > 1 {
+			return nil, errors.New("fairness weight must be between 0 and 1")
+		}
+
+		return func(ratings []float64) float64 {
+			return (1-fairnessWeight)*average(ratings) + fairnessWeight*minimum(ratings)
+		}, nil
+	default:
+		return nil, errors.New("unknown aggregation strategy " + strategy)
+	}
+}
+
+func average(ratings []float64) float64 {
+	if len(ratings) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, rating := range ratings {
+		sum += rating
+	}
+
+	return sum / float64(len(ratings))
+}
+
+func minimum(ratings []float64) float64 {
+	if len(ratings) == 0 {
+		return 0
+	}
+
+	min := ratings[0]
+	for _, rating := range ratings[1:] {
+		if rating < min {
+			min = rating
+		}
+	}
+
+	return min
+}
+
+func maximum(ratings []float64) float64 {
+	if len(ratings) == 0 {
+		return 0
+	}
+
+	max := ratings[0]
+	for _, rating := range ratings[1:] {
+		if rating > max {
+			max = rating
+		}
+	}
+
+	return max
+}
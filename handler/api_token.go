@@ -0,0 +1,200 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"popcorn/model"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every API token so that leaked tokens are easy to recognize, and APITokenPrefixLength is how
+// much of a token is kept in the clear for telling tokens apart.
+const (
+	APITokenPrefix       = "pop_"
+	APITokenPrefixLength = 12
+)
+
+// APITokenTouchInterval is how often the last use of an API token is recorded at most, a script calling the API in a
+// loop should not write to the database on every request.
+const APITokenTouchInterval = time.Minute
+
+// APITokenCreatePayload names a new token and lists its scopes.
+type APITokenCreatePayload struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// APITokenCreateResponse is the only response that contains the token itself, it cannot be retrieved again.
+type APITokenCreateResponse struct {
+	*model.APIToken
+	Token string `json:"token"`
+}
+
+// NewAPITokenCreateHandler creates an API token for the current user.
+func NewAPITokenCreateHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+
+		var payload APITokenCreatePayload
+		if err := decoder.Decode(&payload); err != nil {
+			RenderError(w, "failed to parse request JSON into struct", http.StatusInternalServerError)
+			return
+		}
+
+		payload.Name = strings.TrimSpace(payload.Name)
+		if len(payload.Name) == 0 || len(payload.Name) > 100 {
+			RenderError(w, "please provide a name of at most 100 characters for the token", http.StatusBadRequest)
+			return
+		}
+
+		scopes, err := validateScopes(payload.Scopes)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		randStr, err := model.GenerateRandomString(32)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		token := APITokenPrefix + randStr
+		apiToken := &model.APIToken{
+			UserID:      CurrentUser(r).ID,
+			Name:        payload.Name,
+			Prefix:      token[:APITokenPrefixLength],
+			TokenDigest: model.HashToken(token),
+			Scopes:      scopes,
+		}
+
+		if err := db.Create(apiToken).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res := &APITokenCreateResponse{APIToken: apiToken, Token: token}
+		if bytes, err := json.Marshal(res); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewAPITokenListHandler lists the API tokens of the current user that have not been revoked, newest first.
+func NewAPITokenListHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiTokens := []*model.APIToken{}
+		if err := db.Where("user_id = ? and revoked_at is null", CurrentUser(r).ID).
+			Order("created_at desc").
+			Find(&apiTokens).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(apiTokens); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewAPITokenRevokeHandler revokes an API token of the current user, it stops working right away.
+func NewAPITokenRevokeHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var apiToken model.APIToken
+		err := db.Where("id = ? and user_id = ? and revoked_at is null", vars["id"], CurrentUser(r).ID).
+			First(&apiToken).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "token does not exist", http.StatusNotFound)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.Model(&apiToken).Update("revoked_at", time.Now()).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// BearerToken returns the token of the Authorization header, and false when the request does not carry one.
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[7:]), true
+}
+
+// UseAPIToken returns the API token with its user loaded, or an error when the token does not exist or was revoked.
+// The use is recorded as the last use of the token.
+func UseAPIToken(db *gorm.DB, token string) (*model.APIToken, error) {
+	var apiToken model.APIToken
+	err := db.Where("token_digest = ? and revoked_at is null", model.HashToken(token)).
+		Preload("User").
+		First(&apiToken).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) >= APITokenTouchInterval {
+		if err := db.Model(&apiToken).UpdateColumn("last_used_at", now).Error; err != nil {
+			logrus.WithField("src", "handler.api_token").Error("failed to record use of API token", err)
+		}
+	}
+
+	return &apiToken, nil
+}
+
+// validateScopes returns the scopes without duplicates, or an error if there are none or one of them is unknown.
+func validateScopes(scopes []string) (pq.StringArray, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("please provide at least one of the scopes " + strings.Join(model.Scopes, ", "))
+	}
+
+	valid := make(pq.StringArray, 0, len(scopes))
+	for _, scope := range scopes {
+		known := false
+		for _, knownScope := range model.Scopes {
+			known = known || scope == knownScope
+		}
+
+		if !known {
+			return nil, errors.New("unknown scope " + scope)
+		}
+
+		duplicate := false
+		for _, validScope := range valid {
+			duplicate = duplicate || scope == validScope
+		}
+
+		if !duplicate {
+			valid = append(valid, scope)
+		}
+	}
+
+	return valid, nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"popcorn/model"
+)
+
+type contextKey string
+
+const (
+	currentUserKey    contextKey = "current_user"
+	currentSessionKey contextKey = "current_session"
+	currentTokenKey   contextKey = "current_api_token"
+)
+
+// WithCurrentUser returns a shallow copy of the request that carries the signed in user.
+func WithCurrentUser(r *http.Request, user *model.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), currentUserKey, user))
+}
+
+// WithCurrentSession returns a shallow copy of the request that carries the session it was authenticated by, and the
+// user of the session.
+func WithCurrentSession(r *http.Request, session *model.Session) *http.Request {
+	ctx := context.WithValue(r.Context(), currentSessionKey, session)
+	return WithCurrentUser(r.WithContext(ctx), &session.User)
+}
+
+// WithCurrentAPIToken returns a shallow copy of the request that carries the API token it was authenticated by, and the
+// user of the token.
+func WithCurrentAPIToken(r *http.Request, apiToken *model.APIToken) *http.Request {
+	ctx := context.WithValue(r.Context(), currentTokenKey, apiToken)
+	return WithCurrentUser(r.WithContext(ctx), &apiToken.User)
+}
+
+// CurrentUser returns the user that the authentication middleware found for the request, or nil when the request is
+// anonymous.
+func CurrentUser(r *http.Request) *model.User {
+	user, _ := r.Context().Value(currentUserKey).(*model.User)
+	return user
+}
+
+// CurrentSession returns the session that the request was authenticated by, or nil when the request is anonymous.
+func CurrentSession(r *http.Request) *model.Session {
+	session, _ := r.Context().Value(currentSessionKey).(*model.Session)
+	return session
+}
+
+// CurrentAPIToken returns the API token that the request was authenticated by, or nil when the request was not
+// authenticated by a token.
+func CurrentAPIToken(r *http.Request) *model.APIToken {
+	apiToken, _ := r.Context().Value(currentTokenKey).(*model.APIToken)
+	return apiToken
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"math"
+	"popcorn/ann"
+	"popcorn/content"
+	"popcorn/lowrank"
+	"popcorn/model"
+	"sort"
+)
+
+// Recommendation modes of personalized recommendations.
+const (
+	ModeLatent  = "latent"
+	ModeContent = "content"
+	ModeHybrid  = "hybrid"
+)
+
+// DefaultContentWeight is the share of content similarity in the hybrid score when the request does not provide it.
+const DefaultContentWeight = 0.3
+
+// MinRating and MaxRating bound the ratings users can give, blended scores are mapped onto the same range.
+const (
+	MinRating = 0.5
+	MaxRating = 5.0
+)
+
+var errNoContentProfile = errors.New("user has not rated any movie with genres or tags")
+
+// rankByContent returns up to n movies ranked by a blend of predicted rating and content similarity, in descending
+// order of score. Predicted rating and the cosine similarity are both scaled to [0, 1] and blended with the given
+// content weight, and the blend is mapped back onto the rating scale so exploration treats it like a rating.
+//
+// Movies without a reliable latent feature, because nobody or only a few people rated them, are given the average
+// rating of the user as their predicted rating; content similarity alone decides where they are ranked against each
+// other. Candidates are the movies most similar in content, together with the best predicted movies of the latent index
+// when the latent score carries weight.
+func rankByContent(db *gorm.DB, index *content.Index, movieIndex *ann.Index, user *model.User, contentWeight float64,
+	n int, accept func(uint) bool, minYear, maxYear uint, minNumRating int, filter MovieFilter) ([]*ScoredMovie, error) {
+	ratings := make(map[uint]float64)
+	userMean := 0.0
+	for _, rating := range user.Ratings {
+		ratings[rating.MovieID] = rating.Value
+		userMean += rating.Value
+	}
+
+	profile := index.Profile(ratings)
+	if len(profile) == 0 {
+		return nil, errNoContentProfile
+	}
+
+	userMean /= float64(len(user.Ratings))
+
+	// The latent index is only consulted when its vectors match the preference of the user.
+	K := len(user.Preference)
+	var query []float64
+	if contentWeight < 1 && K > 0 && movieIndex != nil && movieIndex.Dim() == K+1 {
+		query = make([]float64, K+1)
+		copy(query, user.Preference)
+		query[K] = 1
+	}
+
+	ranked := make([]*ScoredMovie, 0, n)
+	for fetchSize := n; ; fetchSize *= 4 {
+		candidateIDs := []uint{}
+		results := index.Search(profile, fetchSize, accept)
+		for _, result := range results {
+			candidateIDs = append(candidateIDs, result.ID)
+		}
+
+		exhausted := len(results) < fetchSize
+		if query != nil {
+			latentResults, err := movieIndex.Search(query, fetchSize, accept)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, result := range latentResults {
+				candidateIDs = append(candidateIDs, result.ID)
+			}
+
+			exhausted = exhausted && len(latentResults) < fetchSize
+		}
+
+		var movies []*model.Movie
+		if err := filter.Apply(db).Where("id in (?)", uniqueIDs(candidateIDs)).
+			Where("year >= ? and year <= ?", minYear, maxYear).
+			Where("num_rating >= ?", minNumRating).
+			Find(&movies).Error; err != nil {
+			return nil, err
+		}
+
+		ranked = ranked[:0]
+		for _, movie := range movies {
+			predictedRating := userMean
+			if K > 0 && len(movie.Feature) == K && movie.NumRating >= PersonalizedMinNumRating {
+				dot, _ := lowrank.DotProduct(user.Preference, movie.Feature)
+				predictedRating = dot + movie.Bias + user.Bias
+			}
+
+			contentScore := index.Score(profile, movie.ID)
+			blended := (1-contentWeight)*scaleRating(predictedRating) + contentWeight*(contentScore+1)/2
+
+			ranked = append(ranked, &ScoredMovie{
+				Movie:           movie,
+				PredictedRating: predictedRating,
+				ContentScore:    contentScore,
+				Score:           MinRating + blended*(MaxRating-MinRating),
+			})
+		}
+
+		if len(ranked) >= n || exhausted {
+			break
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score == ranked[j].Score {
+			return ranked[i].ID < ranked[j].ID
+		}
+
+		return ranked[i].Score > ranked[j].Score
+	})
+
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+
+	return ranked, nil
+}
+
+// scaleRating maps a rating onto [0, 1], predictions outside of the rating range are clamped.
+func scaleRating(rating float64) float64 {
+	return math.Max(0, math.Min(1, (rating-MinRating)/(MaxRating-MinRating)))
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"net/url"
+	"popcorn/model"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sort orders of movie lists. Recommendations are ranked by relevance unless another order is requested, in which case
+// the page of recommendations is re-ordered; which movies are on the page does not change.
+const (
+	SortRelevance     = "relevance"
+	SortYear          = "year"
+	SortTitle         = "title"
+	SortNumRating     = "num_rating"
+	SortAverageRating = "average_rating"
+)
+
+// sortColumns maps every sort order but relevance to its ORDER BY clause.
+var sortColumns = map[string]string{
+	SortYear:          "year desc",
+	SortTitle:         "title asc",
+	SortNumRating:     "num_rating desc",
+	SortAverageRating: "average_rating desc",
+}
+
+// MovieFilter narrows down the movies of a list or of recommendations. A movie must have at least one of the included
+// genres, if any are given, and none of the excluded ones.
+type MovieFilter struct {
+	Genres           []string `json:"genres"`
+	ExcludeGenres    []string `json:"exclude_genres"`
+	MinNumRating     int      `json:"min_num_rating"`
+	MinAverageRating float64  `json:"min_average_rating"`
+	Sort             string   `json:"sort"`
+}
+
+// GenreFacet is the number of movies of a genre.
+type GenreFacet struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+// DecadeFacet is the number of movies released in a decade, e.g. 1990 for the nineties.
+type DecadeFacet struct {
+	Decade int `json:"decade"`
+	Count  int `json:"count"`
+}
+
+// MovieFacets counts the movies that match a filter by genre and by decade. Genre counts leave out the included genres
+// of the filter, so they tell how many movies each genre would add to the list.
+type MovieFacets struct {
+	Total   int           `json:"total"`
+	Genres  []GenreFacet  `json:"genres"`
+	Decades []DecadeFacet `json:"decades"`
+}
+
+// parseMovieFilter reads a filter from query parameters, genre lists are comma separated.
+func parseMovieFilter(query url.Values) (MovieFilter, error) {
+	filter := MovieFilter{
+		Genres:        splitList(query.Get("genres")),
+		ExcludeGenres: splitList(query.Get("exclude_genres")),
+		Sort:          query.Get("sort"),
+	}
+
+	var err error
+	if param := query.Get("min_num_rating"); param != "" {
+		if filter.MinNumRating, err = strconv.Atoi(param); err != nil {
+			return filter, errors.New("min_num_rating must be an integer")
+		}
+	}
+
+	if param := query.Get("min_average_rating"); param != "" {
+		if filter.MinAverageRating, err = strconv.ParseFloat(param, 64); err != nil {
+			return filter, errors.New("min_average_rating must be a number")
+		}
+	}
+
+	return filter, filter.validate()
+}
+
+func (f MovieFilter) validate() error {
+	if f.MinNumRating < 0 {
+		return errors.New("min_num_rating must not be negative")
+	}
+
+	if f.MinAverageRating < 0 || f.MinAverageRating > MaxRating {
+		return errors.New("min_average_rating must be between 0 and 5")
+	}
+
+	if _, ok := sortColumns[f.Sort]; !ok && f.Sort != "" && f.Sort != SortRelevance {
+		return errors.New("unknown sort order " + f.Sort)
+	}
+
+	return nil
+}
+
+// Apply adds the conditions of the filter to a query on the movies table. It does not order the query.
+func (f MovieFilter) Apply(db *gorm.DB) *gorm.DB {
+	// Genre lists are passed as array literals, gorm would otherwise expand a slice into a list of bind parameters.
+	if len(f.Genres) > 0 {
+		genres, _ := pq.StringArray(f.Genres).Value()
+		db = db.Where("coalesce(genres, '{}') && ?::text[]", genres)
+	}
+
+	if len(f.ExcludeGenres) > 0 {
+		excluded, _ := pq.StringArray(f.ExcludeGenres).Value()
+		db = db.Where("not (coalesce(genres, '{}') && ?::text[])", excluded)
+	}
+
+	if f.MinNumRating > 0 {
+		db = db.Where("num_rating >= ?", f.MinNumRating)
+	}
+
+	if f.MinAverageRating > 0 {
+		db = db.Where("average_rating >= ?", f.MinAverageRating)
+	}
+
+	return db
+}
+
+// Order orders a query on the movies table by the sort order of the filter, or by the given default order when the
+// filter asks for relevance or nothing.
+func (f MovieFilter) Order(db *gorm.DB, defaultOrder string) *gorm.DB {
+	if column, ok := sortColumns[f.Sort]; ok {
+		return db.Order(column).Order("id asc")
+	}
+
+	return db.Order(defaultOrder)
+}
+
+// Less returns the comparison of the sort order of the filter for sorting movies in memory, or nil when the movies
+// should keep their order.
+func (f MovieFilter) Less() func(a, b *model.Movie) bool {
+	switch f.Sort {
+	case SortYear:
+		return func(a, b *model.Movie) bool { return a.Year > b.Year }
+	case SortTitle:
+		return func(a, b *model.Movie) bool { return a.Title < b.Title }
+	case SortNumRating:
+		return func(a, b *model.Movie) bool { return a.NumRating > b.NumRating }
+	case SortAverageRating:
+		return func(a, b *model.Movie) bool { return a.AverageRating > b.AverageRating }
+	default:
+		return nil
+	}
+}
+
+// SortMovies re-orders movies in place by the sort order of the filter.
+func (f MovieFilter) SortMovies(movies []*model.Movie) {
+	if less := f.Less(); less != nil {
+		sort.SliceStable(movies, func(i, j int) bool { return less(movies[i], movies[j]) })
+	}
+}
+
+// SortScoredMovies re-orders scored movies in place by the sort order of the filter.
+func (f MovieFilter) SortScoredMovies(movies []*ScoredMovie) {
+	if less := f.Less(); less != nil {
+		sort.SliceStable(movies, func(i, j int) bool { return less(movies[i].Movie, movies[j].Movie) })
+	}
+}
+
+// countFacets counts the movies that match the filter by genre and by decade.
+func countFacets(db *gorm.DB, filter MovieFilter) (*MovieFacets, error) {
+	facets := &MovieFacets{Genres: []GenreFacet{}, Decades: []DecadeFacet{}}
+	if err := filter.Apply(db.Model(&model.Movie{})).Count(&facets.Total).Error; err != nil {
+		return nil, err
+	}
+
+	withoutGenres := filter
+	withoutGenres.Genres = nil
+
+	err := withoutGenres.Apply(db.Model(&model.Movie{})).
+		Select("unnest(genres) as genre, count(*) as count").
+		Group("genre").
+		Order("count desc, genre asc").
+		Scan(&facets.Genres).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = filter.Apply(db.Model(&model.Movie{})).
+		Select("(year / 10) * 10 as decade, count(*) as count").
+		Group("decade").
+		Order("decade asc").
+		Scan(&facets.Decades).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+func splitList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,406 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"popcorn/model"
+)
+
+type GroupRequestPayload struct {
+	Name      string `json:"name"`
+	OwnerID   uint   `json:"owner_id"`
+	MemberIDs []uint `json:"member_ids"`
+}
+
+// GroupMember is a user as the other members of a group see them, by name only.
+type GroupMember struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// GroupResponse is a group with its members and the users who are invited but have not accepted yet.
+type GroupResponse struct {
+	ID      uint           `json:"id"`
+	Name    string         `json:"name"`
+	OwnerID uint           `json:"owner_id"`
+	Members []*GroupMember `json:"members"`
+	Invited []*GroupMember `json:"invited"`
+}
+
+func NewGroupCreateHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+
+		var payload GroupRequestPayload
+		if err := decoder.Decode(&payload); err != nil {
+			RenderError(w, "failed to parse request JSON into struct", http.StatusInternalServerError)
+			return
+		}
+
+		if len(payload.Name) == 0 {
+			RenderError(w, "please provide a name for the group", http.StatusBadRequest)
+			return
+		}
+
+		members, err := findGroupMembers(db, payload.MemberIDs)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(members) != len(uniqueIDs(payload.MemberIDs)) {
+			RenderError(w, "some of the group members do not exist", http.StatusBadRequest)
+			return
+		}
+
+		// Groups are owned by whoever creates them, only admins may create one on behalf of another user.
+		currentUser := CurrentUser(r)
+		ownerID := payload.OwnerID
+		if ownerID == 0 {
+			ownerID = currentUser.ID
+		}
+
+		if !currentUser.CanActFor(ownerID) {
+			RenderError(w, "users may only create groups they own", http.StatusForbidden)
+			return
+		}
+
+		group := &model.Group{
+			Name:    payload.Name,
+			OwnerID: ownerID,
+		}
+
+		tx := db.Begin()
+		if err := tx.Create(group).Error; err != nil {
+			tx.Rollback()
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := setGroupMembers(tx, group, members, currentUser); err != nil {
+			tx.Rollback()
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res, err := newGroupResponses(db, []*model.Group{group})
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(res[0]); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+			w.Write(bytes)
+		}
+	}
+}
+
+func NewGroupListHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var groups []*model.Group
+		if err := db.Preload("Members").Order("id asc").Find(&groups).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res, err := newGroupResponses(db, groups)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(res); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+func NewGroupRetrieveHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var group model.Group
+		if err := db.Where("id = ?", vars["id"]).Preload("Members").First(&group).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "group does not exist", http.StatusNotFound)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !canViewGroup(CurrentUser(r), &group) {
+			RenderError(w, "only members may see a group", http.StatusForbidden)
+			return
+		}
+
+		res, err := newGroupResponses(db, []*model.Group{&group})
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(res[0]); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewGroupMemberUpdateHandler replaces the member list of a group with the provided member IDs. Members who are left
+// out are removed, and users who are not members yet are invited.
+func NewGroupMemberUpdateHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+
+		var payload GroupRequestPayload
+		if err := decoder.Decode(&payload); err != nil {
+			RenderError(w, "failed to parse request JSON into struct", http.StatusInternalServerError)
+			return
+		}
+
+		vars := mux.Vars(r)
+
+		var group model.Group
+		if err := db.Where("id = ?", vars["id"]).Preload("Members").First(&group).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "group does not exist", http.StatusNotFound)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		currentUser := CurrentUser(r)
+		if !currentUser.CanActFor(group.OwnerID) {
+			RenderError(w, "only the owner may change a group", http.StatusForbidden)
+			return
+		}
+
+		members, err := findGroupMembers(db, payload.MemberIDs)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(members) != len(uniqueIDs(payload.MemberIDs)) {
+			RenderError(w, "some of the group members do not exist", http.StatusBadRequest)
+			return
+		}
+
+		tx := db.Begin()
+		if err := setGroupMembers(tx, &group, members, currentUser); err != nil {
+			tx.Rollback()
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res, err := newGroupResponses(db, []*model.Group{&group})
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(res[0]); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+func NewGroupDestroyHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var group model.Group
+		if err := db.Where("id = ?", vars["id"]).First(&group).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "group does not exist", http.StatusNotFound)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !CurrentUser(r).CanActFor(group.OwnerID) {
+			RenderError(w, "only the owner may change a group", http.StatusForbidden)
+			return
+		}
+
+		if err := db.Model(&group).Association("Members").Clear().Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.Where("group_id = ?", group.ID).Delete(&model.GroupInvitation{}).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.Delete(&group).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// canViewGroup reports whether the user is the owner or a member of the group, or an admin. Members of the group must
+// be loaded.
+func canViewGroup(user *model.User, group *model.Group) bool {
+	if user.CanActFor(group.OwnerID) {
+		return true
+	}
+
+	for _, member := range group.Members {
+		if member.ID == user.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setGroupMembers makes the users the members of the group. Users who are members already stay members, as does the
+// current user, who needs no invitation to join, and everyone else is invited. Members and pending invitations of users
+// who are not among them are removed. Members of the group must be loaded, they are replaced by the new members.
+func setGroupMembers(db *gorm.DB, group *model.Group, users []model.User, currentUser *model.User) error {
+	isMember := make(map[uint]bool)
+	for _, member := range group.Members {
+		isMember[member.ID] = true
+	}
+
+	members := []model.User{}
+	invitedIDs := []uint{}
+	for _, user := range users {
+		if isMember[user.ID] || user.ID == currentUser.ID {
+			members = append(members, user)
+		} else {
+			invitedIDs = append(invitedIDs, user.ID)
+		}
+	}
+
+	if err := db.Model(group).Association("Members").Replace(members).Error; err != nil {
+		return err
+	}
+
+	group.Members = members
+
+	uninvited := db.Where("group_id = ?", group.ID)
+	if len(invitedIDs) > 0 {
+		uninvited = uninvited.Where("user_id not in (?)", invitedIDs)
+	}
+
+	if err := uninvited.Delete(&model.GroupInvitation{}).Error; err != nil {
+		return err
+	}
+
+	for _, userID := range invitedIDs {
+		err := db.Exec(`
+			INSERT INTO group_invitations (group_id, user_id, created_at, updated_at)
+			VALUES (?, ?, now(), now())
+			ON CONFLICT (group_id, user_id) DO NOTHING`,
+			group.ID, userID,
+		).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newGroupResponses names the members and the invited users of the groups. Members of the groups must be loaded.
+func newGroupResponses(db *gorm.DB, groups []*model.Group) ([]*GroupResponse, error) {
+	res := make([]*GroupResponse, 0, len(groups))
+	groupResponseMap := make(map[uint]*GroupResponse)
+	groupIDs := make([]uint, 0, len(groups))
+	for _, group := range groups {
+		groupResponse := &GroupResponse{
+			ID:      group.ID,
+			Name:    group.Name,
+			OwnerID: group.OwnerID,
+			Members: make([]*GroupMember, 0, len(group.Members)),
+			Invited: []*GroupMember{},
+		}
+
+		for _, member := range group.Members {
+			groupResponse.Members = append(groupResponse.Members, &GroupMember{ID: member.ID, Username: member.Username})
+		}
+
+		res = append(res, groupResponse)
+		groupResponseMap[group.ID] = groupResponse
+		groupIDs = append(groupIDs, group.ID)
+	}
+
+	if len(groupIDs) == 0 {
+		return res, nil
+	}
+
+	var invitations []*model.GroupInvitation
+	if err := db.Where("group_id in (?)", groupIDs).Preload("User").Order("id asc").
+		Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+
+	for _, invitation := range invitations {
+		groupResponse := groupResponseMap[invitation.GroupID]
+		groupResponse.Invited = append(groupResponse.Invited,
+			&GroupMember{ID: invitation.User.ID, Username: invitation.User.Username})
+	}
+
+	return res, nil
+}
+
+func findGroupMembers(db *gorm.DB, memberIDs []uint) ([]model.User, error) {
+	members := []model.User{}
+	if len(memberIDs) == 0 {
+		return members, nil
+	}
+
+	if err := db.Where("id in (?)", uniqueIDs(memberIDs)).Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool)
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"popcorn/model"
+	"time"
+)
+
+// GroupInvitationResponse is an invitation of the current user with the name of the group and of its owner, which is
+// all the invited user gets to see of the group before joining.
+type GroupInvitationResponse struct {
+	ID        uint         `json:"id"`
+	GroupID   uint         `json:"group_id"`
+	GroupName string       `json:"group_name"`
+	Owner     *GroupMember `json:"owner"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// NewGroupInvitationListHandler lists the groups the current user is invited to, newest first.
+func NewGroupInvitationListHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var invitations []*model.GroupInvitation
+		if err := db.Where("user_id = ?", CurrentUser(r).ID).
+			Preload("Group").
+			Order("created_at desc").
+			Find(&invitations).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ownerIDs := make([]uint, 0, len(invitations))
+		for _, invitation := range invitations {
+			ownerIDs = append(ownerIDs, invitation.Group.OwnerID)
+		}
+
+		ownerMap := make(map[uint]*GroupMember)
+		if len(ownerIDs) > 0 {
+			var owners []*model.User
+			if err := db.Select("id, username").Where("id in (?)", uniqueIDs(ownerIDs)).Find(&owners).Error; err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			for _, owner := range owners {
+				ownerMap[owner.ID] = &GroupMember{ID: owner.ID, Username: owner.Username}
+			}
+		}
+
+		res := make([]*GroupInvitationResponse, 0, len(invitations))
+		for _, invitation := range invitations {
+			res = append(res, &GroupInvitationResponse{
+				ID:        invitation.ID,
+				GroupID:   invitation.GroupID,
+				GroupName: invitation.Group.Name,
+				Owner:     ownerMap[invitation.Group.OwnerID],
+				CreatedAt: invitation.CreatedAt,
+			})
+		}
+
+		if bytes, err := json.Marshal(res); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewGroupInvitationAcceptHandler makes the current user a member of the group they are invited to, and returns the
+// group.
+func NewGroupInvitationAcceptHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invitation, ok := findGroupInvitation(db, w, r)
+		if !ok {
+			return
+		}
+
+		tx := db.Begin()
+		err := tx.Exec(`
+			INSERT INTO group_members (group_id, user_id)
+			SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM group_members WHERE group_id = ? AND user_id = ?)`,
+			invitation.GroupID, invitation.UserID, invitation.GroupID, invitation.UserID,
+		).Error
+
+		if err != nil {
+			tx.Rollback()
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Delete(invitation).Error; err != nil {
+			tx.Rollback()
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var group model.Group
+		if err := db.Where("id = ?", invitation.GroupID).Preload("Members").First(&group).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res, err := newGroupResponses(db, []*model.Group{&group})
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(res[0]); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewGroupInvitationDeclineHandler turns down an invitation of the current user.
+func NewGroupInvitationDeclineHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invitation, ok := findGroupInvitation(db, w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.Delete(invitation).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// findGroupInvitation returns the invitation of the id route variable with its group, or renders an error and returns
+// false when the current user has no such invitation.
+func findGroupInvitation(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*model.GroupInvitation, bool) {
+	var invitation model.GroupInvitation
+	err := db.Where("id = ? and user_id = ?", mux.Vars(r)["id"], CurrentUser(r).ID).
+		Preload("Group").
+		First(&invitation).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			RenderError(w, "invitation does not exist", http.StatusNotFound)
+			return nil, false
+		}
+
+		RenderError(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return &invitation, true
+}
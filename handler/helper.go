@@ -4,29 +4,299 @@
 package handler
 
 import (
+	"errors"
 	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	"gonum.org/v1/gonum/mat"
+	"net/http"
+	"popcorn/jobs"
 	"popcorn/model"
+	"time"
 )
 
-func FindUserByCredential(db *gorm.DB, username, password string) (*model.User, error) {
+// Sign ins to a username from an IP address are refused for LoginLockoutDuration after LoginMaxFailures failed sign ins
+// in a row from that address. Failures older than LoginLockoutDuration are forgotten.
+const (
+	LoginMaxFailures     = 5
+	LoginLockoutDuration = 15 * time.Minute
+)
+
+// Failed sign ins to a username are counted from every address together as well, so that a guesser who spreads them
+// over many addresses is slowed down too. After LoginAccountFreeFailures of them every further failure refuses sign ins
+// to the username for a delay that starts at LoginAccountBaseDelay and doubles up to LoginAccountMaxDelay, which keeps
+// guessing slow without locking the owner out for long. They are forgotten after LoginAccountForgetDuration without a
+// failure.
+const (
+	LoginAccountFreeFailures   = 20
+	LoginAccountBaseDelay      = time.Second
+	LoginAccountMaxDelay       = 5 * time.Minute
+	LoginAccountForgetDuration = time.Hour
+)
+
+// errLoginLocked is returned for sign ins that are locked out, the client is told no more than for a wrong password.
+var errLoginLocked = errors.New("too many failed sign ins")
+
+// FindUserByCredential returns the user with the username and password. A wrong password or unknown username counts
+// as a failed sign in to the username, from the IP address and from everywhere, and once there are too many the sign
+// ins are refused even with the right password.
+func FindUserByCredential(db *gorm.DB, username, password, ip string) (*model.User, error) {
+	now := time.Now()
+
+	// Failures are counted for whatever the client sends, which must fit the columns. An empty address is reserved for
+	// the failures from every address.
+	failedUsername, failedIP := truncate(username, 100), truncate(ip, 100)
+	if failedIP == "" {
+		failedIP = "unknown"
+	}
+
+	var failure model.LoginFailure
+	err := db.Where("username = ? and ip_address in (?, '') and locked_until > ?", failedUsername, failedIP, now).
+		First(&failure).Error
+	if err == nil {
+		return nil, errLoginLocked
+	}
+
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
 	var user model.User
 	//.Where returns a array
-	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+	err = db.Where("username = ?", username).First(&user).Error
+	if err == nil {
+		err = bcrypt.CompareHashAndPassword(user.PasswordDigest, []byte(password))
+	}
+
+	if err == gorm.ErrRecordNotFound || err == bcrypt.ErrMismatchedHashAndPassword {
+		if recordErr := recordFailedLogin(db, failedUsername, failedIP, now); recordErr != nil {
+			logrus.WithField("src", "handler.helper").Error("failed to record failed sign in", recordErr)
+		}
+
 		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PasswordDigest, []byte(password)); err != nil {
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Where("username = ? and ip_address = ?", failedUsername, failedIP).Delete(&model.LoginFailure{}).Error
+	if err != nil {
 		return nil, err
 	}
 
 	return &user, nil
 }
 
-func FindUserByToken(db *gorm.DB, token string) (*model.User, error) {
-	var user model.User
-	if err := db.Where("session_token = ?", token).First(&user).Error; err != nil {
-		return nil, err
+// recordFailedLogin counts a failed sign in to the username from the IP address, and locks them out when it is one too
+// many. The counters are incremented in the database so that concurrent attempts are all counted, the one of the
+// address starts over when the last failure was too long ago and once they are locked out. Failures that have been
+// forgotten are cleaned up on the way.
+func recordFailedLogin(db *gorm.DB, username, ip string, now time.Time) error {
+	forgotten := now.Add(-LoginLockoutDuration)
+	accountForgotten := now.Add(-LoginAccountForgetDuration)
+	if err := db.Where("(locked_until is null or locked_until < ?)", now).
+		Where("(ip_address <> '' and updated_at < ?) or (ip_address = '' and updated_at < ?)", forgotten,
+			accountForgotten).
+		Delete(&model.LoginFailure{}).Error; err != nil {
+		return err
 	}
-	return &user, nil
+
+	if err := recordFailedAccountLogin(db, username, now); err != nil {
+		return err
+	}
+
+	var failures []*model.LoginFailure
+	err := db.Raw(`
+		INSERT INTO login_failures (username, ip_address, count, created_at, updated_at)
+		VALUES (?, ?, 1, now(), now())
+		ON CONFLICT (username, ip_address) DO UPDATE SET
+			count = CASE
+				WHEN login_failures.updated_at < ? THEN 1
+				WHEN login_failures.count + 1 >= ? THEN 0
+				ELSE login_failures.count + 1
+			END,
+			locked_until = CASE
+				WHEN login_failures.updated_at >= ? AND login_failures.count + 1 >= ? THEN ?
+				ELSE login_failures.locked_until
+			END,
+			updated_at = now()
+		RETURNING *`,
+		username, ip,
+		forgotten, LoginMaxFailures,
+		forgotten, LoginMaxFailures, now.Add(LoginLockoutDuration),
+	).Scan(&failures).Error
+	if err != nil {
+		return err
+	}
+
+	if len(failures) > 0 && failures[0].LockedUntil != nil && failures[0].LockedUntil.After(now) {
+		logrus.WithField("src", "handler.helper").Warnf("locked out sign ins to %s from %s after %d failures",
+			username, ip, LoginMaxFailures)
+	}
+
+	return nil
+}
+
+// recordFailedAccountLogin counts a failed sign in to the username from any address, and delays further sign ins to it
+// once there have been more than LoginAccountFreeFailures.
+func recordFailedAccountLogin(db *gorm.DB, username string, now time.Time) error {
+	var failures []*model.LoginFailure
+	err := db.Raw(`
+		INSERT INTO login_failures (username, ip_address, count, created_at, updated_at)
+		VALUES (?, '', 1, now(), now())
+		ON CONFLICT (username, ip_address) DO UPDATE SET
+			count = CASE WHEN login_failures.updated_at < ? THEN 1 ELSE login_failures.count + 1 END,
+			updated_at = now()
+		RETURNING *`,
+		username, now.Add(-LoginAccountForgetDuration),
+	).Scan(&failures).Error
+	if err != nil {
+		return err
+	}
+
+	if len(failures) == 0 || failures[0].Count <= LoginAccountFreeFailures {
+		return nil
+	}
+
+	// The warning is logged once, when the delay first reaches its maximum.
+	delay := loginAccountDelay(failures[0].Count)
+	if delay == LoginAccountMaxDelay && loginAccountDelay(failures[0].Count-1) < LoginAccountMaxDelay {
+		logrus.WithField("src", "handler.helper").Warnf("delayed sign ins to %s by %v after %d failures",
+			username, delay, failures[0].Count)
+	}
+
+	return db.Model(failures[0]).Update("locked_until", now.Add(delay)).Error
+}
+
+// loginAccountDelay returns how long sign ins to a username are refused after the given number of failures, which
+// must be more than LoginAccountFreeFailures.
+func loginAccountDelay(count int) time.Duration {
+	delay := LoginAccountBaseDelay
+	for n := LoginAccountFreeFailures + 1; n < count && delay < LoginAccountMaxDelay; n += 1 {
+		delay *= 2
+	}
+
+	if delay > LoginAccountMaxDelay {
+		return LoginAccountMaxDelay
+	}
+
+	return delay
+}
+
+// popularityFraction converts the popularity percentile requested by the client into the fraction of most rated movies
+// that should be considered for recommendations.
+func popularityFraction(percentile uint) float64 {
+	switch percentile {
+	case 100:
+		return 0.01
+	case 80:
+		return 0.2
+	case 60:
+		return 0.4
+	case 40:
+		return 0.6
+	case 20:
+		return 0.8
+	default:
+		return 1.0
+	}
+}
+
+// popularityThreshold returns the number of ratings a movie released between the given years needs to be within the
+// requested popularity percentile.
+func popularityThreshold(db *gorm.DB, percentile uint, minYear, maxYear uint) (int, error) {
+	var movieCount int
+	err := db.Model(&model.Movie{}).Where("year >= ? and year <= ?", minYear, maxYear).Count(&movieCount).Error
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int(float64(movieCount)*popularityFraction(percentile)) - 1
+	if offset < 0 {
+		offset = 0
+	}
+
+	var numRatings []int
+	if err := db.Model(&model.Movie{}).
+		Where("year >= ? and year <= ?", minYear, maxYear).
+		Order("num_rating desc").
+		Offset(offset).
+		Limit(1).
+		Pluck("num_rating", &numRatings).Error; err != nil {
+		return 0, err
+	}
+
+	if len(numRatings) == 0 {
+		return 0, nil
+	}
+
+	return numRatings[0], nil
+}
+
+// addBiases adds the user and movie biases of the biased factorization model to a (N, M) matrix of dot products between
+// N users and M movies. Movie bias already includes the global mean rating.
+func addBiases(predictedRatings *mat.Dense, users []model.User, movies []*model.Movie) {
+	for i, user := range users {
+		for j, movie := range movies {
+			predictedRatings.Set(i, j, predictedRatings.At(i, j)+user.Bias+movie.Bias)
+		}
+	}
+}
+
+// enqueuePreferenceUpdate asks the online learning engine to recompute the latent preference of a user. The job is
+// persisted, so it is run eventually however busy the engine is.
+func enqueuePreferenceUpdate(preferenceQueue *jobs.PreferenceQueue, userID uint) {
+	if err := preferenceQueue.Enqueue(userID); err != nil {
+		logrus.WithField("src", "handler.helper").Error("failed to enqueue preference update", err)
+	}
+}
+
+// recordSkips persists every skipped movie as implicit feedback. A skip is recorded only once per user and movie
+// because clients resend the whole skipped list with every recommendation request. It returns the number of new skips.
+func recordSkips(db *gorm.DB, userID uint, movieIDs []uint) (int, error) {
+	count := 0
+	for _, movieID := range uniqueIDs(movieIDs) {
+		var existing model.Interaction
+		err := db.Where("user_id = ? and movie_id = ? and kind = ?", userID, movieID, model.InteractionSkip).
+			First(&existing).Error
+		if err == nil {
+			continue
+		}
+
+		if err != gorm.ErrRecordNotFound {
+			return count, err
+		}
+
+		interaction := &model.Interaction{UserID: userID, MovieID: movieID, Kind: model.InteractionSkip}
+		if err := db.Create(interaction).Error; err != nil {
+			return count, err
+		}
+
+		count += 1
+	}
+
+	return count, nil
+}
+
+// recordView persists a detail or trailer view of the movie with the given IMDB ID by the user of the request.
+// Anonymous requests are not recorded.
+func recordView(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue, r *http.Request, IMDBID, kind string) {
+	user := CurrentUser(r)
+	if user == nil {
+		return
+	}
+
+	var movie model.Movie
+	if err := db.Where("imdb_id = ?", IMDBID).First(&movie).Error; err != nil {
+		return
+	}
+
+	interaction := &model.Interaction{UserID: user.ID, MovieID: movie.ID, Kind: kind}
+	if err := db.Create(interaction).Error; err != nil {
+		logrus.WithField("src", "handler.helper").Error("failed to record interaction", err)
+		return
+	}
+
+	enqueuePreferenceUpdate(preferenceQueue, user.ID)
 }
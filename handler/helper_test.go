@@ -0,0 +1,29 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginAccountDelay(t *testing.T) {
+	tests := []struct {
+		count    int
+		expected time.Duration
+	}{
+		{LoginAccountFreeFailures + 1, time.Second},
+		{LoginAccountFreeFailures + 2, 2 * time.Second},
+		{LoginAccountFreeFailures + 3, 4 * time.Second},
+		{LoginAccountFreeFailures + 9, 256 * time.Second},
+		{LoginAccountFreeFailures + 10, LoginAccountMaxDelay},
+		{LoginAccountFreeFailures + 1000, LoginAccountMaxDelay},
+	}
+
+	for _, test := range tests {
+		if actual := loginAccountDelay(test.count); actual != test.expected {
+			t.Errorf("loginAccountDelay(%d) = %v, expected %v", test.count, actual, test.expected)
+		}
+	}
+}
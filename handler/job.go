@@ -0,0 +1,61 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"popcorn/jobs"
+	"strconv"
+)
+
+// NewPreferenceQueueStatsHandler reports how many preference jobs are pending, running, done and failed.
+func NewPreferenceQueueStatsHandler(preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := preferenceQueue.Stats()
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(stats); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewPreferenceJobRetrieveHandler reports the status of the preference job of a user, clients can poll it to find out
+// whether the preference has caught up with the latest ratings.
+func NewPreferenceJobRetrieveHandler(preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		userID, err := strconv.ParseUint(vars["id"], 10, 64)
+		if err != nil {
+			RenderError(w, "user ID must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		job, err := preferenceQueue.Job(uint(userID))
+		if err == gorm.ErrRecordNotFound {
+			RenderError(w, "user has no preference job", http.StatusNotFound)
+			return
+		} else if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if bytes, err := json.Marshal(job); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
@@ -10,18 +10,44 @@ import (
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"net/http"
+	"popcorn/jobs"
 	"popcorn/model"
 )
 
+// MovieListResponse is returned by the movie list when facets are requested, otherwise the list is a plain array.
+type MovieListResponse struct {
+	Movies []*model.Movie `json:"movies"`
+	Facets *MovieFacets   `json:"facets"`
+}
+
+// NewMovieListHandler lists the movies that match the filter in the query parameters, newest first unless a sort order
+// is given. With facets=true the list comes with counts by genre and decade for building filters.
 func NewMovieListHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseMovieFilter(r.URL.Query())
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		var movies []*model.Movie
-		if err := db.Order("year desc").Find(&movies).Error; err != nil {
+		if err := filter.Order(filter.Apply(db), "year desc").Find(&movies).Error; err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		if bytes, err := json.Marshal(movies); err != nil {
+		var res interface{} = movies
+		if r.URL.Query().Get("facets") == "true" {
+			facets, err := countFacets(db, filter)
+			if err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			res = &MovieListResponse{Movies: movies, Facets: facets}
+		}
+
+		if bytes, err := json.Marshal(res); err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
 		} else {
 			w.WriteHeader(http.StatusOK)
@@ -69,7 +95,7 @@ func NewPopularMovieListHandler(db *gorm.DB) http.HandlerFunc {
 	}
 }
 
-func NewMovieDetailHandler(db *gorm.DB) http.HandlerFunc {
+func NewMovieDetailHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 
@@ -132,12 +158,14 @@ func NewMovieDetailHandler(db *gorm.DB) http.HandlerFunc {
 			}
 		}
 
+		recordView(db, preferenceQueue, r, vars["IMDBID"], model.InteractionDetailView)
+
 		w.WriteHeader(http.StatusOK)
 		w.Write(detail.Data)
 	}
 }
 
-func NewMovieTrailerHandler(db *gorm.DB) http.HandlerFunc {
+func NewMovieTrailerHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 
@@ -205,6 +233,8 @@ func NewMovieTrailerHandler(db *gorm.DB) http.HandlerFunc {
 			}
 		}
 
+		recordView(db, preferenceQueue, r, vars["IMDBID"], model.InteractionTrailerView)
+
 		w.WriteHeader(http.StatusOK)
 		w.Write(trailer.Data)
 	}
@@ -0,0 +1,356 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"net/http"
+	"popcorn/jobs"
+	"popcorn/lowrank"
+	"popcorn/model"
+	"strconv"
+)
+
+// Onboarding asks a new user to rate the movies that tell the most about their taste. Questions are drawn from the
+// OnboardingCandidateSize most rated movies, which a new user is likely to have seen, and once OnboardingMinAnswers of
+// them are answered the answers are folded into an initial preference with regularization OnboardingReg.
+const (
+	OnboardingDefaultLimit  = 10
+	OnboardingMaxLimit      = 50
+	OnboardingMinAnswers    = 5
+	OnboardingCandidateSize = 500
+	OnboardingReg           = 0.1
+)
+
+type OnboardingAnswer struct {
+	MovieID uint    `json:"movie_id"`
+	Rating  float64 `json:"rating"`
+}
+
+// OnboardingAnswerPayload carries the ratings of the questions a user has answered and the movies they have not seen,
+// which are recorded as skips so they are not asked again.
+type OnboardingAnswerPayload struct {
+	Answers []OnboardingAnswer `json:"answers"`
+	Unseen  []uint             `json:"unseen"`
+	Limit   int                `json:"limit"`
+}
+
+type OnboardingResponse struct {
+	Questions       []*model.Movie `json:"questions"`
+	NumAnswered     int            `json:"num_answered"`
+	MinAnswers      int            `json:"min_answers"`
+	PreferenceReady bool           `json:"preference_ready"`
+}
+
+// NewOnboardingQuestionHandler returns the next movies a user should rate, the number of questions is given by the
+// limit query parameter.
+func NewOnboardingQuestionHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := OnboardingDefaultLimit
+		if param := r.URL.Query().Get("limit"); param != "" {
+			var err error
+			if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > OnboardingMaxLimit {
+				RenderError(w, "limit must be between 1 and "+strconv.Itoa(OnboardingMaxLimit), http.StatusBadRequest)
+				return
+			}
+		}
+
+		vars := mux.Vars(r)
+		var user model.User
+		if err := db.Where("id = ?", vars["id"]).Preload("Ratings").First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "user does not exist", http.StatusBadRequest)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		renderOnboarding(w, db, &user, limit)
+	}
+}
+
+// NewOnboardingAnswerHandler saves the answers of a user and, once enough questions are answered, solves for the
+// preference of the user in closed form so that personalized recommendations are available right away. Like every
+// other rating, the answers also queue the user for the online learning engine. It responds with the next questions.
+func NewOnboardingAnswerHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+
+		var payload OnboardingAnswerPayload
+		if err := decoder.Decode(&payload); err != nil {
+			RenderError(w, "failed to parse request JSON into struct", http.StatusInternalServerError)
+			return
+		}
+
+		limit := payload.Limit
+		if limit == 0 {
+			limit = OnboardingDefaultLimit
+		}
+
+		if limit < 0 || limit > OnboardingMaxLimit {
+			RenderError(w, "limit must be between 1 and "+strconv.Itoa(OnboardingMaxLimit), http.StatusBadRequest)
+			return
+		}
+
+		for _, answer := range payload.Answers {
+			if answer.Rating < 0.5 || answer.Rating > 5 {
+				RenderError(w, "rating must be between 0.5 and 5", http.StatusBadRequest)
+				return
+			}
+		}
+
+		movieIDs := append([]uint{}, payload.Unseen...)
+		for _, answer := range payload.Answers {
+			movieIDs = append(movieIDs, answer.MovieID)
+		}
+
+		if movieID, missing, err := findMissingMovie(db, movieIDs); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		} else if missing {
+			RenderError(w, "movie "+strconv.Itoa(int(movieID))+" does not exist", http.StatusBadRequest)
+			return
+		}
+
+		vars := mux.Vars(r)
+		var user model.User
+		if err := db.Where("id = ?", vars["id"]).First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "user does not exist", http.StatusBadRequest)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, answer := range payload.Answers {
+			rating := &model.Rating{UserID: user.ID, MovieID: answer.MovieID, Value: answer.Rating}
+			if err := upsertRating(db, rating); err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		skipCount, err := recordSkips(db, user.ID, payload.Unseen)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(payload.Answers) > 0 || skipCount > 0 {
+			enqueuePreferenceUpdate(preferenceQueue, user.ID)
+		}
+
+		if err := db.Model(&user).Related(&user.Ratings).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ratedMovies, K, err := loadRatedMovies(db, user.Ratings)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(ratedMovies) >= OnboardingMinAnswers {
+			preference, bias, err := foldInPreference(user.Ratings, ratedMovies, K)
+			if err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			err = db.Model(&user).Updates(map[string]interface{}{
+				"preference": pq.Float64Array(preference),
+				"bias":       bias,
+			}).Error
+
+			if err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			user.Preference = preference
+		}
+
+		renderOnboarding(w, db, &user, limit)
+	}
+}
+
+// findMissingMovie returns the first of the movie IDs that no movie has, and false when they all exist.
+func findMissingMovie(db *gorm.DB, movieIDs []uint) (uint, bool, error) {
+	movieIDs = uniqueIDs(movieIDs)
+	if len(movieIDs) == 0 {
+		return 0, false, nil
+	}
+
+	var existingIDs []uint
+	if err := db.Model(&model.Movie{}).Where("id in (?)", movieIDs).Pluck("id", &existingIDs).Error; err != nil {
+		return 0, false, err
+	}
+
+	existing := make(map[uint]bool)
+	for _, movieID := range existingIDs {
+		existing[movieID] = true
+	}
+
+	for _, movieID := range movieIDs {
+		if !existing[movieID] {
+			return movieID, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// renderOnboarding picks the next questions for a user whose ratings are loaded and writes the response.
+func renderOnboarding(w http.ResponseWriter, db *gorm.DB, user *model.User, limit int) {
+	var candidates []*model.Movie
+	err := db.Where("array_length(feature, 1) > 0").
+		Order("num_rating desc").
+		Limit(OnboardingCandidateSize).
+		Find(&candidates).Error
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(candidates) == 0 {
+		RenderError(w, "no movies have latent features", http.StatusInternalServerError)
+		return
+	}
+
+	ratedMovies, K, err := loadRatedMovies(db, user.Ratings)
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var unseen []uint
+	err = db.Model(&model.Interaction{}).
+		Where("user_id = ? and kind = ?", user.ID, model.InteractionSkip).
+		Pluck("movie_id", &unseen).Error
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	excluded := make(map[uint]bool)
+	for _, rating := range user.Ratings {
+		excluded[rating.MovieID] = true
+	}
+
+	for _, movieID := range unseen {
+		excluded[movieID] = true
+	}
+
+	known := make([][]float64, 0, len(ratedMovies))
+	for _, movie := range ratedMovies {
+		known = append(known, movie.Feature)
+	}
+
+	movieMap := make(map[int]*model.Movie)
+	featureMap := make(map[int][]float64)
+	for _, movie := range candidates {
+		if !excluded[movie.ID] && len(movie.Feature) == K {
+			movieMap[int(movie.ID)] = movie
+			featureMap[int(movie.ID)] = movie.Feature
+		}
+	}
+
+	movieIDs, err := lowrank.MostInformative(featureMap, known, limit, K, OnboardingReg)
+	if err != nil {
+		RenderError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := &OnboardingResponse{
+		Questions:       make([]*model.Movie, 0, len(movieIDs)),
+		NumAnswered:     len(ratedMovies),
+		MinAnswers:      OnboardingMinAnswers,
+		PreferenceReady: len(user.Preference) == K,
+	}
+
+	for _, movieID := range movieIDs {
+		res.Questions = append(res.Questions, movieMap[movieID])
+	}
+
+	if bytes, err := json.Marshal(res); err != nil {
+		RenderError(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.WriteHeader(http.StatusOK)
+		w.Write(bytes)
+	}
+}
+
+// loadRatedMovies returns the rated movies that have a latent feature of the dimension served by the most rated movie,
+// keyed by movie ID, together with that dimension.
+func loadRatedMovies(db *gorm.DB, ratings []model.Rating) (map[uint]*model.Movie, int, error) {
+	var top model.Movie
+	if err := db.Select("feature").Where("array_length(feature, 1) > 0").Order("num_rating desc").
+		First(&top).Error; err != nil {
+		return nil, 0, err
+	}
+
+	K := len(top.Feature)
+
+	movieIDs := make([]uint, 0, len(ratings))
+	for _, rating := range ratings {
+		movieIDs = append(movieIDs, rating.MovieID)
+	}
+
+	movieMap := make(map[uint]*model.Movie)
+	if len(movieIDs) == 0 {
+		return movieMap, K, nil
+	}
+
+	var movies []*model.Movie
+	if err := db.Select("id, feature, bias").Where("id in (?)", movieIDs).Find(&movies).Error; err != nil {
+		return nil, 0, err
+	}
+
+	for _, movie := range movies {
+		if len(movie.Feature) == K {
+			movieMap[movie.ID] = movie
+		}
+	}
+
+	return movieMap, K, nil
+}
+
+// foldInPreference solves for the preference and bias of a user from their ratings with the movie features held
+// fixed. The user bias is the average offset of the ratings from the movie biases, and the preference is the
+// regularized least squares fit of what is left.
+func foldInPreference(ratings []model.Rating, movieMap map[uint]*model.Movie, K int) ([]float64, float64, error) {
+	features := [][]float64{}
+	targets := []float64{}
+	userBias := 0.0
+	for _, rating := range ratings {
+		if movie, ok := movieMap[rating.MovieID]; ok {
+			features = append(features, movie.Feature)
+			targets = append(targets, rating.Value-movie.Bias)
+			userBias += rating.Value - movie.Bias
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, 0, errors.New("user has not rated any movie with latent features")
+	}
+
+	userBias /= float64(len(targets))
+	for i := range targets {
+		targets[i] -= userBias
+	}
+
+	preference, err := lowrank.LeastSquaresLatent(features, targets, K, OnboardingReg)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return preference, userBias, nil
+}
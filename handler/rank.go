@@ -0,0 +1,132 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"popcorn/model"
+)
+
+// Exploration strategies for mixing movies that the model is less sure about into a ranked list of recommendations.
+// Without exploration users only ever see what the model already believes they like, and it never learns otherwise.
+const (
+	ExploreNone          = "none"
+	ExploreEpsilonGreedy = "epsilon_greedy"
+	ExploreSoftmax       = "softmax"
+)
+
+// Default knobs of the exploration strategies, used when the request does not provide them.
+const (
+	DefaultEpsilon     = 0.1
+	DefaultTemperature = 0.5
+)
+
+// ScoredMovie embeds the movie so that the JSON keeps the same shape as the other recommendation endpoints, with the
+// predicted rating attached. Score is what the movie is ranked by, on the same scale as ratings; it is the predicted
+// rating unless content similarity is blended in, and ContentScore is then the cosine similarity between the genres and
+// tags of the movie and those the user likes. Explored is set for movies that were not placed by their score.
+type ScoredMovie struct {
+	*model.Movie
+	PredictedRating float64 `json:"predicted_rating"`
+	Score           float64 `json:"score"`
+	ContentScore    float64 `json:"content_score"`
+	Explored        bool    `json:"explored"`
+}
+
+// Explorer re-orders a list of movies that is sorted by descending score. It must return a permutation of
+// the list.
+type Explorer func(ranked []*ScoredMovie, random *rand.Rand) []*ScoredMovie
+
+// NewExplorer returns the explorer for the given strategy. An empty strategy falls back to none, which keeps the
+// ranking as it is. Epsilon is the probability that a slot is filled by a uniformly random movie from the rest of the
+// list; temperature controls how far softmax sampling strays from the ranking, a temperature close to 0 keeps the
+// ranking and a large one is close to a random shuffle.
+func NewExplorer(strategy string, epsilon, temperature float64) (Explorer, error) {
+	switch strategy {
+	case "", ExploreNone:
+		return func(ranked []*ScoredMovie, random *rand.Rand) []*ScoredMovie {
+			return ranked
+		}, nil
+	case ExploreEpsilonGreedy:
+		if epsilon < 0 || epsilon > 1 {
+			return nil, errors.New("epsilon must be between 0 and 1")
+		}
+
+		return func(ranked []*ScoredMovie, random *rand.Rand) []*ScoredMovie {
+			return epsilonGreedy(ranked, epsilon, random)
+		}, nil
+	case ExploreSoftmax:
+		if temperature <= 0 {
+			return nil, errors.New("temperature must be positive")
+		}
+
+		return func(ranked []*ScoredMovie, random *rand.Rand) []*ScoredMovie {
+			return softmaxSample(ranked, temperature, random)
+		}, nil
+	default:
+		return nil, errors.New("unknown exploration strategy " + strategy)
+	}
+}
+
+func epsilonGreedy(ranked []*ScoredMovie, epsilon float64, random *rand.Rand) []*ScoredMovie {
+	remaining := make([]*ScoredMovie, len(ranked))
+	copy(remaining, ranked)
+
+	reordered := make([]*ScoredMovie, 0, len(ranked))
+	for len(remaining) > 0 {
+		j := 0
+		if len(remaining) > 1 && random.Float64() < epsilon {
+			j = 1 + random.Intn(len(remaining)-1)
+			remaining[j].Explored = true
+		}
+
+		reordered = append(reordered, remaining[j])
+		remaining = append(remaining[:j], remaining[j+1:]...)
+	}
+
+	return reordered
+}
+
+// softmaxSample draws movies without replacement, each with probability proportional to exp(score / temperature).
+func softmaxSample(ranked []*ScoredMovie, temperature float64, random *rand.Rand) []*ScoredMovie {
+	remaining := make([]*ScoredMovie, len(ranked))
+	copy(remaining, ranked)
+
+	reordered := make([]*ScoredMovie, 0, len(ranked))
+	for len(remaining) > 0 {
+		// Subtract the largest score before exponentiating so that a small temperature does not overflow.
+		maxScore := math.Inf(-1)
+		for _, movie := range remaining {
+			maxScore = math.Max(maxScore, movie.Score)
+		}
+
+		weights := make([]float64, len(remaining))
+		total := 0.0
+		for i, movie := range remaining {
+			weights[i] = math.Exp((movie.Score - maxScore) / temperature)
+			total += weights[i]
+		}
+
+		j := len(remaining) - 1
+		threshold := random.Float64() * total
+		for i, weight := range weights {
+			threshold -= weight
+			if threshold < 0 {
+				j = i
+				break
+			}
+		}
+
+		if j != 0 {
+			remaining[j].Explored = true
+		}
+
+		reordered = append(reordered, remaining[j])
+		remaining = append(remaining[:j], remaining[j+1:]...)
+	}
+
+	return reordered
+}
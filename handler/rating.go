@@ -5,9 +5,11 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	"net/http"
+	"popcorn/jobs"
 	"popcorn/model"
 )
 
@@ -30,7 +32,17 @@ func NewRatingListHandler(db *gorm.DB) http.HandlerFunc {
 	}
 }
 
-func NewRatingCreateHandler(db *gorm.DB, updateUserPreferenceQueue chan *model.User) http.HandlerFunc {
+// RatingUpdatePayload is the body of rating updates. The movie of a rating cannot be changed, it may only be repeated.
+// A PUT must provide the rating value, a PATCH may leave it out and then changes nothing.
+type RatingUpdatePayload struct {
+	MovieID *uint    `json:"movie_id"`
+	Value   *float64 `json:"rating"`
+}
+
+// NewRatingCreateHandler saves the rating of a movie by the current user, who is assumed when the request leaves out
+// the user. A movie that the user has already rated is not rated twice, the value of the existing rating is updated
+// instead. Only admins may rate on behalf of another user.
+func NewRatingCreateHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 
@@ -40,18 +52,90 @@ func NewRatingCreateHandler(db *gorm.DB, updateUserPreferenceQueue chan *model.U
 			return
 		}
 
-		if err := db.Create(&rating).Error; err != nil {
+		if err := validateRatingValue(rating.Value); err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		currentUser := CurrentUser(r)
+		if rating.UserID == 0 {
+			rating.UserID = currentUser.ID
+		}
+
+		if !currentUser.CanActFor(rating.UserID) {
+			RenderError(w, "users may only rate movies for themselves", http.StatusForbidden)
+			return
+		}
+
+		if err := upsertRating(db, &rating); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		enqueuePreferenceUpdate(preferenceQueue, rating.UserID)
+
+		if bytes, err := json.Marshal(&rating); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewRatingUpdateHandler changes the value of a rating, it serves both PUT and PATCH; with partial set the value may be
+// left out of the request.
+func NewRatingUpdateHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue, partial bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+
+		var payload RatingUpdatePayload
+		if err := decoder.Decode(&payload); err != nil {
+			RenderError(w, "failed to parse request JSON into struct", http.StatusInternalServerError)
+			return
+		}
+
+		if payload.Value == nil && !partial {
+			RenderError(w, "rating is required", http.StatusBadRequest)
+			return
+		}
+
+		if payload.Value != nil {
+			if err := validateRatingValue(*payload.Value); err != nil {
+				RenderError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		vars := mux.Vars(r)
+
+		var rating model.Rating
+		if err := db.Where("id = ?", vars["id"]).First(&rating).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "rating does not exist", http.StatusNotFound)
+				return
+			}
 			RenderError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		var user model.User
-		if err := db.Where("id = ?", rating.UserID).Preload("Ratings").First(&user).Error; err == nil {
-			// If the recommendation engine is too busy, we should just drop the request.
-			select {
-			case updateUserPreferenceQueue <- &user:
-			default:
+		if !CurrentUser(r).CanActFor(rating.UserID) {
+			RenderError(w, "users may only change their own ratings", http.StatusForbidden)
+			return
+		}
+
+		if payload.MovieID != nil && *payload.MovieID != rating.MovieID {
+			RenderError(w, "the movie of a rating cannot be changed", http.StatusBadRequest)
+			return
+		}
+
+		if payload.Value != nil {
+			if err := db.Model(&rating).Update("value", *payload.Value).Error; err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+
+			enqueuePreferenceUpdate(preferenceQueue, rating.UserID)
 		}
 
 		if bytes, err := json.Marshal(&rating); err != nil {
@@ -62,3 +146,55 @@ func NewRatingCreateHandler(db *gorm.DB, updateUserPreferenceQueue chan *model.U
 		}
 	}
 }
+
+func NewRatingDestroyHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var rating model.Rating
+		if err := db.Where("id = ?", vars["id"]).First(&rating).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "rating does not exist", http.StatusNotFound)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !CurrentUser(r).CanActFor(rating.UserID) {
+			RenderError(w, "users may only delete their own ratings", http.StatusForbidden)
+			return
+		}
+
+		if err := db.Delete(&rating).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		enqueuePreferenceUpdate(preferenceQueue, rating.UserID)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// upsertRating inserts the rating, or updates the value of the rating the user already gave to the movie. The rating
+// is filled with the stored row either way.
+func upsertRating(db *gorm.DB, rating *model.Rating) error {
+	return db.Raw(`
+		INSERT INTO ratings (user_id, movie_id, value, created_at, updated_at)
+		VALUES (?, ?, ?, now(), now())
+		ON CONFLICT (user_id, movie_id) DO UPDATE SET
+			value = excluded.value,
+			updated_at = now()
+		RETURNING *`,
+		rating.UserID, rating.MovieID, rating.Value,
+	).Scan(rating).Error
+}
+
+func validateRatingValue(value float64) error {
+	if value < MinRating || value > MaxRating {
+		return errors.New("rating must be between 0.5 and 5")
+	}
+
+	return nil
+}
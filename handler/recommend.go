@@ -7,9 +7,13 @@ import (
 	"encoding/json"
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
 	"gonum.org/v1/gonum/mat"
 	"math/rand"
 	"net/http"
+	"popcorn/ann"
+	"popcorn/content"
+	"popcorn/jobs"
 	"popcorn/model"
 	"sort"
 	"strconv"
@@ -22,6 +26,7 @@ type RecommendRequestPayload struct {
 	Percentile uint             `json:"percent"`
 	Skipped    []uint           `json:"skipped"`
 	Ratings    map[uint]float64 `json:"ratings"`
+	MovieFilter
 }
 
 type ClusterCount struct {
@@ -29,7 +34,7 @@ type ClusterCount struct {
 	Count     int
 }
 
-func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
+func NewMovieRecommendationHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 
@@ -39,6 +44,13 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
+		if err := payload.MovieFilter.validate(); err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filter := payload.MovieFilter
+
 		var maxYear uint = 2018
 		var minYear uint = 1930
 		if payload.MaxYear != 0 {
@@ -67,6 +79,16 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 			skipped[movieID] = true
 		}
 
+		// Anonymous users do not have a preference to update, but a signed in user may use the general recommendation
+		// too and their skips are still worth keeping.
+		if user := CurrentUser(r); user != nil {
+			if count, err := recordSkips(db, user.ID, payload.Skipped); err != nil {
+				logrus.WithField("src", "handler.recommend").Error("failed to record skipped movies", err)
+			} else if count > 0 {
+				enqueuePreferenceUpdate(preferenceQueue, user.ID)
+			}
+		}
+
 		var movieCount int
 		if err := db.Model(&model.Movie{}).Count(&movieCount).Error; err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
@@ -147,7 +169,7 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 		}
 
 		var bestMovies []*model.Movie
-		if err := db.Limit(limit).
+		if err := filter.Apply(db).Limit(limit).
 			Where("cluster_id in (?)", bestClusters).
 			Where("year >= ? and year <= ?", minYear, maxYear).
 			Order("num_rating desc").
@@ -158,7 +180,7 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 
 		var highMovies []*model.Movie
 		if len(bestMovies) < 301 {
-			if err := db.Limit(limit).
+			if err := filter.Apply(db).Limit(limit).
 				Where("cluster_id in (?)", highRatedMovies).
 				Where("year >= ? and year <= ?", minYear, maxYear).
 				Order("num_rating desc").
@@ -170,7 +192,7 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 
 		var lowMovies []*model.Movie
 		if len(bestMovies) < 301 {
-			if err := db.Limit(limit).
+			if err := filter.Apply(db).Limit(limit).
 				Where("cluster_id in (?)", lowRatedMovies).
 				Where("year >= ? and year <= ?", minYear, maxYear).
 				Order("num_rating desc").
@@ -187,7 +209,7 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 		var extraMovies []*model.Movie
 		if len(movies) < 301 {
 			diff := 301 - len(movies) + 200
-			if err := db.Limit(diff).
+			if err := filter.Apply(db).Limit(diff).
 				Where("year >= ? and year <= ?", minYear, maxYear).
 				Order("num_rating desc").
 				Find(&extraMovies).Error; err != nil {
@@ -209,10 +231,14 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 			uniqueMovies = append(uniqueMovies, k)
 		}
 
+		// A narrow filter may leave fewer than ten candidates, every candidate is drawn at most once.
 		tempRecommendations := make([]*model.Movie, 0, 10)
 		rand.Seed(time.Now().UTC().UnixNano())
-		for len(tempRecommendations) != 10 {
-			j := rand.Intn(len(uniqueMovies) - 1)
+		for _, j := range rand.Perm(len(uniqueMovies)) {
+			if len(tempRecommendations) == 10 {
+				break
+			}
+
 			id := uniqueMovies[j].ID
 			if _, ok := movieRatings[id]; ok {
 				continue
@@ -235,6 +261,8 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 			}
 		}
 
+		filter.SortMovies(recommendations)
+
 		if bytes, err := json.Marshal(recommendations); err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
 		} else {
@@ -244,14 +272,48 @@ func NewMovieRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 	}
 }
 
+// RecommendationRequestPayload asks for a page of personalized recommendations. Without exploration the same request
+// always returns the same page. With exploration, requests that share a seed see the same ordering, which keeps pages
+// consistent; a zero seed picks a new ordering on every request. Epsilon and temperature are pointers so that an
+// explicit zero, which turns epsilon greedy exploration off, is told apart from a missing value.
 type RecommendationRequestPayload struct {
-	MaxYear    uint   `json:"max"`
-	MinYear    uint   `json:"min"`
-	Percentile uint   `json:"percent"`
-	Skipped    []uint `json:"skipped"`
+	MaxYear     uint     `json:"max"`
+	MinYear     uint     `json:"min"`
+	Percentile  uint     `json:"percent"`
+	Skipped     []uint   `json:"skipped"`
+	Limit       int      `json:"limit"`
+	Offset      int      `json:"offset"`
+	Exploration string   `json:"exploration"`
+	Epsilon     *float64 `json:"epsilon"`
+	Temperature *float64 `json:"temperature"`
+	Seed        int64    `json:"seed"`
+
+	// Mode is latent by default, which ranks by predicted rating alone. Content ranks by the genres and tags of the
+	// movies the user rated, and hybrid blends the two with ContentWeight given to content. ContentWeight is a pointer
+	// so that an explicit weight of zero is told apart from a missing weight.
+	Mode          string   `json:"mode"`
+	ContentWeight *float64 `json:"content_weight"`
+
+	MovieFilter
 }
 
-func NewPersonalizedRecommendationHandler(db *gorm.DB) http.HandlerFunc {
+// Page size of personalized recommendations. Offset plus limit is capped by PersonalizedMaxRank, ranking deeper than
+// that is not worth the retrieval cost.
+const (
+	PersonalizedDefaultLimit = 10
+	PersonalizedMaxLimit     = 100
+	PersonalizedMaxRank      = 1000
+)
+
+// PersonalizedExplorationSize is the number of extra movies below the requested page that exploration may promote, and
+// PersonalizedMinNumRating keeps obscure movies with unreliable features out of recommendations.
+const (
+	PersonalizedExplorationSize = 100
+	PersonalizedMinNumRating    = 20
+)
+
+func NewPersonalizedRecommendationHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue,
+	movieIndex *ann.Live, contentIndex *content.Live) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 
@@ -271,6 +333,61 @@ func NewPersonalizedRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 			minYear = payload.MinYear
 		}
 
+		limit := payload.Limit
+		if limit == 0 {
+			limit = PersonalizedDefaultLimit
+		}
+
+		if limit < 0 || limit > PersonalizedMaxLimit {
+			RenderError(w, "limit must be between 1 and "+strconv.Itoa(PersonalizedMaxLimit), http.StatusBadRequest)
+			return
+		}
+
+		if payload.Offset < 0 || payload.Offset+limit > PersonalizedMaxRank {
+			RenderError(w, "offset plus limit must not exceed "+strconv.Itoa(PersonalizedMaxRank), http.StatusBadRequest)
+			return
+		}
+
+		epsilon, temperature := DefaultEpsilon, DefaultTemperature
+		if payload.Epsilon != nil {
+			epsilon = *payload.Epsilon
+		}
+
+		if payload.Temperature != nil {
+			temperature = *payload.Temperature
+		}
+
+		explore, err := NewExplorer(payload.Exploration, epsilon, temperature)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mode := payload.Mode
+		if mode == "" {
+			mode = ModeLatent
+		}
+
+		if mode != ModeLatent && mode != ModeContent && mode != ModeHybrid {
+			RenderError(w, "unknown recommendation mode "+mode, http.StatusBadRequest)
+			return
+		}
+
+		if err := payload.MovieFilter.validate(); err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		contentWeight := DefaultContentWeight
+		if payload.ContentWeight != nil {
+			contentWeight = *payload.ContentWeight
+		}
+
+		if contentWeight < 0 || contentWeight > 1 {
+			RenderError(w, "content weight must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
 		// Find current user and get his/her ratings
 		vars := mux.Vars(r)
 		var currentUser model.User
@@ -295,92 +412,408 @@ func NewPersonalizedRecommendationHandler(db *gorm.DB) http.HandlerFunc {
 			skipped[movieID] = true
 		}
 
-		// Count how many movies there are in the database
-		var movieCount int
-		if err := db.Model(&model.Movie{}).Count(&movieCount).Error; err != nil {
+		// Skips are implicit feedback, users who rarely rate can still be given a personalized model from them.
+		if count, err := recordSkips(db, currentUser.ID, payload.Skipped); err != nil {
+			logrus.WithField("src", "handler.recommend").Error("failed to record skipped movies", err)
+		} else if count > 0 {
+			enqueuePreferenceUpdate(preferenceQueue, currentUser.ID)
+		}
+
+		accept := func(movieID uint) bool {
+			return !rated[movieID] && !skipped[movieID]
+		}
+
+		rankSize := payload.Offset + limit
+		if payload.Exploration != "" && payload.Exploration != ExploreNone {
+			rankSize += PersonalizedExplorationSize
+		}
+
+		minNumRating, err := popularityThreshold(db, payload.Percentile, minYear, maxYear)
+		if err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		var percentage float64
-		switch payload.Percentile {
-		case 100:
-			// Give user the top 1% of most rated movies
-			percentage = 0.01
-		case 80:
-			// Giver user the top 20% of most rated movies
-			percentage = 0.2
-		case 60:
-			// Give user the top 40% of the most rated movies
-			percentage = 0.4
-		case 40:
-			// Give user the top 60% of the most rated movies
-			percentage = 0.6
-		case 20:
-			// Give user the top 80% of the most rated movies
-			percentage = 0.8
-		default:
-			percentage = 1.0
+		var ranked []*ScoredMovie
+		if mode == ModeLatent {
+			// K represents the feature dimension
+			K := len(currentUser.Preference)
+			if K == 0 {
+				RenderError(w, "user has no latent preference yet, answer the onboarding questions first",
+					http.StatusConflict)
+				return
+			}
+
+			// Hold on to one index for the whole request, the watcher may swap in a new one at any time.
+			index := movieIndex.Index()
+			if index == nil {
+				RenderError(w, "movie index is not ready yet", http.StatusServiceUnavailable)
+				return
+			}
+
+			// Movie vectors in the index carry their bias as an extra dimension. A preference that does not fit was
+			// learned against a previous model, it is being recomputed.
+			if index.Dim() != K+1 {
+				enqueuePreferenceUpdate(preferenceQueue, currentUser.ID)
+				RenderError(w, "user preference is being updated for a new model", http.StatusServiceUnavailable)
+				return
+			}
+
+			if minNumRating < PersonalizedMinNumRating {
+				minNumRating = PersonalizedMinNumRating
+			}
+
+			query := make([]float64, K+1)
+			copy(query, currentUser.Preference)
+			query[K] = 1
+
+			ranked, err = rankCandidates(db, index, query, rankSize, accept, minYear, maxYear, minNumRating,
+				payload.MovieFilter)
+			if err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			for _, movie := range ranked {
+				movie.PredictedRating += currentUser.Bias
+				movie.Score = movie.PredictedRating
+			}
+		} else {
+			index := contentIndex.Index()
+			if index == nil || index.Len() == 0 {
+				RenderError(w, "content index is not ready yet", http.StatusServiceUnavailable)
+				return
+			}
+
+			if mode == ModeContent {
+				contentWeight = 1
+			}
+
+			ranked, err = rankByContent(db, index, movieIndex.Index(), &currentUser, contentWeight, rankSize, accept,
+				minYear, maxYear, minNumRating, payload.MovieFilter)
+			if err == errNoContentProfile {
+				RenderError(w, err.Error(), http.StatusBadRequest)
+				return
+			} else if err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 
-		limit := int(float64(movieCount) * percentage)
+		seed := payload.Seed
+		if seed == 0 {
+			seed = time.Now().UTC().UnixNano()
+		}
+
+		ranked = explore(ranked, rand.New(rand.NewSource(seed)))
+
+		recommendations := []*ScoredMovie{}
+		if payload.Offset < len(ranked) {
+			end := payload.Offset + limit
+			if end > len(ranked) {
+				end = len(ranked)
+			}
+
+			recommendations = ranked[payload.Offset:end]
+		}
+
+		payload.MovieFilter.SortScoredMovies(recommendations)
+
+		if bytes, err := json.Marshal(recommendations); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// rankCandidates returns up to n movies with the highest predicted rating, less the user bias, in descending order.
+// Year, popularity and the movie filter live in the database rather than the index, so the best matches are fetched in
+// growing batches until enough of them pass those filters or the index is exhausted.
+func rankCandidates(db *gorm.DB, index *ann.Index, query []float64, n int, accept func(uint) bool,
+	minYear, maxYear uint, minNumRating int, filter MovieFilter) ([]*ScoredMovie, error) {
+	ranked := make([]*ScoredMovie, 0, n)
+	for fetchSize := n; len(ranked) < n; fetchSize *= 4 {
+		results, err := index.Search(query, fetchSize, accept)
+		if err != nil {
+			return nil, err
+		}
+
+		movieIDs := make([]uint, 0, len(results))
+		for _, result := range results {
+			movieIDs = append(movieIDs, result.ID)
+		}
 
 		var movies []*model.Movie
-		if err := db.Limit(limit).
+		if err := filter.Apply(db).Where("id in (?)", movieIDs).
 			Where("year >= ? and year <= ?", minYear, maxYear).
-			Order("num_rating desc").
+			Where("num_rating >= ?", minNumRating).
 			Find(&movies).Error; err != nil {
-			RenderError(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 
-		M := 0
-		movieFeatureData := make([]float64, 0, len(movies))
+		movieMapByID := make(map[uint]*model.Movie)
 		for _, movie := range movies {
-			// Notice that not all movies have a feature vector, some movies were not even rated by any user. The
-			// matrix factorization algorithm ignored those movies.
-			if len(movie.Feature) > 0 {
-				movieFeatureData = append(movieFeatureData, movie.Feature...)
-				M += 1
+			movieMapByID[movie.ID] = movie
+		}
+
+		ranked = ranked[:0]
+		for _, result := range results {
+			if movie, ok := movieMapByID[result.ID]; ok && len(ranked) < n {
+				ranked = append(ranked, &ScoredMovie{Movie: movie, PredictedRating: result.Score})
+			}
+		}
+
+		if len(results) < fetchSize || fetchSize >= index.Len() {
+			break
+		}
+	}
+
+	return ranked, nil
+}
+
+type GroupRecommendationRequestPayload struct {
+	MaxYear    uint   `json:"max"`
+	MinYear    uint   `json:"min"`
+	Percentile uint   `json:"percent"`
+	Skipped    []uint `json:"skipped"`
+	Strategy   string `json:"strategy"`
+
+	// FairnessWeight is a pointer so that an explicit weight of zero is told apart from a missing weight.
+	FairnessWeight *float64 `json:"fairness_weight"`
+}
+
+type MemberPrediction struct {
+	UserID          uint    `json:"user_id"`
+	Username        string  `json:"username"`
+	PredictedRating float64 `json:"predicted_rating"`
+}
+
+// GroupRecommendation embeds the movie so that the JSON keeps the same shape as the other recommendation endpoints, with
+// the group score and each member's predicted rating attached.
+type GroupRecommendation struct {
+	*model.Movie
+	Score         float64            `json:"score"`
+	MemberRatings []MemberPrediction `json:"member_ratings"`
+}
+
+type GroupRecommendationResponse struct {
+	GroupID         uint                   `json:"group_id"`
+	Strategy        string                 `json:"strategy"`
+	Recommendations []*GroupRecommendation `json:"recommendations"`
+
+	// Members who have not rated enough movies to have a latent preference are left out of the aggregation.
+	MembersWithoutPreference []uint `json:"members_without_preference"`
+}
+
+const GroupRecommendationCount = 10
+
+// servedFeatureDim returns the dimension of the latent features of the served model, which every movie with features
+// shares because a model is activated in one transaction. It is zero when no movie has features.
+func servedFeatureDim(db *gorm.DB) (int, error) {
+	var movies []*model.Movie
+	if err := db.Select("feature").Where("array_length(feature, 1) > 0").Limit(1).Find(&movies).Error; err != nil {
+		return 0, err
+	}
+
+	if len(movies) == 0 {
+		return 0, nil
+	}
+
+	return len(movies[0].Feature), nil
+}
+
+func NewGroupRecommendationHandler(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+
+		var payload GroupRecommendationRequestPayload
+		if err := decoder.Decode(&payload); err != nil {
+			RenderError(w, "failed to parse request JSON into struct", http.StatusInternalServerError)
+			return
+		}
+
+		if payload.Strategy == "" {
+			payload.Strategy = AggregateAverage
+		}
+
+		fairnessWeight := DefaultFairnessWeight
+		if payload.FairnessWeight != nil {
+			fairnessWeight = *payload.FairnessWeight
+		}
+
+		aggregate, err := NewAggregator(payload.Strategy, fairnessWeight)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var maxYear uint = 2018
+		var minYear uint = 1930
+		if payload.MaxYear != 0 {
+			maxYear = payload.MaxYear
+		}
+
+		if payload.MinYear != 0 {
+			minYear = payload.MinYear
+		}
+
+		vars := mux.Vars(r)
+		var group model.Group
+		if err := db.Where("id = ?", vars["id"]).
+			Preload("Members").
+			Preload("Members.Ratings").
+			First(&group).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "group does not exist", http.StatusNotFound)
+				return
 			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if !canViewGroup(CurrentUser(r), &group) {
+			RenderError(w, "only members may get recommendations for a group", http.StatusForbidden)
+			return
 		}
 
 		// K represents the feature dimension
-		K := len(currentUser.Preference)
-		userMat := mat.NewDense(1, K, currentUser.Preference)
-		movieMat := mat.NewDense(M, K, movieFeatureData)
+		K, err := servedFeatureDim(db)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		if K == 0 {
-			RenderError(w, "user has nil vector for latent preference", http.StatusInternalServerError)
+			RenderError(w, "no movies have latent features", http.StatusInternalServerError)
 			return
 		}
 
-		predictedRatings := mat.NewDense(1, M, nil)
-		predictedRatings.Mul(userMat, movieMat.T())
+		// Only members with a latent preference can be scored. Movies that any member has already rated are excluded
+		// because somebody in the party has seen it. A preference that does not fit the movie features was learned
+		// against a previous model, it is being recomputed.
+		members := make([]model.User, 0, len(group.Members))
+		membersWithoutPreference := []uint{}
+		staleMemberIDs := []uint{}
+		rated := map[uint]bool{}
+		for _, member := range group.Members {
+			for _, rating := range member.Ratings {
+				rated[rating.MovieID] = true
+			}
 
-		// Fetch 10 recommendations randomly
-		rand.Seed(time.Now().UTC().UnixNano())
-		recommendations := make([]*model.Movie, 0, 10)
-		for len(recommendations) != 10 {
-			j := rand.Intn(len(movies) - 1)
-			if rated[movies[j].ID] {
+			if len(member.Preference) == 0 {
+				membersWithoutPreference = append(membersWithoutPreference, member.ID)
 				continue
 			}
 
-			if skipped[movies[j].ID] {
+			if len(member.Preference) != K {
+				staleMemberIDs = append(staleMemberIDs, member.ID)
 				continue
 			}
 
-			if predictedRatings.At(0, j) < 3.0 {
+			members = append(members, member)
+		}
+
+		if len(staleMemberIDs) > 0 {
+			for _, memberID := range staleMemberIDs {
+				enqueuePreferenceUpdate(preferenceQueue, memberID)
+			}
+
+			RenderError(w, "preferences of group members are being updated for a new model",
+				http.StatusServiceUnavailable)
+			return
+		}
+
+		if len(members) == 0 {
+			RenderError(w, "none of the group members has a latent preference", http.StatusBadRequest)
+			return
+		}
+
+		skipped := map[uint]bool{}
+		for _, movieID := range payload.Skipped {
+			skipped[movieID] = true
+		}
+
+		var movieCount int
+		if err := db.Model(&model.Movie{}).Count(&movieCount).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		limit := int(float64(movieCount) * popularityFraction(payload.Percentile))
+
+		var movies []*model.Movie
+		if err := db.Limit(limit).
+			Where("year >= ? and year <= ?", minYear, maxYear).
+			Order("num_rating desc").
+			Find(&movies).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		candidates := make([]*model.Movie, 0, len(movies))
+		movieFeatureData := make([]float64, 0, len(movies)*K)
+		for _, movie := range movies {
+			if rated[movie.ID] || skipped[movie.ID] || len(movie.Feature) != K {
 				continue
 			}
 
-			if movies[j].Year >= minYear && movies[j].Year <= maxYear && movies[j].NumRating >= 20 {
-				recommendations = append(recommendations, movies[j])
+			candidates = append(candidates, movie)
+			movieFeatureData = append(movieFeatureData, movie.Feature...)
+		}
+
+		res := &GroupRecommendationResponse{
+			GroupID:                  group.ID,
+			Strategy:                 payload.Strategy,
+			Recommendations:          []*GroupRecommendation{},
+			MembersWithoutPreference: membersWithoutPreference,
+		}
+
+		if len(candidates) > 0 {
+			preferenceData := make([]float64, 0, len(members)*K)
+			for _, member := range members {
+				preferenceData = append(preferenceData, member.Preference...)
+			}
+
+			// Predicted ratings is a (N, M) matrix where N is the number of scored members and M is the number of
+			// candidate movies.
+			preferenceMat := mat.NewDense(len(members), K, preferenceData)
+			movieMat := mat.NewDense(len(candidates), K, movieFeatureData)
+			predictedRatings := mat.NewDense(len(members), len(candidates), nil)
+			predictedRatings.Mul(preferenceMat, movieMat.T())
+			addBiases(predictedRatings, members, candidates)
+
+			for j, movie := range candidates {
+				memberRatings := make([]MemberPrediction, 0, len(members))
+				ratings := make([]float64, 0, len(members))
+				for i, member := range members {
+					ratings = append(ratings, predictedRatings.At(i, j))
+					memberRatings = append(memberRatings, MemberPrediction{
+						UserID:          member.ID,
+						Username:        member.Username,
+						PredictedRating: predictedRatings.At(i, j),
+					})
+				}
+
+				res.Recommendations = append(res.Recommendations, &GroupRecommendation{
+					Movie:         movie,
+					Score:         aggregate(ratings),
+					MemberRatings: memberRatings,
+				})
+			}
+
+			// Candidates are already ordered by popularity, a stable sort keeps the more popular movie on ties.
+			sort.SliceStable(res.Recommendations, func(i, j int) bool {
+				return res.Recommendations[i].Score > res.Recommendations[j].Score
+			})
+
+			if len(res.Recommendations) > GroupRecommendationCount {
+				res.Recommendations = res.Recommendations[:GroupRecommendationCount]
 			}
 		}
 
-		if bytes, err := json.Marshal(recommendations); err != nil {
+		if bytes, err := json.Marshal(res); err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
 		} else {
 			w.WriteHeader(http.StatusOK)
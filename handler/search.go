@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"encoding/json"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"popcorn/model"
+	"popcorn/search"
+	"strconv"
+	"strings"
+)
+
+// Number of search results returned when the request does not ask for a limit, and the most it may ask for.
+const (
+	SearchDefaultLimit = 10
+	SearchMaxLimit     = 50
+)
+
+// MovieSearchResult is a matching movie with its title as it reads, with the article MovieLens moved to the end put
+// back in front, and its relevance score.
+type MovieSearchResult struct {
+	*model.Movie
+	DisplayTitle string  `json:"display_title"`
+	Score        float64 `json:"score"`
+}
+
+// NewMovieSearchHandler searches movie titles for the q query parameter, tolerating typos and completing the last word
+// so it can back a search box that updates while typing. Results are ordered by how well they match, with the more
+// rated movies first among equal matches.
+func NewMovieSearchHandler(db *gorm.DB, searchIndex *search.Live) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			RenderError(w, "query parameter q is required", http.StatusBadRequest)
+			return
+		}
+
+		limit := SearchDefaultLimit
+		if param := r.URL.Query().Get("limit"); param != "" {
+			var err error
+			if limit, err = strconv.Atoi(param); err != nil || limit < 1 || limit > SearchMaxLimit {
+				RenderError(w, "limit must be between 1 and 50", http.StatusBadRequest)
+				return
+			}
+		}
+
+		index := searchIndex.Index()
+		if index == nil {
+			RenderError(w, "search index is not ready yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		matches := index.Search(query, limit)
+		movieIDs := make([]uint, 0, len(matches))
+		for _, match := range matches {
+			movieIDs = append(movieIDs, match.ID)
+		}
+
+		results := []*MovieSearchResult{}
+		if len(movieIDs) > 0 {
+			var movies []*model.Movie
+			if err := db.Where("id in (?)", movieIDs).Find(&movies).Error; err != nil {
+				RenderError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			movieMap := make(map[uint]*model.Movie)
+			for _, movie := range movies {
+				movieMap[movie.ID] = movie
+			}
+
+			// The index may be a little behind the movies table, movies deleted since it was built are left out.
+			for _, match := range matches {
+				if movie, ok := movieMap[match.ID]; ok {
+					results = append(results, &MovieSearchResult{
+						Movie:        movie,
+						DisplayTitle: search.DisplayTitle(movie.Title),
+						Score:        match.Score,
+					})
+				}
+			}
+		}
+
+		if bytes, err := json.Marshal(results); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
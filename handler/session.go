@@ -1,33 +1,45 @@
 // Copyright (c) 2018 Popcorn
-// Author(s) Carmen To
+// Author(s) Carmen To, Calvin Feng
 
 package handler
 
 import (
 	"encoding/json"
+	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"net"
 	"net/http"
+	"popcorn/model"
+	"strings"
 	"time"
 )
 
+// SessionCookieName is the cookie that carries the session token of a device.
+const SessionCookieName = "session_token"
+
+// A session expires after SessionIdleTimeout without requests, or SessionMaxLifetime after sign in. Every request
+// pushes the idle expiry back, but at most once per SessionTouchInterval so that not every request writes to the
+// database.
+const (
+	SessionIdleTimeout   = 2 * 24 * time.Hour
+	SessionMaxLifetime   = 30 * 24 * time.Hour
+	SessionTouchInterval = 5 * time.Minute
+)
+
 func NewTokenAuthenticateHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, _ := r.Cookie("session_token")
-		if cookie == nil {
-			RenderError(w, "cookie does not exist", http.StatusUnauthorized)
+		currentUser := CurrentUser(r)
+		if currentUser == nil {
+			RenderError(w, "session does not exist or has expired", http.StatusUnauthorized)
 			return
 		}
 
-		if currentUser, err := FindUserByToken(db, cookie.Value); err == nil {
-			if bytes, err := json.Marshal(currentUser); err != nil {
-				RenderError(w, err.Error(), http.StatusInternalServerError)
-				return
-			} else {
-				w.WriteHeader(http.StatusOK)
-				w.Write(bytes)
-			}
+		if bytes, err := json.Marshal(currentUser); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
 		} else {
-			RenderError(w, err.Error(), http.StatusUnauthorized)
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
 		}
 	}
 }
@@ -47,15 +59,17 @@ func NewSessionCreateHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		user, err := FindUserByCredential(db, reqData.Username, reqData.Password)
+		// Locked out sign ins get the same answer as wrong passwords, so that it cannot be told which usernames exist.
+		user, err := FindUserByCredential(db, reqData.Username, reqData.Password, ClientIP(r))
 		if err != nil {
 			RenderError(w, "Incorrect username/password combination", http.StatusUnauthorized)
 			return
 		}
 
-		expiration := time.Now().Add(2 * 24 * time.Hour)
-		cookie := http.Cookie{Name: "session_token", Value: user.SessionToken, Expires: expiration}
-		http.SetCookie(w, &cookie)
+		if err := startSession(db, w, r, user); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		if bytes, err := json.Marshal(user); err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
@@ -71,23 +85,237 @@ type LogoutResponse struct {
 	Username string `json:"username"`
 }
 
+// NewSessionDestroyHandler signs out the device of the request, the other devices of the user stay signed in.
 func NewSessionDestroyHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, _ := r.Cookie("session_token")
-		if currentUser, err := FindUserByToken(db, cookie.Value); err == nil {
-			currentUser.ResetSessionToken()
-			db.Save(currentUser)
-
-			res := &LogoutResponse{currentUser.Username}
-
-			if bytes, err := json.Marshal(res); err != nil {
-				RenderError(w, err.Error(), http.StatusInternalServerError)
-			} else {
-				w.WriteHeader(http.StatusOK)
-				w.Write(bytes)
-			}
-		} else {
+		session := CurrentSession(r)
+		if session == nil {
 			RenderError(w, "User is not found", http.StatusBadRequest)
+			return
+		}
+
+		if err := revokeSessions(db.Where("id = ?", session.ID)); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		clearSessionCookie(w, r)
+
+		res := &LogoutResponse{session.User.Username}
+		if bytes, err := json.Marshal(res); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// SessionResponse is an active session of the current user, Current marks the device of the request.
+type SessionResponse struct {
+	*model.Session
+	Current bool `json:"current"`
+}
+
+// NewSessionListHandler lists the devices that the current user is signed in on, most recently used first.
+func NewSessionListHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := CurrentSession(r)
+
+		var sessions []*model.Session
+		if err := db.Where("user_id = ? and revoked_at is null and expires_at > ?", current.UserID, time.Now()).
+			Order("last_seen_at desc").
+			Find(&sessions).Error; err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res := make([]*SessionResponse, 0, len(sessions))
+		for _, session := range sessions {
+			res = append(res, &SessionResponse{Session: session, Current: session.ID == current.ID})
+		}
+
+		if bytes, err := json.Marshal(res); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// NewSessionRevokeHandler signs out one device of the current user.
+func NewSessionRevokeHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := CurrentSession(r)
+		vars := mux.Vars(r)
+
+		var session model.Session
+		if err := db.Where("id = ? and user_id = ?", vars["id"], current.UserID).First(&session).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "session does not exist", http.StatusNotFound)
+				return
+			}
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := revokeSessions(db.Where("id = ?", session.ID)); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if session.ID == current.ID {
+			clearSessionCookie(w, r)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewSessionRevokeAllHandler signs out every device of the current user, including the device of the request.
+func NewSessionRevokeAllHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := revokeSessions(db.Where("user_id = ?", CurrentSession(r).UserID)); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		clearSessionCookie(w, r)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// FindSessionByToken returns the active session with the token, with its user loaded.
+func FindSessionByToken(db *gorm.DB, token string) (*model.Session, error) {
+	var session model.Session
+	err := db.Where("token_digest = ? and revoked_at is null and expires_at > ?", model.HashToken(token), time.Now()).
+		Preload("User").
+		First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// ResumeSession returns the active session of the cookie attached to the request, or nil when the request is not
+// authenticated. The expiry of the session is pushed back, and so is the expiry of its cookie.
+func ResumeSession(db *gorm.DB, w http.ResponseWriter, r *http.Request) *model.Session {
+	cookie, _ := r.Cookie(SessionCookieName)
+	if cookie == nil {
+		return nil
+	}
+
+	session, err := FindSessionByToken(db, cookie.Value)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < SessionTouchInterval {
+		return session
+	}
+
+	expiresAt := now.Add(SessionIdleTimeout)
+	if maxExpiresAt := session.CreatedAt.Add(SessionMaxLifetime); expiresAt.After(maxExpiresAt) {
+		expiresAt = maxExpiresAt
+	}
+
+	err = db.Model(session).UpdateColumns(map[string]interface{}{"last_seen_at": now, "expires_at": expiresAt}).Error
+	if err != nil {
+		logrus.WithField("src", "handler.session").Error("failed to extend session", err)
+		return session
+	}
+
+	setSessionCookie(w, r, cookie.Value, expiresAt)
+
+	return session
+}
+
+// startSession signs the user in on the device of the request, sessions of the user that have expired or were revoked
+// are cleaned up on the way.
+func startSession(db *gorm.DB, w http.ResponseWriter, r *http.Request, user *model.User) error {
+	now := time.Now()
+	if err := db.Where("user_id = ? and (revoked_at is not null or expires_at <= ?)", user.ID, now).
+		Delete(&model.Session{}).Error; err != nil {
+		return err
+	}
+
+	token, err := model.GenerateRandomString(32)
+	if err != nil {
+		return err
+	}
+
+	session := &model.Session{
+		UserID:      user.ID,
+		TokenDigest: model.HashToken(token),
+		UserAgent:   truncate(r.UserAgent(), 500),
+		IPAddress:   truncate(ClientIP(r), 100),
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(SessionIdleTimeout),
+	}
+
+	if err := db.Create(session).Error; err != nil {
+		return err
+	}
+
+	setSessionCookie(w, r, token, session.ExpiresAt)
+
+	return nil
+}
+
+func revokeSessions(query *gorm.DB) error {
+	return query.Model(&model.Session{}).Where("revoked_at is null").Update("revoked_at", time.Now()).Error
+}
+
+// setSessionCookie keeps the token away from scripts, and from plain HTTP when the site is served over HTTPS, which
+// Heroku reports with X-Forwarded-Proto. http.Cookie has no SameSite attribute before Go 1.11, so it is appended to
+// the header by hand.
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, expiresAt time.Time) {
+	cookie := &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+	}
+
+	w.Header().Add("Set-Cookie", cookie.String()+"; SameSite=Lax")
+}
+
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	setSessionCookie(w, r, "", time.Unix(0, 0))
+}
+
+// TrustedProxyHops is the number of proxies in front of the server that append the address they were connected from
+// to X-Forwarded-For, e.g. 1 behind the Heroku router. With none the header is ignored, since any client could set it.
+var TrustedProxyHops = 0
+
+// ClientIP returns the address of the client. Each trusted proxy appends the address it was connected from to whatever
+// X-Forwarded-For the client sent, so the client is the address that the outermost trusted proxy appended and earlier
+// addresses may be forged. Without trusted proxies, or when the header is shorter than the trusted hops, it is the
+// address of the connection.
+func ClientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); TrustedProxyHops > 0 && forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		if len(addresses) >= TrustedProxyHops {
+			return strings.TrimSpace(addresses[len(addresses)-TrustedProxyHops])
 		}
 	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
+
+func truncate(text string, length int) string {
+	if len(text) > length {
+		return text[:length]
+	}
+
+	return text
 }
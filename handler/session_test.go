@@ -0,0 +1,41 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	defer func(hops int) { TrustedProxyHops = hops }(TrustedProxyHops)
+
+	tests := []struct {
+		hops      int
+		forwarded string
+		expected  string
+	}{
+		{0, "", "192.0.2.1"},
+		{0, "203.0.113.9", "192.0.2.1"},
+		{1, "", "192.0.2.1"},
+		{1, "203.0.113.9", "203.0.113.9"},
+		{1, "198.51.100.7, 203.0.113.9", "203.0.113.9"},
+		{2, "198.51.100.7, 203.0.113.9, 10.0.0.2", "203.0.113.9"},
+		{2, "203.0.113.9", "192.0.2.1"},
+	}
+
+	for _, test := range tests {
+		TrustedProxyHops = test.hops
+
+		r := httptest.NewRequest("GET", "/api/movies", nil)
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		if actual := ClientIP(r); actual != test.expected {
+			t.Errorf("ClientIP with %d hops and X-Forwarded-For %q = %s, expected %s", test.hops, test.forwarded,
+				actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"math"
+	"net/http"
+	"net/url"
+	"popcorn/ann"
+	"popcorn/lowrank"
+	"popcorn/model"
+	"popcorn/search"
+	"strconv"
+	"strings"
+)
+
+// Restrictions of similar movies to the k-means clusters of the movie they are similar to. Near allows the cluster of
+// the movie and its nearest clusters.
+const (
+	ClusterAny  = "any"
+	ClusterSame = "same"
+	ClusterNear = "near"
+)
+
+// Number of similar movies returned when the request does not ask for a limit, and the most it may ask for. At most
+// SimilarMaxSharedTags shared tags are named in an explanation.
+const (
+	SimilarDefaultLimit  = 10
+	SimilarMaxLimit      = 50
+	SimilarMaxSharedTags = 3
+)
+
+// SimilarMovie embeds the movie so that the JSON keeps the same shape as the other movie lists, with the cosine
+// similarity of its latent feature to the feature of the requested movie, the genres and tags they share, and an
+// explanation of the similarity that can be shown to users.
+type SimilarMovie struct {
+	*model.Movie
+	Similarity   float64  `json:"similarity"`
+	SharedGenres []string `json:"shared_genres"`
+	SharedTags   []string `json:"shared_tags"`
+	Explanation  string   `json:"explanation"`
+}
+
+// NewSimilarMovieListHandler lists the movies whose latent features are the most similar to those of a movie, i.e.
+// the movies that the same people liked and disliked. It takes the year and popularity parameters of recommendations,
+// min, max and percent, the movie filter parameters, and cluster to keep to the same or nearby k-means clusters.
+func NewSimilarMovieListHandler(db *gorm.DB, similarityIndex *ann.Live) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter, err := parseMovieFilter(query)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit, err := parseUintParam(query, "limit", SimilarDefaultLimit)
+		if err != nil || limit < 1 || limit > SimilarMaxLimit {
+			RenderError(w, "limit must be between 1 and "+strconv.Itoa(SimilarMaxLimit), http.StatusBadRequest)
+			return
+		}
+
+		minYear, err := parseUintParam(query, "min", 1930)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		maxYear, err := parseUintParam(query, "max", 2018)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		percentile, err := parseUintParam(query, "percent", 0)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cluster := query.Get("cluster")
+		if cluster == "" {
+			cluster = ClusterAny
+		}
+
+		if cluster != ClusterAny && cluster != ClusterSame && cluster != ClusterNear {
+			RenderError(w, "cluster must be any, same or near", http.StatusBadRequest)
+			return
+		}
+
+		var movie model.Movie
+		if err := db.Where("id = ?", mux.Vars(r)["id"]).First(&movie).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				RenderError(w, "movie does not exist", http.StatusNotFound)
+				return
+			}
+
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Hold on to one index for the whole request, the watcher may swap in a new one at any time.
+		index := similarityIndex.Index()
+		if index == nil {
+			RenderError(w, "similarity index is not ready yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		squaredNorm, _ := lowrank.DotProduct(movie.Feature, movie.Feature)
+		norm := math.Sqrt(squaredNorm)
+		if len(movie.Feature) != index.Dim() || norm == 0 {
+			RenderError(w, "movie has no latent feature to compare with", http.StatusBadRequest)
+			return
+		}
+
+		featureQuery := make([]float64, len(movie.Feature))
+		for i, value := range movie.Feature {
+			featureQuery[i] = value / norm
+		}
+
+		minNumRating, err := popularityThreshold(db, uint(percentile), uint(minYear), uint(maxYear))
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Features of movies that only a few people rated are mostly noise, they look similar to anything.
+		if minNumRating < PersonalizedMinNumRating {
+			minNumRating = PersonalizedMinNumRating
+		}
+
+		nearClusters := map[string]bool{strconv.Itoa(int(movie.ClusterID)): true}
+		for _, clusterID := range movie.NearestClusters {
+			nearClusters[clusterID] = true
+		}
+
+		scope := db
+		switch cluster {
+		case ClusterSame:
+			scope = db.Where("cluster_id = ?", movie.ClusterID)
+		case ClusterNear:
+			clusterIDs := make([]string, 0, len(nearClusters))
+			for clusterID := range nearClusters {
+				clusterIDs = append(clusterIDs, clusterID)
+			}
+
+			scope = db.Where("cluster_id in (?)", clusterIDs)
+		}
+
+		accept := func(movieID uint) bool {
+			return movieID != movie.ID
+		}
+
+		// The inner product of unit vectors is their cosine similarity, it is what the ranked movies are scored by.
+		ranked, err := rankCandidates(scope, index, featureQuery, limit, accept, uint(minYear), uint(maxYear),
+			minNumRating, filter)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		filter.SortScoredMovies(ranked)
+
+		similarMovies := make([]*SimilarMovie, 0, len(ranked))
+		for _, candidate := range ranked {
+			similar := &SimilarMovie{
+				Movie:        candidate.Movie,
+				Similarity:   candidate.PredictedRating,
+				SharedGenres: intersect(movie.Genres, candidate.Genres, len(candidate.Genres)),
+				SharedTags:   intersect(movie.Tags, candidate.Tags, SimilarMaxSharedTags),
+			}
+
+			similar.Explanation = explainSimilarity(&movie, similar, nearClusters)
+			similarMovies = append(similarMovies, similar)
+		}
+
+		if bytes, err := json.Marshal(similarMovies); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusOK)
+			w.Write(bytes)
+		}
+	}
+}
+
+// explainSimilarity says in a sentence why a movie is similar: the share of taste it has in common with the requested
+// movie, whether it belongs to the same or a nearby cluster, and the genres and tags they share.
+func explainSimilarity(movie *model.Movie, similar *SimilarMovie, nearClusters map[string]bool) string {
+	title := search.DisplayTitle(movie.Title)
+	reasons := []string{
+		fmt.Sprintf("Liked and disliked by the same people as %s (%.0f%% taste similarity)", title, 100*similar.Similarity),
+	}
+
+	if similar.ClusterID == movie.ClusterID {
+		reasons = append(reasons, "in the same taste cluster")
+	} else if nearClusters[strconv.Itoa(int(similar.ClusterID))] {
+		reasons = append(reasons, "in a nearby taste cluster")
+	}
+
+	if len(similar.SharedGenres) > 0 {
+		reasons = append(reasons, "both "+joinWithAnd(similar.SharedGenres))
+	}
+
+	if len(similar.SharedTags) > 0 {
+		quoted := make([]string, 0, len(similar.SharedTags))
+		for _, tag := range similar.SharedTags {
+			quoted = append(quoted, strconv.Quote(tag))
+		}
+
+		reasons = append(reasons, "both tagged "+joinWithAnd(quoted))
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+// intersect returns up to n values of b that are also in a, in the order of b. Values are compared case insensitively
+// because tags are free text.
+func intersect(a, b []string, n int) []string {
+	set := make(map[string]bool)
+	for _, value := range a {
+		set[strings.ToLower(value)] = true
+	}
+
+	shared := []string{}
+	for _, value := range b {
+		if set[strings.ToLower(value)] && len(shared) < n {
+			shared = append(shared, value)
+		}
+	}
+
+	return shared
+}
+
+func joinWithAnd(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+
+	return strings.Join(values[:len(values)-1], ", ") + " and " + values[len(values)-1]
+}
+
+// parseUintParam reads a non-negative integer query parameter, or returns the default value when it is absent.
+func parseUintParam(query url.Values, name string, defaultValue int) (int, error) {
+	param := query.Get(name)
+	if param == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.ParseUint(param, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+
+	return int(value), nil
+}
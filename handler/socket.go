@@ -0,0 +1,37 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package handler
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"popcorn/hub"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// NewWebSocketHandler upgrades the request of a signed in user to a web socket, over which the server pushes
+// notifications such as a new preference being ready. Every tab of the user holds its own connection.
+func NewWebSocketHandler(connHub *hub.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := CurrentUser(r)
+		if user == nil {
+			RenderError(w, "user is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		// The upgrader has already responded to the client when it fails.
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logrus.WithField("src", "handler.socket").Error("failed to upgrade to web socket", err)
+			return
+		}
+
+		connHub.Serve(user.ID, conn)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"popcorn/model"
-	"time"
 )
 
 type RegisterRequest struct {
@@ -39,18 +38,18 @@ func NewUserCreateHandler(db *gorm.DB) http.HandlerFunc {
 		newUser := &model.User{
 			Username:       reqData.Username,
 			PasswordDigest: hashBytes,
+			Role:           model.RoleUser,
 		}
 
-		newUser.ResetSessionToken()
-
 		if err := db.Create(newUser).Error; err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		expiration := time.Now().Add(2 * 24 * time.Hour)
-		cookie := http.Cookie{Name: "session_token", Value: newUser.SessionToken, Expires: expiration}
-		http.SetCookie(w, &cookie)
+		if err := startSession(db, w, r, newUser); err != nil {
+			RenderError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		if bytes, err := json.Marshal(newUser); err != nil {
 			RenderError(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,169 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package hub keeps track of the web socket connections of signed in users, so that background work can notify them.
+package hub
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	// WriteWait is how long a write to a client may take before the connection is considered dead.
+	WriteWait = 10 * time.Second
+
+	// PongWait is how long the hub waits for any message, including a pong, from a client.
+	PongWait = 60 * time.Second
+
+	// PingPeriod is how often clients are pinged, it must be shorter than PongWait.
+	PingPeriod = (PongWait * 9) / 10
+
+	// SendBufferSize is how many messages may wait for a slow client before it is disconnected.
+	SendBufferSize = 16
+
+	// MaxMessageSize is the largest message a client may send, clients are not expected to send anything but pongs.
+	MaxMessageSize = 512
+)
+
+// Hub holds every open connection by user ID. A user has one connection for every open tab.
+type Hub struct {
+	mutex     sync.RWMutex
+	clientMap map[uint]map[*client]bool
+}
+
+// client is one connection. Only its write loop writes to the connection, everything else goes through send.
+type client struct {
+	hub    *Hub
+	userID uint
+	conn   *websocket.Conn
+	send   chan interface{}
+}
+
+func New() *Hub {
+	return &Hub{
+		clientMap: make(map[uint]map[*client]bool),
+	}
+}
+
+// Serve registers the connection of a user and blocks until it is closed by the client or the hub.
+func (h *Hub) Serve(userID uint, conn *websocket.Conn) {
+	c := &client{
+		hub:    h,
+		userID: userID,
+		conn:   conn,
+		send:   make(chan interface{}, SendBufferSize),
+	}
+
+	h.register(c)
+	go c.writeLoop()
+	c.readLoop()
+}
+
+// Notify sends a message as JSON to every connection of a user, it returns the number of connections it was queued
+// for. It never blocks, clients that cannot keep up are disconnected.
+func (h *Hub) Notify(userID uint, message interface{}) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	count := 0
+	for c := range h.clientMap[userID] {
+		select {
+		case c.send <- message:
+			count += 1
+		default:
+			go h.unregister(c)
+		}
+	}
+
+	return count
+}
+
+// NumConnection returns the number of open connections of a user.
+func (h *Hub) NumConnection(userID uint) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return len(h.clientMap[userID])
+}
+
+func (h *Hub) register(c *client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.clientMap[c.userID]; !ok {
+		h.clientMap[c.userID] = make(map[*client]bool)
+	}
+
+	h.clientMap[c.userID][c] = true
+}
+
+// unregister removes a client and closes its send channel, which makes its write loop close the connection. It may be
+// called more than once for the same client.
+func (h *Hub) unregister(c *client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if clients, ok := h.clientMap[c.userID]; ok && clients[c] {
+		delete(clients, c)
+		close(c.send)
+		if len(clients) == 0 {
+			delete(h.clientMap, c.userID)
+		}
+	}
+}
+
+// readLoop discards whatever the client sends and keeps the connection alive as long as pongs arrive in time.
+func (c *client) readLoop() {
+	defer func() {
+		c.hub.unregister(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(PongWait))
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logrus.WithField("src", "hub").Warnf("connection of user %d is lost: %v", c.userID, err)
+			}
+
+			return
+		}
+	}
+}
+
+// writeLoop writes queued messages and pings to the client until the send channel is closed.
+func (c *client) writeLoop() {
+	ticker := time.NewTicker(PingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := c.conn.WriteJSON(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
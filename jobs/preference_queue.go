@@ -0,0 +1,213 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package jobs runs background work of the server from a queue that is persisted in Postgres, so that no request is
+// dropped when the server is busy and pending work survives a restart.
+package jobs
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"popcorn/model"
+	"time"
+)
+
+const (
+	// MaxAttempts is how many times a failing job is run before it is marked as failed.
+	MaxAttempts = 3
+
+	// PollInterval is how often an idle worker checks the table for jobs, in case it missed a wake-up, e.g. a job that
+	// was enqueued by another server.
+	PollInterval = 5 * time.Second
+
+	// StaleTimeout is how long a job may run before it is assumed that its server has stopped, and it is claimed again.
+	// It is far longer than recomputing a preference takes, so jobs of servers that are still running are left alone.
+	StaleTimeout = 10 * time.Minute
+)
+
+// PreferenceFunc recomputes the preference of a user.
+type PreferenceFunc func(userID uint) error
+
+// PreferenceQueue holds the preference jobs of every user. Handlers enqueue users whenever their feedback changes and a
+// pool of workers runs the jobs in the order they became pending.
+type PreferenceQueue struct {
+	db        *gorm.DB
+	wake      chan struct{}
+	numWorker int
+}
+
+// QueueStats is the number of jobs in each status.
+type QueueStats struct {
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Done      int `json:"done"`
+	Failed    int `json:"failed"`
+	NumWorker int `json:"num_worker"`
+}
+
+func NewPreferenceQueue(db *gorm.DB) *PreferenceQueue {
+	return &PreferenceQueue{
+		db:   db,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Enqueue asks for the preference of a user to be recomputed. It never blocks on the workers.
+func (q *PreferenceQueue) Enqueue(userID uint) error {
+	err := q.db.Exec(`
+		INSERT INTO preference_jobs (user_id, status, rerun, attempts, error, created_at, updated_at)
+		VALUES (?, ?, false, 0, '', now(), now())
+		ON CONFLICT (user_id) DO UPDATE SET
+			status = CASE WHEN preference_jobs.status = ? THEN preference_jobs.status ELSE ? END,
+			rerun = preference_jobs.status = ?,
+			attempts = CASE WHEN preference_jobs.status = ? THEN preference_jobs.attempts ELSE 0 END,
+			error = '',
+			updated_at = now()
+		WHERE preference_jobs.status <> ?`,
+		userID, model.JobPending,
+		model.JobRunning, model.JobPending,
+		model.JobRunning,
+		model.JobRunning,
+		model.JobPending,
+	).Error
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Job returns the preference job of a user.
+func (q *PreferenceQueue) Job(userID uint) (*model.PreferenceJob, error) {
+	var job model.PreferenceJob
+	if err := q.db.Where("user_id = ?", userID).First(&job).Error; err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Stats counts the jobs in each status.
+func (q *PreferenceQueue) Stats() (*QueueStats, error) {
+	var counts []struct {
+		Status string
+		Count  int
+	}
+
+	err := q.db.Model(&model.PreferenceJob{}).Select("status, count(*) as count").Group("status").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &QueueStats{NumWorker: q.numWorker}
+	for _, count := range counts {
+		switch count.Status {
+		case model.JobPending:
+			stats.Pending = count.Count
+		case model.JobRunning:
+			stats.Running = count.Count
+		case model.JobDone:
+			stats.Done = count.Count
+		case model.JobFailed:
+			stats.Failed = count.Count
+		}
+	}
+
+	return stats, nil
+}
+
+// Start starts numWorker workers that run every job with the given function. Jobs that were running when a server
+// stopped are claimed again once they are older than StaleTimeout.
+func (q *PreferenceQueue) Start(numWorker int, recompute PreferenceFunc) error {
+	q.numWorker = numWorker
+	for n := 0; n < numWorker; n += 1 {
+		go q.work(recompute)
+	}
+
+	return nil
+}
+
+func (q *PreferenceQueue) work(recompute PreferenceFunc) {
+	for {
+		job, err := q.claim()
+		if err != nil {
+			logrus.WithField("src", "jobs.queue").Error("failed to claim preference job", err)
+		}
+
+		if job == nil {
+			select {
+			case <-q.wake:
+			case <-time.After(PollInterval):
+			}
+
+			continue
+		}
+
+		if err := recompute(job.UserID); err != nil {
+			logrus.WithField("src", "jobs.queue").Errorf("preference job of user %d has failed: %v", job.UserID, err)
+			q.fail(job, err)
+		} else {
+			q.finish(job)
+		}
+	}
+}
+
+// claim marks the oldest pending job, or a running job that has gone stale, as running and returns it, or nil if there
+// is none. Rows locked by another worker are skipped, so every job is claimed by exactly one worker even across
+// servers.
+func (q *PreferenceQueue) claim() (*model.PreferenceJob, error) {
+	var jobs []*model.PreferenceJob
+	err := q.db.Raw(`
+		UPDATE preference_jobs SET status = ?, attempts = attempts + 1, started_at = now(), updated_at = now()
+		WHERE id = (
+			SELECT id FROM preference_jobs
+			WHERE status = ? OR (status = ? AND (started_at IS NULL OR started_at < ?))
+			ORDER BY updated_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		model.JobRunning, model.JobPending, model.JobRunning, time.Now().Add(-StaleTimeout),
+	).Scan(&jobs).Error
+
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+
+	return jobs[0], nil
+}
+
+// finish marks a job as done, unless the user was enqueued again while it was running.
+func (q *PreferenceQueue) finish(job *model.PreferenceJob) {
+	err := q.db.Exec(`
+		UPDATE preference_jobs SET
+			status = CASE WHEN rerun THEN ? ELSE ? END,
+			attempts = CASE WHEN rerun THEN 0 ELSE attempts END,
+			rerun = false, error = '', finished_at = now(), updated_at = now()
+		WHERE id = ?`,
+		model.JobPending, model.JobDone, job.ID,
+	).Error
+
+	if err != nil {
+		logrus.WithField("src", "jobs.queue").Error("failed to finish preference job", err)
+	}
+}
+
+// fail puts a job back in the queue until it has been attempted MaxAttempts times.
+func (q *PreferenceQueue) fail(job *model.PreferenceJob, cause error) {
+	err := q.db.Exec(`
+		UPDATE preference_jobs SET
+			status = CASE WHEN rerun OR attempts < ? THEN ? ELSE ? END,
+			rerun = false, error = ?, finished_at = now(), updated_at = now()
+		WHERE id = ?`,
+		MaxAttempts, model.JobPending, model.JobFailed, cause.Error(), job.ID,
+	).Error
+
+	if err != nil {
+		logrus.WithField("src", "jobs.queue").Error("failed to record failed preference job", err)
+	}
+}
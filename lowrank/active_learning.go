@@ -0,0 +1,85 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"errors"
+	"gonum.org/v1/gonum/mat"
+	"sort"
+)
+
+// MostInformative picks n movies whose ratings would tell the most about a new user, given the latent features of the
+// movies the user has already rated. A preference learned by LeastSquaresLatent with regularization reg has covariance
+// proportional to the inverse of
+//
+//	A = reg * I + Σ θ θᵀ
+//
+// and rating a movie with feature θ shrinks that uncertainty the most when θᵀ A⁻¹ θ is the largest. Movies are picked
+// greedily and A is updated after every pick, so the picks spread across the latent space instead of clustering around
+// the single most uncertain direction.
+func MostInformative(candidates map[int][]float64, known [][]float64, n int, K int, reg float64) ([]int, error) {
+	if reg <= 0 {
+		return nil, errors.New("regularization must be positive")
+	}
+
+	A := mat.NewSymDense(K, nil)
+	for k := 0; k < K; k += 1 {
+		A.SetSym(k, k, reg)
+	}
+
+	for _, feature := range known {
+		if len(feature) != K {
+			return nil, errors.New("dimension mismatch")
+		}
+
+		A.SymRankOne(A, 1, mat.NewVecDense(K, feature))
+	}
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(A); !ok {
+		return nil, errors.New("information matrix is not positive definite")
+	}
+
+	var inverse mat.SymDense
+	if err := chol.InverseTo(&inverse); err != nil {
+		return nil, err
+	}
+
+	// Iterate in a fixed order so ties are broken the same way every time.
+	movieIDs := make([]int, 0, len(candidates))
+	for movieID, feature := range candidates {
+		if len(feature) == K {
+			movieIDs = append(movieIDs, movieID)
+		}
+	}
+
+	sort.Ints(movieIDs)
+
+	picked := make([]int, 0, n)
+	isPicked := make(map[int]bool)
+	projected := mat.NewVecDense(K, nil)
+	for len(picked) < n && len(picked) < len(movieIDs) {
+		bestID, bestGain := 0, -1.0
+		for _, movieID := range movieIDs {
+			if isPicked[movieID] {
+				continue
+			}
+
+			feature := mat.NewVecDense(K, candidates[movieID])
+			if gain := mat.Inner(feature, &inverse, feature); gain > bestGain {
+				bestID, bestGain = movieID, gain
+			}
+		}
+
+		picked = append(picked, bestID)
+		isPicked[bestID] = true
+
+		// Sherman-Morrison: (A + θ θᵀ)⁻¹ = A⁻¹ - (A⁻¹ θ)(A⁻¹ θ)ᵀ / (1 + θᵀ A⁻¹ θ)
+		projected.MulVec(&inverse, mat.NewVecDense(K, candidates[bestID]))
+		inverse.SymRankOne(&inverse, -1/(1+bestGain), projected)
+	}
+
+	return picked, nil
+}
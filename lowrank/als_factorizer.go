@@ -0,0 +1,159 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/mat"
+	"runtime"
+	"sync"
+)
+
+func NewALSFactorizer(ratingFilePath, movieFilePath string, K int) (*ALSFactorizer, error) {
+	iterativeFact, err := NewIterativeFactorizer(ratingFilePath, movieFilePath, K)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ALSFactorizer{
+		IterativeFactorizer: iterativeFact,
+		NumWorker:           runtime.NumCPU(),
+	}, nil
+}
+
+func NewALSFactorizerFromDataset(dataset *Dataset, K int) *ALSFactorizer {
+	return &ALSFactorizer{
+		IterativeFactorizer: NewIterativeFactorizerFromDataset(dataset, K),
+		NumWorker:           runtime.NumCPU(),
+	}
+}
+
+// ALSFactorizer performs alternating least squares on the same rating maps as IterativeFactorizer. When movie latent
+// features are held fixed, the loss function is a ridge regression for each user and it can be solved in closed form,
+// and vice versa. Each half-step therefore solves one K by K linear system per user or per movie. These systems are
+// independent of each other, so they are distributed over NumWorker go routines.
+type ALSFactorizer struct {
+	*IterativeFactorizer
+	NumWorker int
+}
+
+// Train alternates between solving for every user's latent preference and every movie's latent feature. Unlike
+// gradient descent, there is no learning rate to tune; each step is guaranteed not to increase the loss.
+func (f *ALSFactorizer) Train(steps int, epochSize int, reg float64) {
+	for step := 0; step < steps; step += 1 {
+		if step%epochSize == 0 {
+			loss, rootMeanSqError, _ := f.Loss(reg)
+			logMessage := fmt.Sprintf(`iteration %3d: net loss %5.2f and RMSE %1.8f`, step, loss, rootMeanSqError)
+			logrus.WithField("file", "lowrank.als_factorizer").Info(logMessage)
+		}
+
+		if err := f.solveHalfStep(f.UserLatentMap, f.MovieLatentMap, f.TrainingUserMovieRatingMap, reg); err != nil {
+			logrus.WithField("file", "lowrank.als_factorizer").Error("failed to solve for user latent", err)
+		}
+
+		if err := f.solveHalfStep(f.MovieLatentMap, f.UserLatentMap, f.TrainingMovieUserRatingMap, reg); err != nil {
+			logrus.WithField("file", "lowrank.als_factorizer").Error("failed to solve for movie latent", err)
+		}
+	}
+}
+
+// solveHalfStep updates every latent vector in target while holding the latent vectors in fixed constant. Workers only
+// read from the maps and write into the existing slices of target, so no locking is required.
+func (f *ALSFactorizer) solveHalfStep(target, fixed map[int][]float64, ratingMap map[int]map[int]float64,
+	reg float64) error {
+	numWorker := f.NumWorker
+	if numWorker < 1 {
+		numWorker = 1
+	}
+
+	queue := make(chan int, numWorker)
+	errs := make(chan error, numWorker)
+
+	var wg sync.WaitGroup
+	for n := 0; n < numWorker; n += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				features := make([][]float64, 0, len(ratingMap[id]))
+				ratings := make([]float64, 0, len(ratingMap[id]))
+				for otherID, rating := range ratingMap[id] {
+					features = append(features, fixed[otherID])
+					ratings = append(ratings, rating)
+				}
+
+				latent, err := LeastSquaresLatent(features, ratings, len(target[id]), reg)
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					continue
+				}
+
+				copy(target[id], latent)
+			}
+		}()
+	}
+
+	for id := range target {
+		queue <- id
+	}
+
+	close(queue)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// LeastSquaresLatent solves the regularized least squares problem for a single latent vector x of dimension K,
+//
+//	(Θᵀ Θ + reg * I) x = Θᵀ r
+//
+// where each row of Θ is a fixed latent vector and r holds the corresponding ratings. The system is symmetric positive
+// definite whenever reg is positive, so it is solved with a Cholesky decomposition.
+func LeastSquaresLatent(features [][]float64, ratings []float64, K int, reg float64) ([]float64, error) {
+	if len(features) != len(ratings) {
+		return nil, errors.New("dimension mismatch")
+	}
+
+	A := mat.NewSymDense(K, nil)
+	b := mat.NewVecDense(K, nil)
+	for n, feature := range features {
+		if len(feature) != K {
+			return nil, errors.New("dimension mismatch")
+		}
+
+		for p := 0; p < K; p += 1 {
+			b.SetVec(p, b.AtVec(p)+ratings[n]*feature[p])
+			for q := p; q < K; q += 1 {
+				A.SetSym(p, q, A.At(p, q)+feature[p]*feature[q])
+			}
+		}
+	}
+
+	for k := 0; k < K; k += 1 {
+		A.SetSym(k, k, A.At(k, k)+reg)
+	}
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(A); !ok {
+		return nil, errors.New("least squares system is not positive definite")
+	}
+
+	x := mat.NewVecDense(K, nil)
+	if err := chol.SolveVec(x, b); err != nil {
+		return nil, err
+	}
+
+	return x.RawVector().Data, nil
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// ArtifactMagic identifies a Popcorn model artifact and ArtifactVersion is bumped whenever the layout changes.
+const (
+	ArtifactMagic   = "POPCORNM"
+	ArtifactVersion = 1
+)
+
+// Bounds on the sizes read from an artifact, a corrupt or truncated artifact must fail to read rather than allocate
+// gigabytes. They are far above what MovieLens needs.
+const (
+	ArtifactMaxHeaderLength = 1 << 20
+	ArtifactMaxFeatureDim   = 1 << 12
+	ArtifactMaxCount        = 1 << 24
+)
+
+// ArtifactHeader describes how a model was produced. It is stored as JSON inside the binary artifact so that new
+// fields do not require a new artifact version.
+type ArtifactHeader struct {
+	Algorithm       string             `json:"algorithm"`
+	FeatureDim      int                `json:"feature_dim"`
+	Hyperparameters map[string]float64 `json:"hyperparameters"`
+	RootMeanSqError float64            `json:"rmse"`
+	DatasetHash     string             `json:"dataset_hash"`
+}
+
+// Artifact is a trained model. Movie biases are zero unless the model is biased, in which case they include the global
+// mean.
+//
+// The binary layout is little endian,
+//
+//	magic [8]byte | version uint32 | header length uint32 | header JSON
+//	movie count uint64 | (movie ID int64 | bias float64 | K float64) * movie count
+//	user count uint64  | (user ID int64 | K float64) * user count
+//
+// with movies and users sorted by ID so that the same model always produces the same bytes.
+type Artifact struct {
+	ArtifactHeader
+	MovieLatentMap map[int][]float64
+	MovieBiasMap   map[int]float64
+	UserLatentMap  map[int][]float64
+}
+
+func (a *Artifact) Write(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+
+	header, err := json.Marshal(a.ArtifactHeader)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.WriteString(ArtifactMagic); err != nil {
+		return err
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, uint32(ArtifactVersion)); err != nil {
+		return err
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, uint32(len(header))); err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, uint64(len(a.MovieLatentMap))); err != nil {
+		return err
+	}
+
+	for _, movieID := range sortedKeys(a.MovieLatentMap) {
+		if len(a.MovieLatentMap[movieID]) != a.FeatureDim {
+			return errors.New("dimension mismatch")
+		}
+
+		if err := binary.Write(writer, binary.LittleEndian, int64(movieID)); err != nil {
+			return err
+		}
+
+		if err := binary.Write(writer, binary.LittleEndian, a.MovieBiasMap[movieID]); err != nil {
+			return err
+		}
+
+		if err := binary.Write(writer, binary.LittleEndian, a.MovieLatentMap[movieID]); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, uint64(len(a.UserLatentMap))); err != nil {
+		return err
+	}
+
+	for _, userID := range sortedKeys(a.UserLatentMap) {
+		if len(a.UserLatentMap[userID]) != a.FeatureDim {
+			return errors.New("dimension mismatch")
+		}
+
+		if err := binary.Write(writer, binary.LittleEndian, int64(userID)); err != nil {
+			return err
+		}
+
+		if err := binary.Write(writer, binary.LittleEndian, a.UserLatentMap[userID]); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// ReadArtifact reads an artifact written by Write. Sizes in the artifact are checked against the ArtifactMax bounds.
+func ReadArtifact(r io.Reader) (*Artifact, error) {
+	reader := bufio.NewReader(r)
+
+	magic := make([]byte, len(ArtifactMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, err
+	}
+
+	if string(magic) != ArtifactMagic {
+		return nil, errors.New("not a model artifact")
+	}
+
+	var version, headerLength uint32
+	if err := binary.Read(reader, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+
+	if version != ArtifactVersion {
+		return nil, errors.New("unsupported model artifact version")
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &headerLength); err != nil {
+		return nil, err
+	}
+
+	if headerLength > ArtifactMaxHeaderLength {
+		return nil, errors.New("model artifact header is too long")
+	}
+
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	artifact := &Artifact{
+		MovieLatentMap: make(map[int][]float64),
+		MovieBiasMap:   make(map[int]float64),
+		UserLatentMap:  make(map[int][]float64),
+	}
+
+	if err := json.Unmarshal(header, &artifact.ArtifactHeader); err != nil {
+		return nil, err
+	}
+
+	if artifact.FeatureDim < 1 || artifact.FeatureDim > ArtifactMaxFeatureDim {
+		return nil, errors.New("model artifact has an invalid feature dimension")
+	}
+
+	var movieCount, userCount uint64
+	if err := binary.Read(reader, binary.LittleEndian, &movieCount); err != nil {
+		return nil, err
+	}
+
+	if movieCount > ArtifactMaxCount {
+		return nil, errors.New("model artifact has too many movies")
+	}
+
+	for n := uint64(0); n < movieCount; n += 1 {
+		var movieID int64
+		var bias float64
+		latent := make([]float64, artifact.FeatureDim)
+
+		if err := binary.Read(reader, binary.LittleEndian, &movieID); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(reader, binary.LittleEndian, &bias); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(reader, binary.LittleEndian, latent); err != nil {
+			return nil, err
+		}
+
+		artifact.MovieLatentMap[int(movieID)] = latent
+		artifact.MovieBiasMap[int(movieID)] = bias
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &userCount); err != nil {
+		return nil, err
+	}
+
+	if userCount > ArtifactMaxCount {
+		return nil, errors.New("model artifact has too many users")
+	}
+
+	for n := uint64(0); n < userCount; n += 1 {
+		var userID int64
+		latent := make([]float64, artifact.FeatureDim)
+
+		if err := binary.Read(reader, binary.LittleEndian, &userID); err != nil {
+			return nil, err
+		}
+
+		if err := binary.Read(reader, binary.LittleEndian, latent); err != nil {
+			return nil, err
+		}
+
+		artifact.UserLatentMap[int(userID)] = latent
+	}
+
+	return artifact, nil
+}
+
+// HashDataset returns the hex encoded SHA-256 of the content of the given files, in order. It identifies the exact
+// MovieLens snapshot a model was trained on.
+func HashDataset(filepaths ...string) (string, error) {
+	hash := sha256.New()
+	for _, filepath := range filepaths {
+		file, err := os.Open(filepath)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func sortedKeys(latentMap map[int][]float64) []int {
+	keys := make([]int, 0, len(latentMap))
+	for key := range latentMap {
+		keys = append(keys, key)
+	}
+
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package lowrank
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestArtifactRoundTrip(t *testing.T) {
+	artifact := &Artifact{
+		ArtifactHeader: ArtifactHeader{Algorithm: "als", FeatureDim: 2, RootMeanSqError: 0.8},
+		MovieLatentMap: map[int][]float64{1: {0.1, 0.2}, 7: {-0.3, 0.4}},
+		MovieBiasMap:   map[int]float64{1: 3.5, 7: 2.5},
+		UserLatentMap:  map[int][]float64{3: {1, 2}},
+	}
+
+	var buffer bytes.Buffer
+	if err := artifact.Write(&buffer); err != nil {
+		t.Fatalf("Write: unexpected error %v", err)
+	}
+
+	actual, err := ReadArtifact(&buffer)
+	if err != nil {
+		t.Fatalf("ReadArtifact: unexpected error %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, artifact) {
+		t.Errorf("ReadArtifact = %+v, expected %+v", actual, artifact)
+	}
+}
+
+// artifactPrefix returns the magic and version of an artifact followed by the given header length and header.
+func artifactPrefix(headerLength uint32, header string) *bytes.Buffer {
+	var buffer bytes.Buffer
+	buffer.WriteString(ArtifactMagic)
+	binary.Write(&buffer, binary.LittleEndian, uint32(ArtifactVersion))
+	binary.Write(&buffer, binary.LittleEndian, headerLength)
+	buffer.WriteString(header)
+	return &buffer
+}
+
+// artifactWithHeader returns the magic and version of an artifact followed by the header and its length.
+func artifactWithHeader(header string) *bytes.Buffer {
+	return artifactPrefix(uint32(len(header)), header)
+}
+
+func TestReadArtifactBounds(t *testing.T) {
+	huge := artifactWithHeader(`{"feature_dim":2}`)
+	binary.Write(huge, binary.LittleEndian, uint64(ArtifactMaxCount+1))
+
+	tests := []struct {
+		name     string
+		reader   *bytes.Buffer
+		expected string
+	}{
+		{"huge header length", artifactPrefix(0xFFFFFFFF, ""), "model artifact header is too long"},
+		{"header length over the bound", artifactPrefix(ArtifactMaxHeaderLength+1, ""),
+			"model artifact header is too long"},
+		{"zero feature dimension", artifactWithHeader(`{"feature_dim":0}`),
+			"model artifact has an invalid feature dimension"},
+		{"huge feature dimension", artifactWithHeader(`{"feature_dim":999999}`),
+			"model artifact has an invalid feature dimension"},
+		{"huge movie count", huge, "model artifact has too many movies"},
+		{"truncated header", artifactPrefix(100, `{}`), "unexpected EOF"},
+		{"wrong magic", bytes.NewBufferString("NOTMODEL"), "not a model artifact"},
+	}
+
+	for _, test := range tests {
+		if _, err := ReadArtifact(test.reader); err == nil || err.Error() != test.expected {
+			t.Errorf("%s: ReadArtifact returned %v, expected %q", test.name, err, test.expected)
+		}
+	}
+}
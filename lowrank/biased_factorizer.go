@@ -0,0 +1,191 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"math/rand"
+)
+
+// InitLatentScale shrinks the random initial latent vectors of the biased model. The biases already account for most
+// of a rating, so the initial dot product should be close to zero.
+const InitLatentScale = 0.1
+
+func NewBiasedFactorizer(ratingFilePath, movieFilePath string, K int) (*BiasedFactorizer, error) {
+	dataset, err := LoadDataset(ratingFilePath, movieFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBiasedFactorizerFromDataset(dataset, K), nil
+}
+
+func NewBiasedFactorizerFromDataset(dataset *Dataset, K int) *BiasedFactorizer {
+	iterativeFact := NewIterativeFactorizerFromDataset(dataset, K)
+
+	for _, latent := range iterativeFact.UserLatentMap {
+		for k := range latent {
+			latent[k] *= InitLatentScale
+		}
+	}
+
+	for _, latent := range iterativeFact.MovieLatentMap {
+		for k := range latent {
+			latent[k] *= InitLatentScale
+		}
+	}
+
+	ratingCount := 0.0
+	globalMean := 0.0
+	for userID := range iterativeFact.TrainingUserMovieRatingMap {
+		for _, value := range iterativeFact.TrainingUserMovieRatingMap[userID] {
+			globalMean += value
+			ratingCount += 1
+		}
+	}
+
+	if ratingCount > 0 {
+		globalMean /= ratingCount
+	}
+
+	userBiasMap := make(map[int]float64)
+	for userID := range iterativeFact.UserLatentMap {
+		userBiasMap[userID] = 0
+	}
+
+	movieBiasMap := make(map[int]float64)
+	for movieID := range iterativeFact.MovieLatentMap {
+		movieBiasMap[movieID] = 0
+	}
+
+	return &BiasedFactorizer{
+		IterativeFactorizer: iterativeFact,
+		GlobalMean:          globalMean,
+		UserBiasMap:         userBiasMap,
+		MovieBiasMap:        movieBiasMap,
+	}
+}
+
+// BiasedFactorizer extends the iterative model with a global mean, a bias per user and a bias per movie, i.e. the
+// predicted rating is μ + b_u + b_i + x_u·θ_i. The biases capture how lenient a user is and how well received a movie
+// is, so the latent vectors only need to explain the interaction between the two.
+type BiasedFactorizer struct {
+	*IterativeFactorizer
+	GlobalMean   float64
+	UserBiasMap  map[int]float64
+	MovieBiasMap map[int]float64
+}
+
+func (f *BiasedFactorizer) Predict(userID, movieID int) (float64, error) {
+	dot, err := DotProduct(f.UserLatentMap[userID], f.MovieLatentMap[movieID])
+	if err != nil {
+		return 0, err
+	}
+
+	return f.GlobalMean + f.UserBiasMap[userID] + f.MovieBiasMap[movieID] + dot, nil
+}
+
+// MovieOffsetMap returns the global mean plus each movie's bias. This is the bias that gets persisted on movies, since
+// the recommendation engine never needs to separate the two.
+func (f *BiasedFactorizer) MovieOffsetMap() map[int]float64 {
+	offsetMap := make(map[int]float64, len(f.MovieBiasMap))
+	for movieID, bias := range f.MovieBiasMap {
+		offsetMap[movieID] = f.GlobalMean + bias
+	}
+
+	return offsetMap
+}
+
+func (f *BiasedFactorizer) Loss(reg float64) (float64, float64, error) {
+	var loss float64
+	for userID := range f.TrainingUserMovieRatingMap {
+		for movieID, value := range f.TrainingUserMovieRatingMap[userID] {
+			predictedRating, err := f.Predict(userID, movieID)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			loss += 0.5 * math.Pow(value-predictedRating, 2)
+		}
+	}
+
+	for userID := range f.UserLatentMap {
+		for _, latentValue := range f.UserLatentMap[userID] {
+			loss += 0.5 * reg * math.Pow(latentValue, 2)
+		}
+		loss += 0.5 * reg * math.Pow(f.UserBiasMap[userID], 2)
+	}
+
+	for movieID := range f.MovieLatentMap {
+		for _, latentValue := range f.MovieLatentMap[movieID] {
+			loss += 0.5 * reg * math.Pow(latentValue, 2)
+		}
+		loss += 0.5 * reg * math.Pow(f.MovieBiasMap[movieID], 2)
+	}
+
+	var rootMeanSqError, testCount float64
+	for userID := range f.TestRatingMap {
+		for movieID, value := range f.TestRatingMap[userID] {
+			predictedRating, err := f.Predict(userID, movieID)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			rootMeanSqError += math.Pow(value-predictedRating, 2)
+			testCount += 1
+		}
+	}
+
+	if testCount > 0 {
+		rootMeanSqError = math.Sqrt(rootMeanSqError / testCount)
+	}
+
+	return loss, rootMeanSqError, nil
+}
+
+// Train runs stochastic gradient descent over shuffled training ratings; each step is one full pass. Biases and latent
+// vectors of the rated user and movie are updated together after every rating.
+func (f *BiasedFactorizer) Train(steps int, epochSize int, reg float64, learnRate float64) {
+	samples := make([]ratingSample, 0)
+	for userID := range f.TrainingUserMovieRatingMap {
+		for movieID, value := range f.TrainingUserMovieRatingMap[userID] {
+			samples = append(samples, ratingSample{UserID: userID, MovieID: movieID, Value: value})
+		}
+	}
+
+	for step := 0; step < steps; step += 1 {
+		if step%epochSize == 0 {
+			loss, rootMeanSqError, _ := f.Loss(reg)
+			logMessage := fmt.Sprintf(`iteration %3d: net loss %5.2f and RMSE %1.8f`, step, loss, rootMeanSqError)
+			logrus.WithField("file", "lowrank.biased_factorizer").Info(logMessage)
+		}
+
+		for i := len(samples) - 1; i > 0; i -= 1 {
+			j := rand.Intn(i + 1)
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+
+		for _, sample := range samples {
+			predictedRating, err := f.Predict(sample.UserID, sample.MovieID)
+			if err != nil {
+				panic(err)
+			}
+
+			residual := sample.Value - predictedRating
+			f.UserBiasMap[sample.UserID] += learnRate * (residual - reg*f.UserBiasMap[sample.UserID])
+			f.MovieBiasMap[sample.MovieID] += learnRate * (residual - reg*f.MovieBiasMap[sample.MovieID])
+
+			userLatent := f.UserLatentMap[sample.UserID]
+			movieLatent := f.MovieLatentMap[sample.MovieID]
+			for k := 0; k < len(userLatent); k += 1 {
+				userK, movieK := userLatent[k], movieLatent[k]
+				userLatent[k] += learnRate * (residual*movieK - reg*userK)
+				movieLatent[k] += learnRate * (residual*userK - reg*movieK)
+			}
+		}
+	}
+}
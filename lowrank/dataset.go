@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"github.com/sirupsen/logrus"
+	"math/rand"
+)
+
+// Dataset holds the MovieLens ratings split into a training set and a test set. Training ratings are indexed both by
+// user and by movie so that factorizers can iterate over either side without scanning every rating.
+type Dataset struct {
+	MovieMap                   map[int]*Movie
+	TrainingUserMovieRatingMap map[int]map[int]float64
+	TrainingMovieUserRatingMap map[int]map[int]float64
+	TestRatingMap              map[int]map[int]float64
+}
+
+// LoadDataset reads the ratings and movies CSV files and randomly assigns TEST_RATIO of the ratings to the test set.
+// Every user and movie that appears in the ratings file has an entry in the training maps, even if all of its ratings
+// ended up in the test set.
+func LoadDataset(ratingFilePath, movieFilePath string) (*Dataset, error) {
+	var movieMap map[int]*Movie
+	var ratingMap map[int]map[int]float64
+	var loadErr error
+
+	movieMap, loadErr = loadMovies(movieFilePath)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	ratingMap, loadErr = loadUserRatings(ratingFilePath)
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	// Create counter to know how many test samples and training samples we have
+	testSetCount, trainSetCount := 0, 0
+	trainingUserMovieRatingMap := make(map[int]map[int]float64)
+	trainingMovieUserRatingMap := make(map[int]map[int]float64)
+	testSet := make(map[int]map[int]float64)
+
+	for userID := range ratingMap {
+		for movieID := range ratingMap[userID] {
+			if trainingUserMovieRatingMap[userID] == nil {
+				trainingUserMovieRatingMap[userID] = make(map[int]float64)
+			}
+
+			if trainingMovieUserRatingMap[movieID] == nil {
+				trainingMovieUserRatingMap[movieID] = make(map[int]float64)
+			}
+
+			if testSet[userID] == nil {
+				testSet[userID] = make(map[int]float64)
+			}
+
+			if rand.Float64() < TEST_RATIO {
+				testSetCount += 1
+				testSet[userID][movieID] = ratingMap[userID][movieID]
+			} else {
+				trainSetCount += 1
+				trainingUserMovieRatingMap[userID][movieID] = ratingMap[userID][movieID]
+				trainingMovieUserRatingMap[movieID][userID] = ratingMap[userID][movieID]
+				movieMap[movieID].Ratings = append(movieMap[movieID].Ratings, ratingMap[userID][movieID])
+			}
+		}
+	}
+
+	for movieID := range movieMap {
+		movieMap[movieID].AvgRating = Average(movieMap[movieID].Ratings)
+	}
+
+	fmtString := "CSV data are loaded with %d training samples and %d test samples from %d users on %d movies"
+	logrus.WithField("file", "lowrank.dataset").Infof(
+		fmtString, trainSetCount, testSetCount, len(trainingUserMovieRatingMap), len(trainingMovieUserRatingMap))
+
+	return &Dataset{
+		MovieMap:                   movieMap,
+		TrainingUserMovieRatingMap: trainingUserMovieRatingMap,
+		TrainingMovieUserRatingMap: trainingMovieUserRatingMap,
+		TestRatingMap:              testSet,
+	}, nil
+}
+
+// AddTrainingRating adds a rating that did not come from the CSV files to the training set, e.g. a rating submitted
+// through the web application. It must be called before a factorizer is created from the dataset, otherwise the user
+// or movie may not have a latent vector.
+func (d *Dataset) AddTrainingRating(userID, movieID int, value float64) {
+	if d.TrainingUserMovieRatingMap[userID] == nil {
+		d.TrainingUserMovieRatingMap[userID] = make(map[int]float64)
+	}
+
+	if d.TrainingMovieUserRatingMap[movieID] == nil {
+		d.TrainingMovieUserRatingMap[movieID] = make(map[int]float64)
+	}
+
+	d.TrainingUserMovieRatingMap[userID][movieID] = value
+	d.TrainingMovieUserRatingMap[movieID][userID] = value
+
+	if movie, ok := d.MovieMap[movieID]; ok {
+		movie.Ratings = append(movie.Ratings, value)
+		movie.AvgRating = Average(movie.Ratings)
+	}
+}
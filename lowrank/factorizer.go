@@ -7,6 +7,7 @@ package lowrank
 import (
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/mat"
 	"math"
 )
@@ -14,12 +15,19 @@ import (
 type Factorizer struct {
 	UserLatent      *mat.Dense
 	MovieLatent     *mat.Dense
-	Rating          *mat.Dense
+	Rating          *SparseMatrix
 	MatrixConverter *MatrixConverter
+
+	// Biases are optional. When MovieBias is set, the predicted rating becomes UserBias[i] + MovieBias[j] + x_i·θ_j,
+	// where each movie bias already includes the global mean. Movie biases are held constant; user biases are learned
+	// by ApproximateUserLatent.
+	UserBias  []float64
+	MovieBias []float64
 }
 
 // NewFactorizer requires either a converter or a rating matrix. Converter is needed for training phase. Rating matrix
-// is needed for running new user preference approximation in the recommendation engine.
+// is needed for running new user preference approximation in the recommendation engine. Zero entries of the rating
+// matrix are treated as missing values.
 func NewFactorizer(converter *MatrixConverter, ratingMat *mat.Dense, K int) *Factorizer {
 	if converter == nil && ratingMat == nil {
 		return nil
@@ -40,10 +48,12 @@ func NewFactorizer(converter *MatrixConverter, ratingMat *mat.Dense, K int) *Fac
 	return &Factorizer{
 		UserLatent:  RandMat(I, K),
 		MovieLatent: RandMat(J, K),
-		Rating:      ratingMat,
+		Rating:      NewSparseMatrixFromDense(ratingMat),
 	}
 }
 
+// ModelPredict returns the full I by J predicted rating matrix. It is dense, so it should only be used when the number
+// of users and movies is small. Loss and gradients only evaluate predictions for observed ratings.
 func (f *Factorizer) ModelPredict() (*mat.Dense, error) {
 	I, KI := f.UserLatent.Dims()
 	J, KJ := f.MovieLatent.Dims()
@@ -57,9 +67,33 @@ func (f *Factorizer) ModelPredict() (*mat.Dense, error) {
 	return result, nil
 }
 
+func (f *Factorizer) predict(i, j int) float64 {
+	prediction := floats.Dot(f.UserLatent.RawRowView(i), f.MovieLatent.RawRowView(j))
+	if f.MovieBias != nil {
+		prediction += f.UserBias[i] + f.MovieBias[j]
+	}
+
+	return prediction
+}
+
+func (f *Factorizer) checkDims() error {
+	I, KI := f.UserLatent.Dims()
+	J, KJ := f.MovieLatent.Dims()
+	RI, RJ := f.Rating.Dims()
+
+	if KI != KJ || I != RI || J != RJ {
+		return mat.ErrShape
+	}
+
+	if f.MovieBias != nil && (len(f.MovieBias) != J || len(f.UserBias) != I) {
+		return mat.ErrShape
+	}
+
+	return nil
+}
+
 func (f *Factorizer) Loss(reg float64) (float64, float64, error) {
-	prediction, err := f.ModelPredict()
-	if err != nil {
+	if err := f.checkDims(); err != nil {
 		return 0, 0, err
 	}
 
@@ -71,7 +105,7 @@ func (f *Factorizer) Loss(reg float64) (float64, float64, error) {
 			for movieID := range f.MatrixConverter.TestRatingMap[userID] {
 				i := f.MatrixConverter.UserIDToIndex[userID]
 				j := f.MatrixConverter.MovieIDToIndex[movieID]
-				rootMeanSqError += math.Pow(prediction.At(i, j)-f.MatrixConverter.TestRatingMap[userID][movieID], 2)
+				rootMeanSqError += math.Pow(f.predict(i, j)-f.MatrixConverter.TestRatingMap[userID][movieID], 2)
 				testCount += 1.0
 			}
 		}
@@ -80,20 +114,11 @@ func (f *Factorizer) Loss(reg float64) (float64, float64, error) {
 		rootMeanSqError = math.Sqrt(rootMeanSqError)
 	}
 
-	I, J := prediction.Dims()
-	diff := mat.NewDense(I, J, nil)
-	diff.Sub(prediction, f.Rating)
-	diff.MulElem(diff, diff)
-
-	// Ignore the difference generated by zero values of R matrix
-	for i := 0; i < I; i += 1 {
-		for j := 0; j < J; j += 1 {
-			if f.Rating.At(i, j) == 0 {
-				diff.Set(i, j, 0)
-			}
-		}
-	}
-	loss := 0.5 * mat.Sum(diff)
+	// Only observed ratings contribute to the loss, missing values are never materialized.
+	loss := 0.0
+	f.Rating.Do(func(i, j int, value float64) {
+		loss += 0.5 * math.Pow(f.predict(i, j)-value, 2)
+	})
 
 	USquared := mat.DenseCopyOf(f.UserLatent)
 	USquared.MulElem(USquared, USquared)
@@ -103,38 +128,36 @@ func (f *Factorizer) Loss(reg float64) (float64, float64, error) {
 	MSquared.MulElem(MSquared, MSquared)
 	loss += reg * mat.Sum(MSquared) / 2.0
 
+	if f.MovieBias != nil {
+		loss += reg * floats.Dot(f.UserBias, f.UserBias) / 2.0
+	}
+
 	return loss, rootMeanSqError, nil
 }
 
+// Gradients back-propagates the residual of every observed rating to the latent vectors of its user and movie. This is
+// equivalent to multiplying the masked residual matrix with the latent matrices, but it costs O(NNZ * K) time and never
+// allocates an I by J matrix.
 func (f *Factorizer) Gradients(reg float64) (*mat.Dense, *mat.Dense, error) {
-	prediction, err := f.ModelPredict()
-	if err != nil {
+	if err := f.checkDims(); err != nil {
 		return nil, nil, err
 	}
 
-	I, J := prediction.Dims()
-	GradR := mat.NewDense(I, J, nil)
-	GradR.Sub(prediction, f.Rating)
-
-	// Prevent the zero values of R from back-propagating gradients to M and U
-	for i := 0; i < I; i += 1 {
-		for j := 0; j < J; j += 1 {
-			if f.Rating.At(i, j) == 0 {
-				GradR.Set(i, j, 0)
-			}
-		}
-	}
-
-	_, K := f.UserLatent.Dims()
+	I, K := f.UserLatent.Dims()
+	J, _ := f.MovieLatent.Dims()
 
 	GradU := mat.NewDense(I, K, nil)
-	GradU.Mul(GradR, f.MovieLatent)
+	GradM := mat.NewDense(J, K, nil)
+	f.Rating.Do(func(i, j int, value float64) {
+		residual := f.predict(i, j) - value
+		floats.AddScaled(GradU.RawRowView(i), residual, f.MovieLatent.RawRowView(j))
+		floats.AddScaled(GradM.RawRowView(j), residual, f.UserLatent.RawRowView(i))
+	})
+
 	RegU := mat.NewDense(I, K, nil)
 	RegU.Scale(reg, f.UserLatent)
 	GradU.Add(GradU, RegU)
 
-	GradM := mat.NewDense(J, K, nil)
-	GradM.Mul(GradR.T(), f.UserLatent)
 	RegM := mat.NewDense(J, K, nil)
 	RegM.Scale(reg, f.MovieLatent)
 	GradM.Add(GradM, RegM)
@@ -142,6 +165,27 @@ func (f *Factorizer) Gradients(reg float64) (*mat.Dense, *mat.Dense, error) {
 	return GradU, GradM, nil
 }
 
+// UserBiasGradient returns the gradient of the loss with respect to each user bias. It is nil when the factorizer does
+// not have biases.
+func (f *Factorizer) UserBiasGradient(reg float64) ([]float64, error) {
+	if err := f.checkDims(); err != nil {
+		return nil, err
+	}
+
+	if f.MovieBias == nil {
+		return nil, nil
+	}
+
+	GradB := make([]float64, len(f.UserBias))
+	f.Rating.Do(func(i, j int, value float64) {
+		GradB[i] += f.predict(i, j) - value
+	})
+
+	floats.AddScaled(GradB, reg, f.UserBias)
+
+	return GradB, nil
+}
+
 func (f *Factorizer) Train(steps int, epochSize int, reg float64, learnRate float64) {
 	for step := 0; step < steps; step += 1 {
 		if step%epochSize == 0 {
@@ -181,9 +225,18 @@ func (f *Factorizer) ApproximateUserLatent(steps int, epochSize int, reg float64
 			logrus.WithField("src", "lowrank.factorizer").Info(logMessage)
 		}
 
+		GradB, err := f.UserBiasGradient(reg)
+		if err != nil {
+			continue
+		}
+
 		if GradU, _, err := f.Gradients(reg); err == nil {
 			GradU.Scale(learnRate, GradU)
 			f.UserLatent.Sub(f.UserLatent, GradU)
 		}
+
+		if GradB != nil {
+			floats.AddScaled(f.UserBias, -learnRate, GradB)
+		}
 	}
 }
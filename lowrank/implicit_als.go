@@ -0,0 +1,293 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+	"runtime"
+	"sync"
+)
+
+// Implicit feedback parameters. Confidence of an interaction is 1 + ImplicitAlpha * |weight|, where an explicit rating
+// counts as an interaction with ExplicitRatingWeight. A positive interaction asks the model to predict ImplicitShift
+// stars above the user and movie biases, a skip asks for ImplicitShift stars below.
+const (
+	ImplicitAlpha        = 10.0
+	ImplicitShift        = 1.0
+	ExplicitRatingWeight = 5.0
+	ImplicitReg          = 0.1
+)
+
+// Feedback is one observed entry of the implicit model. Preference is the value that the dot product should approach
+// and Confidence is how much the loss cares about it. Every unobserved user and movie pair implicitly has a preference
+// of zero and a confidence of one.
+type Feedback struct {
+	Preference float64
+	Confidence float64
+}
+
+// NewImplicitFeedback converts an aggregated interaction weight into feedback, following Hu, Koren and Volinsky. A
+// positive weight means the user likes the movie and a negative weight, e.g. skipping it, means the user does not. The
+// magnitude of the weight only raises the confidence, scaled by alpha.
+func NewImplicitFeedback(weight, alpha float64) Feedback {
+	preference := 0.0
+	if weight > 0 {
+		preference = 1.0
+	}
+
+	if weight < 0 {
+		weight = -weight
+	}
+
+	return Feedback{Preference: preference, Confidence: 1 + alpha*weight}
+}
+
+// NewUserFeedback combines everything one user has told us about movies into feedback for the implicit model. Offsets
+// are the explicit ratings minus the user and movie biases, and weights are the summed interaction weights of each
+// movie. Interactions ask for ImplicitShift stars above or below the biases, and explicit ratings are the strongest
+// feedback a user can give, so they override interactions on the same movie. Movies whose interactions cancel out,
+// e.g. a skip and a detail view, say nothing and are left unobserved instead of counted as disliked.
+func NewUserFeedback(offsetMap, weightMap map[int]float64) map[int]Feedback {
+	feedback := make(map[int]Feedback)
+	for movieID, weight := range weightMap {
+		if weight == 0 {
+			continue
+		}
+
+		implicitFeedback := NewImplicitFeedback(weight, ImplicitAlpha)
+		if weight > 0 {
+			implicitFeedback.Preference = ImplicitShift
+		} else {
+			implicitFeedback.Preference = -ImplicitShift
+		}
+
+		feedback[movieID] = implicitFeedback
+	}
+
+	for movieID, offset := range offsetMap {
+		feedback[movieID] = Feedback{Preference: offset, Confidence: 1 + ImplicitAlpha*ExplicitRatingWeight}
+	}
+
+	return feedback
+}
+
+func NewImplicitALSFactorizer(feedbackMap map[int]map[int]Feedback, K int) *ImplicitALSFactorizer {
+	userLatentMap := make(map[int][]float64)
+	movieLatentMap := make(map[int][]float64)
+	movieFeedbackMap := make(map[int]map[int]Feedback)
+
+	for userID := range feedbackMap {
+		userLatentMap[userID] = RandVector(K)
+		for movieID, feedback := range feedbackMap[userID] {
+			if movieFeedbackMap[movieID] == nil {
+				movieFeedbackMap[movieID] = make(map[int]Feedback)
+				movieLatentMap[movieID] = RandVector(K)
+			}
+
+			movieFeedbackMap[movieID][userID] = feedback
+		}
+	}
+
+	return &ImplicitALSFactorizer{
+		UserFeedbackMap:  feedbackMap,
+		MovieFeedbackMap: movieFeedbackMap,
+		UserLatentMap:    userLatentMap,
+		MovieLatentMap:   movieLatentMap,
+		NumWorker:        runtime.NumCPU(),
+	}
+}
+
+// ImplicitALSFactorizer is the weighted matrix factorization for implicit feedback by Hu, Koren and Volinsky. Every
+// user and movie pair is part of the loss, not only the observed ones,
+//
+//	Σ_ui c_ui (p_ui - x_u·y_i)² + reg (Σ_u ||x_u||² + Σ_i ||y_i||²)
+//
+// which would be far too expensive to evaluate directly. Since unobserved pairs have a confidence of one, the normal
+// equation of each user only needs the Gramian YᵀY that is shared by everyone plus a correction from the movies that
+// the user has interacted with.
+type ImplicitALSFactorizer struct {
+	UserFeedbackMap  map[int]map[int]Feedback
+	MovieFeedbackMap map[int]map[int]Feedback
+	UserLatentMap    map[int][]float64
+	MovieLatentMap   map[int][]float64
+	NumWorker        int
+}
+
+func (f *ImplicitALSFactorizer) Train(steps int, epochSize int, reg float64) {
+	for step := 0; step < steps; step += 1 {
+		if step%epochSize == 0 {
+			loss, _ := f.Loss(reg)
+			logMessage := fmt.Sprintf(`iteration %3d: net loss %5.2f`, step, loss)
+			logrus.WithField("file", "lowrank.implicit_als").Info(logMessage)
+		}
+
+		if err := f.solveHalfStep(f.UserLatentMap, f.MovieLatentMap, f.UserFeedbackMap, reg); err != nil {
+			logrus.WithField("file", "lowrank.implicit_als").Error("failed to solve for user latent", err)
+		}
+
+		if err := f.solveHalfStep(f.MovieLatentMap, f.UserLatentMap, f.MovieFeedbackMap, reg); err != nil {
+			logrus.WithField("file", "lowrank.implicit_als").Error("failed to solve for movie latent", err)
+		}
+	}
+}
+
+// Loss evaluates the weighted loss over every user and movie pair. Unobserved pairs contribute (x_u·y_i)², and their
+// sum is computed as Σ_u x_uᵀ (YᵀY) x_u minus the observed pairs, so it is never necessary to visit all pairs.
+func (f *ImplicitALSFactorizer) Loss(reg float64) (float64, error) {
+	gramian, err := Gramian(f.MovieLatentMap)
+	if err != nil {
+		return 0, err
+	}
+
+	var loss float64
+	for userID, userLatent := range f.UserLatentMap {
+		x := mat.NewVecDense(len(userLatent), userLatent)
+		loss += mat.Inner(x, gramian, x)
+
+		for movieID, feedback := range f.UserFeedbackMap[userID] {
+			score := floats.Dot(userLatent, f.MovieLatentMap[movieID])
+			loss += feedback.Confidence*(feedback.Preference-score)*(feedback.Preference-score) - score*score
+		}
+
+		loss += reg * floats.Dot(userLatent, userLatent)
+	}
+
+	for _, movieLatent := range f.MovieLatentMap {
+		loss += reg * floats.Dot(movieLatent, movieLatent)
+	}
+
+	return loss, nil
+}
+
+func (f *ImplicitALSFactorizer) solveHalfStep(target, fixed map[int][]float64, feedbackMap map[int]map[int]Feedback,
+	reg float64) error {
+	gramian, err := Gramian(fixed)
+	if err != nil {
+		return err
+	}
+
+	numWorker := f.NumWorker
+	if numWorker < 1 {
+		numWorker = 1
+	}
+
+	queue := make(chan int, numWorker)
+	errs := make(chan error, numWorker)
+
+	var wg sync.WaitGroup
+	for n := 0; n < numWorker; n += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				latent, err := ImplicitLeastSquaresLatent(gramian, fixed, feedbackMap[id], reg)
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					continue
+				}
+
+				copy(target[id], latent)
+			}
+		}()
+	}
+
+	for id := range target {
+		queue <- id
+	}
+
+	close(queue)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// Gramian returns YᵀY, the sum of outer products of every latent vector in the map.
+func Gramian(latentMap map[int][]float64) (*mat.SymDense, error) {
+	K := 0
+	for _, latent := range latentMap {
+		K = len(latent)
+		break
+	}
+
+	if K == 0 {
+		return nil, errors.New("cannot compute gramian of empty latent vectors")
+	}
+
+	gramian := mat.NewSymDense(K, nil)
+	for _, latent := range latentMap {
+		if len(latent) != K {
+			return nil, errors.New("dimension mismatch")
+		}
+
+		for p := 0; p < K; p += 1 {
+			for q := p; q < K; q += 1 {
+				gramian.SetSym(p, q, gramian.At(p, q)+latent[p]*latent[q])
+			}
+		}
+	}
+
+	return gramian, nil
+}
+
+// ImplicitLeastSquaresLatent solves for one latent vector of the implicit model while the other side is held fixed,
+//
+//	(YᵀY + Yᵀ (C - I) Y + reg * I) x = Yᵀ C p
+//
+// where gramian is YᵀY over every fixed latent vector, and only the observed feedback contributes to the correction.
+// ImplicitALSFactorizer solves every user and movie with it, and the recommendation engine uses it to fold a single
+// user into an existing model.
+func ImplicitLeastSquaresLatent(gramian *mat.SymDense, fixed map[int][]float64, feedback map[int]Feedback,
+	reg float64) ([]float64, error) {
+	K := gramian.Symmetric()
+
+	A := mat.NewSymDense(K, nil)
+	A.CopySym(gramian)
+	b := mat.NewVecDense(K, nil)
+	for id, fb := range feedback {
+		latent, ok := fixed[id]
+		if !ok {
+			continue
+		}
+
+		if len(latent) != K {
+			return nil, errors.New("dimension mismatch")
+		}
+
+		for p := 0; p < K; p += 1 {
+			b.SetVec(p, b.AtVec(p)+fb.Confidence*fb.Preference*latent[p])
+			for q := p; q < K; q += 1 {
+				A.SetSym(p, q, A.At(p, q)+(fb.Confidence-1)*latent[p]*latent[q])
+			}
+		}
+	}
+
+	for k := 0; k < K; k += 1 {
+		A.SetSym(k, k, A.At(k, k)+reg)
+	}
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(A); !ok {
+		return nil, errors.New("least squares system is not positive definite")
+	}
+
+	x := mat.NewVecDense(K, nil)
+	if err := chol.SolveVec(x, b); err != nil {
+		return nil, err
+	}
+
+	return x.RawVector().Data, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package lowrank
+
+import (
+	"gonum.org/v1/gonum/floats"
+	"testing"
+)
+
+func TestNewUserFeedback(t *testing.T) {
+	offsetMap := map[int]float64{1: 1.5, 2: -0.5}
+	weightMap := map[int]float64{2: 2, 3: 3, 4: -1, 5: 0}
+
+	feedback := NewUserFeedback(offsetMap, weightMap)
+	expected := map[int]Feedback{
+		1: {Preference: 1.5, Confidence: 1 + ImplicitAlpha*ExplicitRatingWeight},
+		2: {Preference: -0.5, Confidence: 1 + ImplicitAlpha*ExplicitRatingWeight},
+		3: {Preference: ImplicitShift, Confidence: 1 + ImplicitAlpha*3},
+		4: {Preference: -ImplicitShift, Confidence: 1 + ImplicitAlpha},
+	}
+
+	if len(feedback) != len(expected) {
+		t.Errorf("NewUserFeedback = %v, expected %v", feedback, expected)
+	}
+
+	for movieID, fb := range expected {
+		if feedback[movieID] != fb {
+			t.Errorf("feedback on movie %d is %v, expected %v", movieID, feedback[movieID], fb)
+		}
+	}
+}
+
+func TestImplicitALSFactorizerTrain(t *testing.T) {
+	// Users 1 and 2 like movies 10 and 11 and skip 12, user 3 is the other way around. User 4 only watched the
+	// trailer of movie 10 and should end up preferring it like users 1 and 2 do.
+	feedbackMap := map[int]map[int]Feedback{
+		1: NewUserFeedback(nil, map[int]float64{10: 2, 11: 1, 12: -1}),
+		2: NewUserFeedback(nil, map[int]float64{10: 1, 11: 2, 12: -1}),
+		3: NewUserFeedback(nil, map[int]float64{10: -1, 11: -1, 12: 2}),
+		4: NewUserFeedback(nil, map[int]float64{10: 2}),
+	}
+
+	fact := NewImplicitALSFactorizer(feedbackMap, 2)
+	fact.NumWorker = 2
+
+	before, err := fact.Loss(ImplicitReg)
+	if err != nil {
+		t.Fatalf("Loss: unexpected error %v", err)
+	}
+
+	fact.Train(10, 10, ImplicitReg)
+
+	after, err := fact.Loss(ImplicitReg)
+	if err != nil {
+		t.Fatalf("Loss: unexpected error %v", err)
+	}
+
+	if after >= before {
+		t.Errorf("loss went from %f to %f, expected it to decrease", before, after)
+	}
+
+	score := func(userID, movieID int) float64 {
+		return floats.Dot(fact.UserLatentMap[userID], fact.MovieLatentMap[movieID])
+	}
+
+	for _, userID := range []int{1, 2, 4} {
+		if score(userID, 11) <= score(userID, 12) {
+			t.Errorf("user %d scores movie 11 at %f, not above skipped movie 12 at %f", userID, score(userID, 11),
+				score(userID, 12))
+		}
+	}
+
+	if score(3, 12) <= score(3, 10) {
+		t.Errorf("user 3 scores movie 12 at %f, not above skipped movie 10 at %f", score(3, 12), score(3, 10))
+	}
+}
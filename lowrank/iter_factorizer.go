@@ -8,80 +8,38 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"math"
-	"math/rand"
 )
 
 func NewIterativeFactorizer(ratingFilePath, movieFilePath string, K int) (*IterativeFactorizer, error) {
-	var movieMap map[int]*Movie
-	var trainingUserMovieRatingMap, trainingMovieUserRatingMap, trainSet, testSet map[int]map[int]float64
-	var loadErr error
-
-	movieMap, loadErr = loadMovies(movieFilePath)
-	if loadErr != nil {
-		return nil, loadErr
-	}
-
-	trainSet, loadErr = loadUserRatings(ratingFilePath)
+	dataset, loadErr := LoadDataset(ratingFilePath, movieFilePath)
 	if loadErr != nil {
 		return nil, loadErr
 	}
 
-	// Create counter to know how many test samples and training samples we have
-	testSetCount, trainSetCount := 0, 0
-	trainingUserMovieRatingMap = make(map[int]map[int]float64)
-	trainingMovieUserRatingMap = make(map[int]map[int]float64)
-	testSet = make(map[int]map[int]float64)
+	return NewIterativeFactorizerFromDataset(dataset, K), nil
+}
 
+// NewIterativeFactorizerFromDataset creates a factorizer on an already loaded dataset. Factorizers never modify the
+// dataset, so many of them can be trained on the same dataset at the same time, e.g. to compare hyperparameters on the
+// same test set.
+func NewIterativeFactorizerFromDataset(dataset *Dataset, K int) *IterativeFactorizer {
 	// Randomly assign each user and movie a latent vector
 	userLatentMap := make(map[int][]float64)
 	movieLatentMap := make(map[int][]float64)
 
-	for userID := range trainSet {
+	for userID := range dataset.TrainingUserMovieRatingMap {
 		userLatentMap[userID] = RandVector(K)
-		for movieID := range trainSet[userID] {
-			movieLatentMap[movieID] = RandVector(K)
-
-			if trainingUserMovieRatingMap[userID] == nil {
-				trainingUserMovieRatingMap[userID] = make(map[int]float64)
-			}
-
-			if trainingMovieUserRatingMap[movieID] == nil {
-				trainingMovieUserRatingMap[movieID] = make(map[int]float64)
-			}
-
-			if testSet[userID] == nil {
-				testSet[userID] = make(map[int]float64)
-			}
-
-			if rand.Float64() < TEST_RATIO {
-				testSetCount += 1
-				testSet[userID][movieID] = trainSet[userID][movieID]
-			} else {
-				trainSetCount += 1
-				trainingUserMovieRatingMap[userID][movieID] = trainSet[userID][movieID]
-				trainingMovieUserRatingMap[movieID][userID] = trainSet[userID][movieID]
-				movieMap[movieID].Ratings = append(movieMap[movieID].Ratings, trainSet[userID][movieID])
-			}
-		}
 	}
 
-	for movieID := range movieMap {
-		movieMap[movieID].AvgRating = Average(movieMap[movieID].Ratings)
+	for movieID := range dataset.TrainingMovieUserRatingMap {
+		movieLatentMap[movieID] = RandVector(K)
 	}
 
-	fmtString := "CSV data are loaded with %d training samples and %d test samples from %d users on %d movies"
-	logMessage := fmt.Sprintf(
-		fmtString, trainSetCount, testSetCount, len(trainingUserMovieRatingMap), len(trainingMovieUserRatingMap))
-	logrus.WithField("file", "lowrank.iterative_factorizer").Infof(logMessage)
-
 	return &IterativeFactorizer{
-		MovieMap:                   movieMap,
-		UserLatentMap:              userLatentMap,
-		MovieLatentMap:             movieLatentMap,
-		TrainingUserMovieRatingMap: trainingUserMovieRatingMap,
-		TrainingMovieUserRatingMap: trainingMovieUserRatingMap,
-		TestRatingMap:              testSet,
-	}, nil
+		Dataset:        dataset,
+		UserLatentMap:  userLatentMap,
+		MovieLatentMap: movieLatentMap,
+	}
 }
 
 // IterativeFactorizer does not use matrices at all. Instead, it holds each user's preference vector and movie's feature
@@ -90,12 +48,9 @@ func NewIterativeFactorizer(ratingFilePath, movieFilePath string, K int) (*Itera
 // the number of generated predicted rating is 900 millions. Each float64 is 8 bytes, and that is 7.2 billion bytes of
 // memory.
 type IterativeFactorizer struct {
-	MovieMap                   map[int]*Movie
-	UserLatentMap              map[int][]float64
-	MovieLatentMap             map[int][]float64
-	TrainingUserMovieRatingMap map[int]map[int]float64
-	TrainingMovieUserRatingMap map[int]map[int]float64
-	TestRatingMap              map[int]map[int]float64
+	*Dataset
+	UserLatentMap  map[int][]float64
+	MovieLatentMap map[int][]float64
 }
 
 func (f *IterativeFactorizer) Train(steps int, epochSize int, reg float64, learnRate float64) {
@@ -188,7 +143,8 @@ func (f *IterativeFactorizer) Loss(reg float64) (float64, float64, error) {
 	return loss, rootMeanSqError, nil
 }
 
-// TODO: Use stochastic gradient descent
+// GradientUserLatent computes the full batch gradient of a user's latent preference. Use TrainSGD for stochastic
+// updates; this is kept for Train and for gradient checking.
 func (f *IterativeFactorizer) GradientUserLatent(userID int, reg float64) ([]float64, error) {
 	userLatent := f.UserLatentMap[userID]
 	gradUserLatent := make([]float64, 0, len(userLatent))
@@ -210,7 +166,8 @@ func (f *IterativeFactorizer) GradientUserLatent(userID int, reg float64) ([]flo
 	return gradUserLatent, nil
 }
 
-// TODO: Use stochastic gradient descent
+// GradientMovieLatent computes the full batch gradient of a movie's latent feature. Use TrainSGD for stochastic
+// updates; this is kept for Train and for gradient checking.
 func (f *IterativeFactorizer) GradientMovieLatent(movieID int, reg float64) ([]float64, error) {
 	movieLatent := f.MovieLatentMap[movieID]
 	gradMovieLatent := make([]float64, 0, len(movieLatent))
@@ -84,3 +84,20 @@ func RandVector(K int) []float64 {
 
 	return vector
 }
+
+// CosineSimilarity returns the cosine of the angle between two vectors of the same length, or zero if either of them
+// is a zero vector.
+func CosineSimilarity(vector1 []float64, vector2 []float64) float64 {
+	var dot, norm1, norm2 float64
+	for i := 0; i < len(vector1) && i < len(vector2); i += 1 {
+		dot += vector1[i] * vector2[i]
+		norm1 += vector1[i] * vector1[i]
+		norm2 += vector2[i] * vector2[i]
+	}
+
+	if norm1 == 0 || norm2 == 0 {
+		return 0
+	}
+
+	return dot / math.Sqrt(norm1*norm2)
+}
@@ -5,9 +5,7 @@
 package lowrank
 
 import (
-	"fmt"
 	"github.com/sirupsen/logrus"
-	"gonum.org/v1/gonum/mat"
 	"math/rand"
 )
 
@@ -90,8 +88,8 @@ func NewMatrixConverter(ratingFilePath string, movieFilepath string) (*MatrixCon
 	}
 
 	fmtString := "CSV data are loaded with %d training samples and %d test samples from %d users on %d movies"
-	logMessage := fmt.Sprintf(fmtString, trainSetCount, testSetCount, len(userIdToIndex), len(movieIdToIndex))
-	logrus.WithField("file", "lowrank.matrix_converter").Infof(logMessage)
+	logrus.WithField("file", "lowrank.matrix_converter").Infof(
+		fmtString, trainSetCount, testSetCount, len(userIdToIndex), len(movieIdToIndex))
 
 	return &MatrixConverter{
 		MovieMap:       movieMap,
@@ -104,31 +102,23 @@ func NewMatrixConverter(ratingFilePath string, movieFilepath string) (*MatrixCon
 	}, nil
 }
 
-// GetRatingMatrix returns f I by J matrix where I represents the ith user and J represents the jth movie. If f value is
-// missing, it is filled by zero. During training phase, all zero entries will be ignored for loss calculation.
-func (dp *MatrixConverter) GetRatingMatrix() *mat.Dense {
+// GetRatingMatrix returns a sparse I by J matrix where I represents the ith user and J represents the jth movie. Only
+// the ratings in the training set are stored; missing values and test ratings are left out, so they are ignored for
+// loss calculation during training phase.
+func (dp *MatrixConverter) GetRatingMatrix() *SparseMatrix {
 	I, J := len(dp.TrainRatingMap), len(dp.MovieMap)
-	R := mat.NewDense(I, J, nil)
+	entries := make(map[int]map[int]float64, I)
 	for i := 0; i < I; i += 1 {
-		for j := 0; j < J; j += 1 {
-			userId := dp.UserIndexToID[i]
-			movieId := dp.MovieIndexToID[j]
-
-			isTrain := true
-			if _, userExists := dp.TestRatingMap[userId]; userExists {
-				if _, movieExists := dp.TestRatingMap[userId][movieId]; movieExists {
-					isTrain = false
-				}
+		userId := dp.UserIndexToID[i]
+		entries[i] = make(map[int]float64, len(dp.TrainRatingMap[userId]))
+		for movieId, value := range dp.TrainRatingMap[userId] {
+			if _, isTest := dp.TestRatingMap[userId][movieId]; isTest {
+				continue
 			}
 
-			// Append zero for missing values, we are creating f sparse matrix.
-			if _, ok := dp.TrainRatingMap[userId][movieId]; ok && isTrain {
-				R.Set(i, j, dp.TrainRatingMap[userId][movieId])
-			} else {
-				R.Set(i, j, 0.0)
-			}
+			entries[i][dp.MovieIDToIndex[movieId]] = value
 		}
 	}
 
-	return R
+	return NewSparseMatrix(I, J, entries)
 }
@@ -0,0 +1,275 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"math/rand"
+)
+
+// Optimizers that are supported by stochastic gradient descent.
+const (
+	OptimizerSGD      = "sgd"
+	OptimizerMomentum = "momentum"
+	OptimizerAdam     = "adam"
+)
+
+// SGDConfig holds the hyperparameters of stochastic gradient descent. A batch size of 1 is plain stochastic gradient
+// descent, anything larger averages the gradients over a mini-batch of ratings before updating.
+type SGDConfig struct {
+	Epochs    int
+	BatchSize int
+	Reg       float64
+	LearnRate float64
+
+	// Learning rate at epoch t is LearnRate / (1 + Decay * t).
+	Decay float64
+
+	// Optimizer is one of sgd, momentum or adam. Momentum is the velocity coefficient for momentum; Beta1, Beta2 and
+	// Epsilon are the usual parameters of Adam.
+	Optimizer string
+	Momentum  float64
+	Beta1     float64
+	Beta2     float64
+	Epsilon   float64
+
+	// Training stops when the test RMSE has not improved for Patience consecutive epochs, and the latent vectors of
+	// the best epoch are restored. Zero disables early stopping.
+	Patience int
+}
+
+func DefaultSGDConfig() SGDConfig {
+	return SGDConfig{
+		Epochs:    50,
+		BatchSize: 1,
+		Reg:       0.03,
+		LearnRate: 0.01,
+		Decay:     0.0,
+		Optimizer: OptimizerSGD,
+		Momentum:  0.9,
+		Beta1:     0.9,
+		Beta2:     0.999,
+		Epsilon:   1e-8,
+		Patience:  0,
+	}
+}
+
+func (c SGDConfig) validate() error {
+	if c.BatchSize < 1 {
+		return errors.New("batch size must be at least 1")
+	}
+
+	if c.LearnRate <= 0 {
+		return errors.New("learning rate must be positive")
+	}
+
+	switch c.Optimizer {
+	case OptimizerSGD, OptimizerMomentum, OptimizerAdam:
+		return nil
+	default:
+		return fmt.Errorf("unknown optimizer %s", c.Optimizer)
+	}
+}
+
+type ratingSample struct {
+	UserID  int
+	MovieID int
+	Value   float64
+}
+
+// optimizerState keeps the per-vector history that momentum and Adam need. Vectors that do not appear in a batch are
+// not touched, i.e. Adam is applied lazily and each vector keeps its own step count for bias correction.
+type optimizerState struct {
+	config   SGDConfig
+	velocity map[int][]float64
+	second   map[int][]float64
+	step     map[int]int
+}
+
+func newOptimizerState(config SGDConfig) *optimizerState {
+	return &optimizerState{
+		config:   config,
+		velocity: make(map[int][]float64),
+		second:   make(map[int][]float64),
+		step:     make(map[int]int),
+	}
+}
+
+func (s *optimizerState) update(id int, latent, grad []float64, learnRate float64) {
+	switch s.config.Optimizer {
+	case OptimizerMomentum:
+		if s.velocity[id] == nil {
+			s.velocity[id] = make([]float64, len(latent))
+		}
+
+		for k := range latent {
+			s.velocity[id][k] = s.config.Momentum*s.velocity[id][k] - learnRate*grad[k]
+			latent[k] += s.velocity[id][k]
+		}
+	case OptimizerAdam:
+		if s.velocity[id] == nil {
+			s.velocity[id] = make([]float64, len(latent))
+			s.second[id] = make([]float64, len(latent))
+		}
+
+		s.step[id] += 1
+		firstCorrection := 1 - math.Pow(s.config.Beta1, float64(s.step[id]))
+		secondCorrection := 1 - math.Pow(s.config.Beta2, float64(s.step[id]))
+		for k := range latent {
+			s.velocity[id][k] = s.config.Beta1*s.velocity[id][k] + (1-s.config.Beta1)*grad[k]
+			s.second[id][k] = s.config.Beta2*s.second[id][k] + (1-s.config.Beta2)*grad[k]*grad[k]
+			firstMoment := s.velocity[id][k] / firstCorrection
+			secondMoment := s.second[id][k] / secondCorrection
+			latent[k] -= learnRate * firstMoment / (math.Sqrt(secondMoment) + s.config.Epsilon)
+		}
+	default:
+		for k := range latent {
+			latent[k] -= learnRate * grad[k]
+		}
+	}
+}
+
+// TrainSGD performs stochastic gradient descent over the observed training ratings. Ratings are shuffled at the start
+// of every epoch. Each rating only touches the latent vectors of one user and one movie, so an update costs O(K)
+// instead of recomputing every prediction like the full batch gradients do.
+func (f *IterativeFactorizer) TrainSGD(config SGDConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	samples := make([]ratingSample, 0)
+	for userID := range f.TrainingUserMovieRatingMap {
+		for movieID, value := range f.TrainingUserMovieRatingMap[userID] {
+			samples = append(samples, ratingSample{UserID: userID, MovieID: movieID, Value: value})
+		}
+	}
+
+	userState := newOptimizerState(config)
+	movieState := newOptimizerState(config)
+
+	bestRootMeanSqError := math.Inf(1)
+	var bestUserLatentMap, bestMovieLatentMap map[int][]float64
+	epochsWithoutImprovement := 0
+
+	for epoch := 0; epoch < config.Epochs; epoch += 1 {
+		// Fisher-Yates shuffle
+		for i := len(samples) - 1; i > 0; i -= 1 {
+			j := rand.Intn(i + 1)
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+
+		learnRate := config.LearnRate / (1 + config.Decay*float64(epoch))
+
+		for start := 0; start < len(samples); start += config.BatchSize {
+			end := start + config.BatchSize
+			if end > len(samples) {
+				end = len(samples)
+			}
+
+			if err := f.stepBatch(samples[start:end], config.Reg, learnRate, userState, movieState); err != nil {
+				return err
+			}
+		}
+
+		loss, rootMeanSqError, err := f.Loss(config.Reg)
+		if err != nil {
+			return err
+		}
+
+		logMessage := fmt.Sprintf(`epoch %3d: net loss %5.2f and RMSE %1.8f with learning rate %1.6f`,
+			epoch, loss, rootMeanSqError, learnRate)
+		logrus.WithField("file", "lowrank.sgd").Info(logMessage)
+
+		if config.Patience == 0 {
+			continue
+		}
+
+		if rootMeanSqError < bestRootMeanSqError {
+			bestRootMeanSqError = rootMeanSqError
+			bestUserLatentMap = copyLatentMap(f.UserLatentMap)
+			bestMovieLatentMap = copyLatentMap(f.MovieLatentMap)
+			epochsWithoutImprovement = 0
+		} else {
+			epochsWithoutImprovement += 1
+		}
+
+		if epochsWithoutImprovement >= config.Patience {
+			logrus.WithField("file", "lowrank.sgd").Infof(
+				"early stopping at epoch %d, best RMSE is %1.8f", epoch, bestRootMeanSqError)
+			break
+		}
+	}
+
+	if bestUserLatentMap != nil {
+		f.UserLatentMap = bestUserLatentMap
+		f.MovieLatentMap = bestMovieLatentMap
+	}
+
+	return nil
+}
+
+// stepBatch accumulates the gradients of every user and movie latent vector that appears in the batch, averages them
+// over the batch size and applies one optimizer update to each of them.
+func (f *IterativeFactorizer) stepBatch(batch []ratingSample, reg, learnRate float64, userState,
+	movieState *optimizerState) error {
+	userGradMap := make(map[int][]float64)
+	movieGradMap := make(map[int][]float64)
+
+	for _, sample := range batch {
+		userLatent := f.UserLatentMap[sample.UserID]
+		movieLatent := f.MovieLatentMap[sample.MovieID]
+
+		predictedRating, err := DotProduct(userLatent, movieLatent)
+		if err != nil {
+			return err
+		}
+
+		if userGradMap[sample.UserID] == nil {
+			userGradMap[sample.UserID] = make([]float64, len(userLatent))
+		}
+
+		if movieGradMap[sample.MovieID] == nil {
+			movieGradMap[sample.MovieID] = make([]float64, len(movieLatent))
+		}
+
+		residual := sample.Value - predictedRating
+		for k := 0; k < len(userLatent); k += 1 {
+			userGradMap[sample.UserID][k] += -1.0*residual*movieLatent[k] + reg*userLatent[k]
+			movieGradMap[sample.MovieID][k] += -1.0*residual*userLatent[k] + reg*movieLatent[k]
+		}
+	}
+
+	batchSize := float64(len(batch))
+	for userID, grad := range userGradMap {
+		for k := range grad {
+			grad[k] /= batchSize
+		}
+
+		userState.update(userID, f.UserLatentMap[userID], grad, learnRate)
+	}
+
+	for movieID, grad := range movieGradMap {
+		for k := range grad {
+			grad[k] /= batchSize
+		}
+
+		movieState.update(movieID, f.MovieLatentMap[movieID], grad, learnRate)
+	}
+
+	return nil
+}
+
+func copyLatentMap(latentMap map[int][]float64) map[int][]float64 {
+	copied := make(map[int][]float64, len(latentMap))
+	for id, latent := range latentMap {
+		copied[id] = make([]float64, len(latent))
+		copy(copied[id], latent)
+	}
+
+	return copied
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package lowrank provides tools to perform low rank factorization on latent features of movies and users.
+package lowrank
+
+import (
+	"gonum.org/v1/gonum/mat"
+	"sort"
+)
+
+// SparseMatrix stores only the observed entries of a rating matrix in compressed sparse row (CSR) format. The column
+// indices and values of row i are ColIndex[RowPtr[i]:RowPtr[i+1]] and Value[RowPtr[i]:RowPtr[i+1]]. A MovieLens rating
+// matrix is more than 99% empty, so storing it densely wastes almost all of its memory.
+type SparseMatrix struct {
+	NumRow   int
+	NumCol   int
+	RowPtr   []int
+	ColIndex []int
+	Value    []float64
+}
+
+// NewSparseMatrix builds a CSR matrix from a map of row index to a map of column index to value. Columns within each
+// row are sorted in ascending order.
+func NewSparseMatrix(I, J int, entries map[int]map[int]float64) *SparseMatrix {
+	nnz := 0
+	for _, row := range entries {
+		nnz += len(row)
+	}
+
+	S := &SparseMatrix{
+		NumRow:   I,
+		NumCol:   J,
+		RowPtr:   make([]int, I+1),
+		ColIndex: make([]int, 0, nnz),
+		Value:    make([]float64, 0, nnz),
+	}
+
+	for i := 0; i < I; i += 1 {
+		cols := make([]int, 0, len(entries[i]))
+		for j := range entries[i] {
+			cols = append(cols, j)
+		}
+		sort.Ints(cols)
+
+		for _, j := range cols {
+			S.ColIndex = append(S.ColIndex, j)
+			S.Value = append(S.Value, entries[i][j])
+		}
+
+		S.RowPtr[i+1] = len(S.ColIndex)
+	}
+
+	return S
+}
+
+// NewSparseMatrixFromDense treats every zero entry of a dense matrix as a missing value.
+func NewSparseMatrixFromDense(D *mat.Dense) *SparseMatrix {
+	I, J := D.Dims()
+	entries := make(map[int]map[int]float64)
+	for i := 0; i < I; i += 1 {
+		entries[i] = make(map[int]float64)
+		for j := 0; j < J; j += 1 {
+			if D.At(i, j) != 0 {
+				entries[i][j] = D.At(i, j)
+			}
+		}
+	}
+
+	return NewSparseMatrix(I, J, entries)
+}
+
+func (S *SparseMatrix) Dims() (int, int) {
+	return S.NumRow, S.NumCol
+}
+
+// NNZ returns the number of observed entries.
+func (S *SparseMatrix) NNZ() int {
+	return len(S.Value)
+}
+
+// Do calls fn on every observed entry in row major order.
+func (S *SparseMatrix) Do(fn func(i, j int, value float64)) {
+	for i := 0; i < S.NumRow; i += 1 {
+		for n := S.RowPtr[i]; n < S.RowPtr[i+1]; n += 1 {
+			fn(i, S.ColIndex[n], S.Value[n])
+		}
+	}
+}
@@ -5,11 +5,19 @@ package main
 
 import (
 	"fmt"
-	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"os"
-	"popcorn/model"
+	"popcorn/ann"
+	"popcorn/content"
+	"popcorn/handler"
+	"popcorn/hub"
+	"popcorn/jobs"
+	"popcorn/ratelimit"
+	"popcorn/retrain"
+	"popcorn/search"
+	"runtime"
+	"strconv"
 	"time"
 )
 
@@ -33,19 +41,54 @@ func main() {
 
 	defer db.Close()
 
-	// Client connection map is meant for keeping track of all web socket connection to every client. It is also being
+	handler.TrustedProxyHops = trustedProxyHops()
+
+	// Client connection hub is meant for keeping track of all web socket connection to every client. It is also being
 	// used in the recommend engine for notifying clients that their preference vector is ready.
-	clientConnMap := make(map[uint]*websocket.Conn)
+	connHub := hub.New()
 
-	// This is the channel for communication between http handlers and a background running engine asynchronously.
-	updateUserPreferenceQueue := make(chan *model.User, 100)
+	// Handlers hand preference updates to a pool of online learning workers through a queue that is persisted in the
+	// database, so no update is lost when the workers are busy or the server restarts.
+	preferenceQueue := jobs.NewPreferenceQueue(db)
 
 	// Set up online learning engine for serving the incoming requests.
-	engine := NewOnlineLearningEngine(db, clientConnMap)
-	go engine.ListenToInbound(updateUserPreferenceQueue)
+	engine := NewOnlineLearningEngine(db, connHub)
+	if err := preferenceQueue.Start(numPreferenceWorker(), engine.RecomputePreference); err != nil {
+		logrus.Error("Failed to start preference workers", err)
+		return
+	}
+
+	// Movie features are served from the active model version in the registry, which may be switched at any time by
+	// cmd/model. Personalized recommendations are retrieved from an index over those features, the first one is built
+	// before the server starts listening and later ones are swapped in by the watcher. Content recommendations are
+	// retrieved the same way from an index over genres and tags, similar movies from an index over the features scaled
+	// to unit length, and movie search from an index over titles.
+	movieIndex := ann.NewLive(nil)
+	similarityIndex := ann.NewLive(nil)
+	contentIndex := content.NewLive(nil)
+	searchIndex := search.NewLive(nil)
+	rebuildIndices(db, movieIndex, similarityIndex, contentIndex, searchIndex)
+
+	go WatchActiveModel(db, preferenceQueue, movieIndex, similarityIndex, contentIndex, searchIndex)
+
+	// Retraining on the ratings of app users is optional, because it needs the MovieLens dataset on disk. The watcher
+	// picks up every version it activates.
+	if interval, err := time.ParseDuration(os.Getenv("RETRAIN_INTERVAL")); err == nil && interval > 0 {
+		if datasetDir := os.Getenv("RETRAIN_DATASET_DIR"); datasetDir != "" {
+			logrus.Infof("Retraining on ratings of app users every %v", interval)
+			config := retrain.DefaultConfig(datasetDir)
+			config.Implicit = os.Getenv("RETRAIN_IMPLICIT") == "true"
+			go retrain.Schedule(db, config, interval)
+		}
+	}
+
+	// Rate limits are kept in memory, so every server process enforces them on its own. Another ratelimit.Store, e.g.
+	// one backed by Redis, makes them hold across processes.
+	rateLimitStore := ratelimit.NewMemoryStore()
 
 	server := &http.Server{
-		Handler:      LoadRoutes(db, updateUserPreferenceQueue),
+		Handler: LoadRoutes(db, preferenceQueue, movieIndex, similarityIndex, contentIndex, searchIndex, connHub,
+			rateLimitStore),
 		Addr:         port,
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
@@ -54,3 +97,23 @@ func main() {
 	logrus.Infof("HTTP server is listening and serving on port %v", port)
 	logrus.Fatal(server.ListenAndServe())
 }
+
+// trustedProxyHops reads the number of proxies in front of the server from TRUSTED_PROXY_HOPS, it defaults to none so
+// that clients cannot pick their own address with X-Forwarded-For.
+func trustedProxyHops() int {
+	if hops, err := strconv.Atoi(os.Getenv("TRUSTED_PROXY_HOPS")); err == nil && hops > 0 {
+		return hops
+	}
+
+	return 0
+}
+
+// numPreferenceWorker reads the size of the preference worker pool from PREFERENCE_WORKERS, it defaults to the number
+// of CPUs because folding a user into the model is CPU bound.
+func numPreferenceWorker() int {
+	if numWorker, err := strconv.Atoi(os.Getenv("PREFERENCE_WORKERS")); err == nil && numWorker > 0 {
+		return numWorker
+	}
+
+	return runtime.NumCPU()
+}
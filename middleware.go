@@ -4,8 +4,14 @@
 package main
 
 import (
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"popcorn/handler"
+	"popcorn/ratelimit"
+	"strconv"
 )
 
 type HttpMiddleware func(http.Handler) http.Handler
@@ -18,3 +24,139 @@ func NewServerLoggingMiddleware() HttpMiddleware {
 		})
 	}
 }
+
+// NewRateLimitMiddleware rejects requests with 429 Too Many Requests once the client has used up its requests under the
+// policy of the limiter, with a Retry-After header telling when to try again. It must run after the authentication
+// middleware for the limit per user to apply. Requests are let through when the store fails, a broken rate limiter
+// should not take the site down.
+func NewRateLimitMiddleware(limiter *ratelimit.Limiter) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var userID uint
+			if user := handler.CurrentUser(r); user != nil {
+				userID = user.ID
+			}
+
+			if !allowRequest(w, limiter, handler.ClientIP(r), userID) {
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowRequest takes a token from the buckets of the client under the limiter, or renders 429 Too Many Requests and
+// returns false when they are empty.
+func allowRequest(w http.ResponseWriter, limiter *ratelimit.Limiter, ip string, userID uint) bool {
+	allowed, retryAfter, err := limiter.Allow(ip, userID)
+	if err != nil {
+		logrus.WithField("src", "middleware").Error("failed to apply rate limit", err)
+	}
+
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfter(retryAfter)))
+		handler.RenderError(w, "too many requests, please try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
+
+type contextKey string
+
+const scopeAllowedKey contextKey = "scope_allowed"
+
+// NewAuthenticationMiddleware resolves the API token in the Authorization header, or else the session cookie, of every
+// request and puts it and its user on the request context, where handlers find them with handler.CurrentAPIToken,
+// handler.CurrentSession and handler.CurrentUser. A request with a bearer token that is not valid is rejected, since
+// the client meant to authenticate. Requests without either pass through anonymously, endpoints that need a user are
+// wrapped in one of the require middlewares. Requests with a bearer token are limited by client IP under the token
+// limiter before the token is looked up, otherwise tokens could be guessed as fast as the server answers.
+func NewAuthenticationMiddleware(db *gorm.DB, tokenLimiter *ratelimit.Limiter) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, ok := handler.BearerToken(r); ok {
+				if !allowRequest(w, tokenLimiter, handler.ClientIP(r), 0) {
+					return
+				}
+
+				apiToken, err := handler.UseAPIToken(db, token)
+				if err != nil {
+					handler.RenderError(w, "API token is not valid or has been revoked", http.StatusUnauthorized)
+					return
+				}
+
+				r = handler.WithCurrentAPIToken(r, apiToken)
+			} else if session := handler.ResumeSession(db, w, r); session != nil {
+				r = handler.WithCurrentSession(r, session)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// allowScope lets requests authenticated by an API token with the scope through to the endpoint. API tokens are
+// rejected by the require middlewares unless the endpoint allows one of their scopes, requests authenticated by a
+// session are not affected.
+func allowScope(scope string) HttpMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiToken := handler.CurrentAPIToken(r); apiToken != nil {
+				if !apiToken.HasScope(scope) {
+					handler.RenderError(w, "API token does not have the "+scope+" scope", http.StatusForbidden)
+					return
+				}
+
+				r = r.WithContext(context.WithValue(r.Context(), scopeAllowedKey, true))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireUser rejects anonymous requests, and requests authenticated by an API token unless the endpoint allows one
+// of its scopes.
+func requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler.CurrentUser(r) == nil {
+			handler.RenderError(w, "user is not authenticated", http.StatusUnauthorized)
+			return
+		}
+
+		if handler.CurrentAPIToken(r) != nil && r.Context().Value(scopeAllowedKey) == nil {
+			handler.RenderError(w, "API tokens cannot be used here, please sign in", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin rejects requests of users who are not admins.
+func requireAdmin(next http.Handler) http.Handler {
+	return requireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !handler.CurrentUser(r).IsAdmin() {
+			handler.RenderError(w, "only admins may do this", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// requireSelf rejects requests for the data of another user, identified by the id variable of the route, unless the
+// current user is an admin.
+func requireSelf(next http.Handler) http.Handler {
+	return requireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+		if err != nil || !handler.CurrentUser(r).CanActFor(uint(userID)) {
+			handler.RenderError(w, "users may only access their own data", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// Scopes of API tokens. A token may only be used on the endpoints of its scopes; managing sessions, tokens and groups
+// and everything that needs an admin always requires signing in.
+const (
+	ScopeReadRatings  = "read-ratings"
+	ScopeWriteRatings = "write-ratings"
+	ScopeRecommend    = "recommend"
+)
+
+// Scopes lists every scope an API token can be given.
+var Scopes = []string{ScopeReadRatings, ScopeWriteRatings, ScopeRecommend}
+
+// APIToken is a personal access token for scripts and other clients that cannot keep a session cookie. Like sessions,
+// only the digest of the token is stored, the token itself is shown once when it is created. Prefix is the beginning of
+// the token, which is enough for users to tell their tokens apart.
+type APIToken struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+
+	// Foreign keys
+	UserID uint `gorm:"index" json:"-"`
+	User   User `json:"-"`
+
+	// Token attributes
+	Name        string         `gorm:"type:varchar(100)"             json:"name"`
+	Prefix      string         `gorm:"type:varchar(20)"              json:"prefix"`
+	TokenDigest string         `gorm:"type:varchar(64);unique_index" json:"-"`
+	Scopes      pq.StringArray `gorm:"type:text[]"                   json:"scopes"`
+	LastUsedAt  *time.Time     `json:"last_used_at"`
+	RevokedAt   *time.Time     `json:"revoked_at"`
+}
+
+// HasScope reports whether the token may be used on the endpoints of the scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import "time"
+
+// Group is a party of users who want to pick a movie together, e.g. a movie night with friends and family. Members are
+// joined through the group_members table so that a user can belong to many groups, and users join by accepting a
+// GroupInvitation.
+type Group struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+
+	// Group base attributes
+	Name    string `gorm:"type:varchar(100)"       json:"name"`
+	OwnerID uint   `gorm:"type:integer;index"      json:"owner_id"`
+	Members []User `gorm:"many2many:group_members" json:"members"`
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import "time"
+
+// GroupInvitation asks a user to join a group. Users only become members by accepting an invitation, since members of a
+// group see each other and get recommendations from each other's taste.
+type GroupInvitation struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+
+	// Foreign keys, a user is invited to a group at most once
+	GroupID uint  `gorm:"unique_index:idx_group_invitations_group_user" json:"group_id"`
+	Group   Group `json:"-"`
+	UserID  uint  `gorm:"unique_index:idx_group_invitations_group_user" json:"user_id"`
+	User    User  `json:"-"`
+}
@@ -5,7 +5,9 @@ package model
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 )
 
 func GenerateRandomBytes(n int) ([]byte, error) {
@@ -22,3 +24,10 @@ func GenerateRandomString(length int) (string, error) {
 	bytes, err := GenerateRandomBytes(length)
 	return base64.URLEncoding.EncodeToString(bytes), err
 }
+
+// HashToken returns the hex encoded SHA-256 digest of a token. Tokens are random and long, so a plain digest is enough
+// to keep a leaked table from being usable without slowing down every request the way a password hash would.
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
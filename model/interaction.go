@@ -0,0 +1,34 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import "time"
+
+// Kinds of implicit feedback that are collected while a user browses movies.
+const (
+	InteractionSkip        = "skip"
+	InteractionDetailView  = "detail_view"
+	InteractionTrailerView = "trailer_view"
+)
+
+// InteractionWeights maps each kind of interaction to how strongly it signals interest in a movie. Skipping a movie is
+// negative feedback, watching its trailer is a stronger positive signal than opening its detail.
+var InteractionWeights = map[string]float64{
+	InteractionSkip:        -1.0,
+	InteractionDetailView:  1.0,
+	InteractionTrailerView: 2.0,
+}
+
+// Interaction is an implicit feedback event. Unlike ratings, users never submit them deliberately; they are recorded
+// when a user skips a recommendation or looks at the detail or trailer of a movie.
+type Interaction struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Foreign Keys
+	UserID  uint   `gorm:"index"           json:"user_id"`
+	MovieID uint   `gorm:"index"           json:"movie_id"`
+	Kind    string `gorm:"type:varchar(20)" json:"kind"`
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import "time"
+
+// LoginFailure counts the failed sign ins to a username from one IP address. It is kept for usernames that do not
+// exist as well, so that a lockout says nothing about which accounts exist, and it is keyed by address so that nobody
+// can lock another user out of their account from elsewhere. The row with an empty IP address counts the failures to
+// the username from every address, it only ever delays sign ins briefly.
+type LoginFailure struct {
+	// Model base class attributes
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time `gorm:"index"`
+
+	// Login failure attributes, sign ins are refused until LockedUntil once there are too many failures in a row
+	Username    string `gorm:"type:varchar(100);unique_index:idx_login_failures_username_ip"`
+	IPAddress   string `gorm:"type:varchar(100);unique_index:idx_login_failures_username_ip"`
+	Count       int    `gorm:"type:integer"`
+	LockedUntil *time.Time
+}
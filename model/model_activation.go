@@ -0,0 +1,18 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import "time"
+
+// ModelActivation records that a model version was activated. Together the activations that were not rolled back are
+// the history of served versions, newest last, and a rollback walks back along it one version at a time.
+type ModelActivation struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Model activation attributes
+	ModelVersionID uint `gorm:"index" json:"model_version_id"`
+	RolledBack     bool `gorm:"index" json:"rolled_back"`
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ModelVersion is a trained factorization model in the registry. The artifact holds the binary latent matrices written
+// by lowrank.Artifact, while the remaining columns describe the model so that versions can be compared without reading
+// the artifact. Exactly one version is active at a time, and the active version is the one whose features are served.
+type ModelVersion struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+
+	// Model version base attributes
+	Algorithm       string          `gorm:"type:varchar(20)" json:"algorithm"`
+	FeatureDim      int             `gorm:"type:integer"     json:"feature_dim"`
+	Hyperparameters json.RawMessage `gorm:"type:bytea"       json:"hyperparameters"`
+	RootMeanSqError float64         `gorm:"type:float8"      json:"rmse"`
+	DatasetHash     string          `gorm:"type:varchar(64)" json:"dataset_hash"`
+	Artifact        []byte          `gorm:"type:bytea"       json:"-"`
+	Active          bool            `gorm:"index"            json:"active"`
+	ActivatedAt     *time.Time      `json:"activated_at"`
+}
@@ -25,13 +25,24 @@ type Movie struct {
 	IMDBRating float64 `gorm:"type:float8;column:imdb_rating"   json:"-"`
 
 	// NumRating is the number of ratings of this movie received from MovieLens dataset, while average rating is the
-	// average of all the ratings received from MovieLens users.
-	NumRating     		int             `gorm:"type:integer"  json:"num_rating"`
-	ClusterID     		uint            `gorm:"type:integer"  json:"cluster_id"`
-	AverageRating 		float64         `gorm:"type:float8"   json:"average_rating"`
-	Feature       		pq.Float64Array `gorm:"type:float8[]" json:"-"`
-	NearestClusters   pq.StringArray  `gorm:"type:text[]"   json:"-"`
-	FarthestClusters  pq.StringArray  `gorm:"type:text[]"   json:"-"`
+	// average of all the ratings received from MovieLens users. Bias is learned together with the latent feature by the
+	// biased factorization model; it already includes the global mean rating of the training set.
+	NumRating        int             `gorm:"type:integer"  json:"num_rating"`
+	ClusterID        uint            `gorm:"type:integer"  json:"cluster_id"`
+	AverageRating    float64         `gorm:"type:float8"   json:"average_rating"`
+	Feature          pq.Float64Array `gorm:"type:float8[]" json:"-"`
+	Bias             float64         `gorm:"type:float8"   json:"-"`
+	NearestClusters  pq.StringArray  `gorm:"type:text[]"   json:"-"`
+	FarthestClusters pq.StringArray  `gorm:"type:text[]"   json:"-"`
+
+	// Genres come from the MovieLens catalog and tags are the free text labels that MovieLens users attached to the
+	// movie, most frequent first. Both are known for movies that nobody has rated.
+	Genres pq.StringArray `gorm:"type:text[]" json:"genres"`
+	Tags   pq.StringArray `gorm:"type:text[]" json:"tags"`
+
+	// ModelVersionID is the registered model version that produced the feature and bias, zero if they were seeded from
+	// CSV files without going through the model registry.
+	ModelVersionID uint `gorm:"type:integer;index" json:"-"`
 
 	// The ratings here are submitted by the users of our web application, which is different from the ratings that came
 	// from the MovieLens data set.
@@ -0,0 +1,35 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import "time"
+
+// Statuses of a preference job.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// PreferenceJob asks the online learning engine to recompute the latent preference of a user. There is at most one job
+// per user; enqueueing a user who already has a pending job does nothing, and enqueueing a user whose job is running
+// marks it to run once more after it finishes, so a burst of ratings is learned from in one or two runs.
+type PreferenceJob struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Foreign keys
+	UserID uint `gorm:"unique_index" json:"user_id"`
+
+	// Job attributes
+	Status     string     `gorm:"type:varchar(10);index" json:"status"`
+	Rerun      bool       `json:"rerun"`
+	Attempts   int        `gorm:"type:integer"           json:"attempts"`
+	Error      string     `gorm:"type:text"              json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
@@ -5,14 +5,16 @@ package model
 
 import "time"
 
+// Rating is the rating a user of our web application gave to a movie. A user has at most one rating per movie, rating a
+// movie again updates the value of the existing rating.
 type Rating struct {
 	// Model base class attributes
-	ID        uint      `gorm:"primary_key" json:"-"`
+	ID        uint      `gorm:"primary_key" json:"id"`
 	CreatedAt time.Time `json:"-"`
 	UpdatedAt time.Time `json:"-"`
 
 	// Foreign Keys
-	UserID  uint    `json:"user_id"`
-	MovieID uint    `json:"movie_id"`
-	Value   float64 `gorm:"type:float8" json:"rating"`
+	UserID  uint    `gorm:"unique_index:idx_ratings_user_movie" json:"user_id"`
+	MovieID uint    `gorm:"unique_index:idx_ratings_user_movie" json:"movie_id"`
+	Value   float64 `gorm:"type:float8"                         json:"rating"`
 }
@@ -0,0 +1,34 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package model
+
+import "time"
+
+// Session is a device that a user has signed in on. Every sign in creates a session with its own token, so signing out
+// on one device leaves the others signed in. Only the digest of the token is stored; the token itself lives in the
+// session cookie of the device.
+type Session struct {
+	// Model base class attributes
+	ID        uint      `gorm:"primary_key" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"-"`
+
+	// Foreign keys
+	UserID uint `gorm:"index" json:"-"`
+	User   User `json:"-"`
+
+	// Session attributes. A session expires when it has not been used for a while or when it has reached its maximum
+	// lifetime, whichever comes first, and it is revoked when the user signs out.
+	TokenDigest string     `gorm:"type:varchar(64);unique_index" json:"-"`
+	UserAgent   string     `gorm:"type:varchar(500)"             json:"user_agent"`
+	IPAddress   string     `gorm:"type:varchar(100)"             json:"ip_address"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+	ExpiresAt   time.Time  `gorm:"index"                         json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the session can still authenticate requests.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -8,6 +8,12 @@ import (
 	"time"
 )
 
+// Roles of users. Admins may act on behalf of every user and list every user, group and background job.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	// Model base class attributes
 	ID        uint      `gorm:"primary_key" json:"id"`
@@ -15,15 +21,21 @@ type User struct {
 	UpdatedAt time.Time `json:"-"`
 
 	// User base attributes
-	Username       string          `gorm:"type:varchar(100);unique_index" json:"username"`
-	Preference     pq.Float64Array `gorm:"type:float8[]"                  json:"preference"`
-	SessionToken   string          `gorm:"type:varchar(100);unique_index" json:"-"`
-	PasswordDigest []byte          `gorm:"type:bytea"                     json:"-"`
-	Ratings        []Rating        `gorm:"ForeignKey:UserID"              json:"-"`
+	Username       string          `gorm:"type:varchar(100);unique_index"  json:"username"`
+	Preference     pq.Float64Array `gorm:"type:float8[]"                   json:"preference"`
+	Bias           float64         `gorm:"type:float8"                     json:"-"`
+	PasswordDigest []byte          `gorm:"type:bytea"                      json:"-"`
+	Ratings        []Rating        `gorm:"ForeignKey:UserID"               json:"-"`
+	Role           string          `gorm:"type:varchar(20);default:'user'" json:"role"`
+}
+
+// IsAdmin reports whether the user has the admin role.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
 }
 
-func (u *User) ResetSessionToken() {
-	if randStr, err := GenerateRandomString(20); err == nil {
-		u.SessionToken = randStr
-	}
+// CanActFor reports whether the user may read or change the data of the user with the given ID, which is their own
+// data unless they are an admin.
+func (u *User) CanActFor(userID uint) bool {
+	return u.ID == userID || u.IsAdmin()
 }
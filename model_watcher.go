@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"popcorn/ann"
+	"popcorn/content"
+	"popcorn/jobs"
+	"popcorn/model"
+	"popcorn/registry"
+	"popcorn/search"
+	"time"
+)
+
+// ModelSyncInterval is how often the server checks whether another model version has been activated.
+const ModelSyncInterval = time.Minute
+
+// WatchActiveModel keeps the movie features in sync with the active model version in the registry. Preferences of
+// every user were learned against the features of the previous model, so they are recomputed whenever it changes.
+// The movie, similarity, content and search indices are rebuilt whenever the movies table changes, whether by a model
+// version or by a reseed.
+func WatchActiveModel(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue, movieIndex, similarityIndex *ann.Live,
+	contentIndex *content.Live, searchIndex *search.Live) {
+	var lastFingerprint movieFingerprint
+	for {
+		version, changed, err := registry.Sync(db)
+		if err != nil {
+			logrus.WithField("src", "main.watcher").Error("failed to sync with the active model version", err)
+		} else if changed {
+			logrus.WithField("src", "main.watcher").Infof("serving features of model version %d", version.ID)
+			recomputeAllPreferences(db, preferenceQueue)
+		}
+
+		if fingerprint, err := fingerprintMovies(db); err != nil {
+			logrus.WithField("src", "main.watcher").Error("failed to check movies for changes", err)
+		} else if movieIndex.Index() == nil || similarityIndex.Index() == nil || contentIndex.Index() == nil ||
+			searchIndex.Index() == nil || !fingerprint.Equal(lastFingerprint) {
+			if rebuildIndices(db, movieIndex, similarityIndex, contentIndex, searchIndex) {
+				lastFingerprint = fingerprint
+			}
+		}
+
+		time.Sleep(ModelSyncInterval)
+	}
+}
+
+// rebuildIndices builds every index and swaps in those that succeed. It reports whether all of them were built.
+func rebuildIndices(db *gorm.DB, movieIndex, similarityIndex *ann.Live, contentIndex *content.Live,
+	searchIndex *search.Live) bool {
+	ok := true
+	if index, err := BuildMovieIndex(db); err != nil {
+		logrus.WithField("src", "main.watcher").Error("failed to build movie index", err)
+		ok = false
+	} else {
+		movieIndex.Swap(index)
+		logrus.WithField("src", "main.watcher").Infof("movie index is built with %d movies", index.Len())
+	}
+
+	if index, err := BuildSimilarityIndex(db); err != nil {
+		logrus.WithField("src", "main.watcher").Error("failed to build similarity index", err)
+		ok = false
+	} else {
+		similarityIndex.Swap(index)
+		logrus.WithField("src", "main.watcher").Infof("similarity index is built with %d movies", index.Len())
+	}
+
+	if index, err := BuildContentIndex(db); err != nil {
+		logrus.WithField("src", "main.watcher").Error("failed to build content index", err)
+		ok = false
+	} else {
+		contentIndex.Swap(index)
+		logrus.WithField("src", "main.watcher").Infof("content index is built with %d movies", index.Len())
+	}
+
+	if index, err := BuildSearchIndex(db); err != nil {
+		logrus.WithField("src", "main.watcher").Error("failed to build search index", err)
+		ok = false
+	} else {
+		searchIndex.Swap(index)
+		logrus.WithField("src", "main.watcher").Infof("search index is built with %d movies", index.Len())
+	}
+
+	return ok
+}
+
+func recomputeAllPreferences(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue) {
+	var userIDs []uint
+	err := db.Model(&model.User{}).
+		Where("id in (select user_id from ratings) or array_length(preference, 1) > 0").
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		logrus.WithField("src", "main.watcher").Error("failed to load users for recomputing preferences", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		if err := preferenceQueue.Enqueue(userID); err != nil {
+			logrus.WithField("src", "main.watcher").Error("failed to enqueue preference update", err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"popcorn/model"
+	"sync"
+)
+
+// MovieCache keeps the features and biases of every movie in memory. The movies are loaded again only when their
+// fingerprint changes, which is far cheaper to check than loading them.
+type MovieCache struct {
+	mutex       sync.Mutex
+	fingerprint movieFingerprint
+	movies      []model.Movie
+}
+
+// Movies returns every movie ordered by ID with its feature and bias. The returned slice is shared by every caller and
+// must not be modified.
+func (c *MovieCache) Movies(db *gorm.DB) ([]model.Movie, error) {
+	fingerprint, err := fingerprintMovies(db)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.movies != nil && fingerprint.Equal(c.fingerprint) {
+		return c.movies, nil
+	}
+
+	var movies []model.Movie
+	if err := db.Select("id, feature, bias").Order("id asc").Find(&movies).Error; err != nil {
+		return nil, err
+	}
+
+	c.movies = movies
+	c.fingerprint = fingerprint
+
+	return movies, nil
+}
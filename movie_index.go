@@ -0,0 +1,172 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"gonum.org/v1/gonum/floats"
+	"math"
+	"popcorn/ann"
+	"popcorn/content"
+	"popcorn/model"
+	"popcorn/search"
+	"time"
+)
+
+// BuildMovieIndex builds a maximum inner product index over the latent features of every movie. Each feature vector is
+// extended with the movie bias, so a query made of the user preference extended with a one scores a movie by its
+// predicted rating less the user bias.
+func BuildMovieIndex(db *gorm.DB) (*ann.Index, error) {
+	movies, featureDim, err := loadFeatures(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(movies))
+	vectors := make([][]float64, 0, len(movies))
+	for _, movie := range movies {
+		vector := make([]float64, featureDim+1)
+		copy(vector, movie.Feature)
+		vector[featureDim] = movie.Bias
+
+		ids = append(ids, movie.ID)
+		vectors = append(vectors, vector)
+	}
+
+	return ann.NewIndex(ids, vectors, ann.DefaultConfig())
+}
+
+// BuildSimilarityIndex builds an index over the latent features of every movie scaled to unit length, where the inner
+// product of two movies is the cosine similarity of their features.
+func BuildSimilarityIndex(db *gorm.DB) (*ann.Index, error) {
+	movies, _, err := loadFeatures(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(movies))
+	vectors := make([][]float64, 0, len(movies))
+	for _, movie := range movies {
+		norm := math.Sqrt(floats.Dot(movie.Feature, movie.Feature))
+		if norm == 0 {
+			continue
+		}
+
+		vector := make([]float64, len(movie.Feature))
+		for i, value := range movie.Feature {
+			vector[i] = value / norm
+		}
+
+		ids = append(ids, movie.ID)
+		vectors = append(vectors, vector)
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("no movies have non-zero latent features")
+	}
+
+	return ann.NewIndex(ids, vectors, ann.DefaultConfig())
+}
+
+// loadFeatures returns the id, feature and bias of every movie that has a latent feature of the most common dimension,
+// together with that dimension. Movies that were left out of the model can have a feature vector of a different
+// dimension when the seeded CSV files are mixed with a registered model.
+func loadFeatures(db *gorm.DB) ([]*model.Movie, int, error) {
+	var movies []*model.Movie
+	if err := db.Select("id, feature, bias").Where("array_length(feature, 1) > 0").Find(&movies).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if len(movies) == 0 {
+		return nil, 0, errors.New("no movies have latent features")
+	}
+
+	dimCount := make(map[int]int)
+	for _, movie := range movies {
+		dimCount[len(movie.Feature)] += 1
+	}
+
+	featureDim := 0
+	for dim, count := range dimCount {
+		if count > dimCount[featureDim] {
+			featureDim = dim
+		}
+	}
+
+	served := make([]*model.Movie, 0, dimCount[featureDim])
+	for _, movie := range movies {
+		if len(movie.Feature) == featureDim {
+			served = append(served, movie)
+		}
+	}
+
+	return served, featureDim, nil
+}
+
+// BuildContentIndex builds a TF-IDF index over the genres and tags of every movie. Movies seeded before genres and tags
+// were loaded have neither, the index is then empty and content recommendations are unavailable until a reseed.
+func BuildContentIndex(db *gorm.DB) (*content.Index, error) {
+	var movies []*model.Movie
+	err := db.Select("id, genres, tags").
+		Where("array_length(genres, 1) > 0 or array_length(tags, 1) > 0").
+		Find(&movies).Error
+	if err != nil {
+		return nil, err
+	}
+
+	termsByMovieID := make(map[uint][]string)
+	for _, movie := range movies {
+		termsByMovieID[movie.ID] = content.Terms(movie.Genres, movie.Tags)
+	}
+
+	return content.NewIndex(termsByMovieID), nil
+}
+
+// BuildSearchIndex builds a title search index over every movie.
+func BuildSearchIndex(db *gorm.DB) (*search.Index, error) {
+	var movies []*model.Movie
+	if err := db.Select("id, title, year, num_rating").Find(&movies).Error; err != nil {
+		return nil, err
+	}
+
+	searchMovies := make([]search.Movie, 0, len(movies))
+	for _, movie := range movies {
+		searchMovies = append(searchMovies, search.Movie{
+			ID:        movie.ID,
+			Title:     movie.Title,
+			Year:      movie.Year,
+			NumRating: movie.NumRating,
+		})
+	}
+
+	return search.NewIndex(searchMovies), nil
+}
+
+// movieFingerprint changes whenever a movie is inserted, deleted or updated, which is when the index must be rebuilt.
+type movieFingerprint struct {
+	Count         int
+	LastUpdatedAt *time.Time
+}
+
+func fingerprintMovies(db *gorm.DB) (movieFingerprint, error) {
+	var fingerprint movieFingerprint
+	err := db.Model(&model.Movie{}).
+		Select("count(*) as count, max(updated_at) as last_updated_at").
+		Scan(&fingerprint).Error
+
+	return fingerprint, err
+}
+
+func (f movieFingerprint) Equal(other movieFingerprint) bool {
+	if f.Count != other.Count {
+		return false
+	}
+
+	if f.LastUpdatedAt == nil || other.LastUpdatedAt == nil {
+		return f.LastUpdatedAt == other.LastUpdatedAt
+	}
+
+	return f.LastUpdatedAt.Equal(*other.LastUpdatedAt)
+}
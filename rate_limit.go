@@ -0,0 +1,83 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"os"
+	"popcorn/ratelimit"
+	"strings"
+	"time"
+)
+
+// Rate limit policies of the API. Every API request counts against the api policy, signing in and registering are
+// limited much more because they are where passwords are guessed and accounts are mass created. Requests with an API
+// token count against the token policy before the token is looked up, because that is where tokens are guessed, and
+// movie details and trailers against the tmdb policy because they are proxied to TMDB, which allows about 40 requests
+// every 10 seconds for the whole site. Each limit can be changed with an environment variable named after the policy
+// and the limit, e.g. RATE_LIMIT_LOGIN_PER_IP=20/1m, RATE_LIMIT_API_PER_USER=off or RATE_LIMIT_TMDB_GLOBAL=40/10s.
+var (
+	apiPolicy = ratelimit.Policy{
+		Name:    "api",
+		PerIP:   ratelimit.Per(300, time.Minute),
+		PerUser: ratelimit.Per(600, time.Minute),
+	}
+
+	loginPolicy = ratelimit.Policy{
+		Name:  "login",
+		PerIP: ratelimit.Per(10, time.Minute),
+	}
+
+	tokenPolicy = ratelimit.Policy{
+		Name:  "token",
+		PerIP: ratelimit.Per(300, time.Minute),
+	}
+
+	registerPolicy = ratelimit.Policy{
+		Name:  "register",
+		PerIP: ratelimit.Per(5, time.Hour),
+	}
+
+	tmdbPolicy = ratelimit.Policy{
+		Name:    "tmdb",
+		PerIP:   ratelimit.Per(30, time.Minute),
+		PerUser: ratelimit.Per(30, time.Minute),
+		Global:  ratelimit.Per(40, 10*time.Second),
+	}
+)
+
+// configurePolicy overrides the limits of the policy that are set in the environment. Limits that cannot be parsed
+// are logged and left as they are.
+func configurePolicy(policy ratelimit.Policy) ratelimit.Policy {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(policy.Name)
+	limits := map[string]*ratelimit.Limit{
+		prefix + "_PER_IP":   &policy.PerIP,
+		prefix + "_PER_USER": &policy.PerUser,
+		prefix + "_GLOBAL":   &policy.Global,
+	}
+
+	for name, limit := range limits {
+		text := os.Getenv(name)
+		if text == "" {
+			continue
+		}
+
+		parsed, err := ratelimit.ParseLimit(text)
+		if err != nil {
+			logrus.WithField("src", "rate_limit").Errorf("ignored %s: %v", name, err)
+			continue
+		}
+
+		*limit = parsed
+	}
+
+	logrus.Infof("Rate limit policy %v", policy)
+
+	return policy
+}
+
+// newRateLimitMiddleware limits requests by the policy, as configured in the environment, with buckets in the store.
+func newRateLimitMiddleware(store ratelimit.Store, policy ratelimit.Policy) HttpMiddleware {
+	return NewRateLimitMiddleware(ratelimit.New(store, configurePolicy(policy)))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package ratelimit throttles clients with token buckets. A policy has a bucket per client IP, per signed in user and
+// one shared by everyone, and the buckets are kept in a store, which is in memory unless another backend is plugged in.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Count requests per Period. The bucket holds Count tokens and refills evenly over the period, so a burst
+// of Count requests is allowed after a quiet period. The zero Limit does not limit anything.
+type Limit struct {
+	Count  int
+	Period time.Duration
+}
+
+// Per returns a limit of count requests per period.
+func Per(count int, period time.Duration) Limit {
+	return Limit{Count: count, Period: period}
+}
+
+// ParseLimit reads a limit written as count/period, e.g. 300/1m or 5/15s. Off is the zero limit.
+func ParseLimit(text string) (Limit, error) {
+	if strings.EqualFold(text, "off") {
+		return Limit{}, nil
+	}
+
+	parts := strings.Split(text, "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("limit %q is not written as count/period", text)
+	}
+
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 {
+		return Limit{}, fmt.Errorf("count of limit %q is not a positive integer", text)
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("period of limit %q is not a positive duration", text)
+	}
+
+	return Per(count, period), nil
+}
+
+// Enabled reports whether the limit limits anything.
+func (l Limit) Enabled() bool {
+	return l.Count > 0 && l.Period > 0
+}
+
+// Rate returns the number of tokens the bucket gains per second.
+func (l Limit) Rate() float64 {
+	return float64(l.Count) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+
+	return fmt.Sprintf("%d/%v", l.Count, l.Period)
+}
+
+// RetryAfter rounds a wait up to whole seconds for the Retry-After header, which has no finer resolution.
+func RetryAfter(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package ratelimit throttles clients with token buckets. A policy has a bucket per client IP, per signed in user and
+// one shared by everyone, and the buckets are kept in a store, which is in memory unless another backend is plugged in.
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy names a set of limits. Requests are limited by the IP address they come from, by the user they are
+// authenticated as, and all together by Global, which protects resources that are limited themselves such as a third
+// party API. Anonymous requests are only limited by IP and Global. Limits that are not enabled are skipped.
+type Policy struct {
+	Name    string
+	PerIP   Limit
+	PerUser Limit
+	Global  Limit
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("%s (per IP %v, per user %v, global %v)", p.Name, p.PerIP, p.PerUser, p.Global)
+}
+
+// Limiter applies a policy with buckets kept in a store. Limiters of different policies may share a store because the
+// buckets are keyed by the name of the policy.
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+// New returns a limiter of the policy.
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy}
+}
+
+// Policy returns the policy of the limiter.
+func (l *Limiter) Policy() Policy {
+	return l.policy
+}
+
+// Allow takes a token from every bucket that applies to a request from the IP address by the user, where a user ID of
+// zero is an anonymous request. It returns false when one of the buckets is empty, together with how long the client
+// should wait before retrying. A rejected request takes no tokens at all, so that a client who is over its own limit
+// cannot use up the global bucket that other clients share. When the store fails the request is allowed, along with
+// the error.
+func (l *Limiter) Allow(ip string, userID uint) (bool, time.Duration, error) {
+	now := time.Now()
+
+	// The global bucket comes last, it is only reached by requests that are within the limits of their client.
+	keys := []string{"ip:" + ip}
+	limits := []Limit{l.policy.PerIP}
+	if userID != 0 {
+		keys = append(keys, fmt.Sprintf("user:%d", userID))
+		limits = append(limits, l.policy.PerUser)
+	}
+
+	keys = append(keys, "global")
+	limits = append(limits, l.policy.Global)
+
+	taken := 0
+	for i, key := range keys {
+		if !limits[i].Enabled() {
+			taken += 1
+			continue
+		}
+
+		ok, wait, err := l.store.Take(l.policy.Name+":"+key, limits[i], now)
+		if err != nil {
+			return true, 0, err
+		}
+
+		if !ok {
+			return false, wait, l.refund(keys[:taken], limits[:taken], now)
+		}
+
+		taken += 1
+	}
+
+	return true, 0, nil
+}
+
+// refund puts back the tokens that a rejected request took.
+func (l *Limiter) refund(keys []string, limits []Limit, now time.Time) error {
+	for i, key := range keys {
+		if limits[i].Enabled() {
+			if err := l.store.Refund(l.policy.Name+":"+key, limits[i], now); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	policy := Policy{
+		Name:    "test",
+		PerIP:   Per(2, time.Minute),
+		PerUser: Per(3, time.Minute),
+		Global:  Per(6, time.Minute),
+	}
+
+	// Requests are made in order against one limiter.
+	tests := []struct {
+		ip      string
+		userID  uint
+		allowed bool
+	}{
+		{"10.0.0.1", 0, true},
+		{"10.0.0.1", 0, true},
+		{"10.0.0.1", 0, false},
+		{"10.0.0.1", 0, false},
+		{"10.0.0.2", 7, true},
+		{"10.0.0.3", 7, true},
+		{"10.0.0.4", 7, true},
+		{"10.0.0.5", 7, false},
+		{"10.0.0.5", 0, true},
+		{"10.0.0.6", 0, false},
+	}
+
+	limiter := New(NewMemoryStore(), policy)
+	for i, test := range tests {
+		allowed, wait, err := limiter.Allow(test.ip, test.userID)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+
+		if allowed != test.allowed {
+			t.Errorf("request %d from %s by user %d: allowed = %v, expected %v", i, test.ip, test.userID, allowed,
+				test.allowed)
+		}
+
+		if !allowed && wait <= 0 {
+			t.Errorf("request %d was rejected without a wait", i)
+		}
+	}
+}
+
+func TestLimiterRejectedRequestsTakeNoGlobalTokens(t *testing.T) {
+	policy := Policy{Name: "tmdb", PerIP: Per(2, time.Minute), Global: Per(3, time.Minute)}
+	limiter := New(NewMemoryStore(), policy)
+
+	for n := 0; n < 10; n += 1 {
+		limiter.Allow("10.0.0.1", 0)
+	}
+
+	if allowed, _, _ := limiter.Allow("10.0.0.2", 0); !allowed {
+		t.Error("a client over its own limit used up the global bucket")
+	}
+}
+
+func TestLimiterDisabledLimits(t *testing.T) {
+	limiter := New(NewMemoryStore(), Policy{Name: "off"})
+	for n := 0; n < 100; n += 1 {
+		if allowed, _, _ := limiter.Allow("10.0.0.1", 1); !allowed {
+			t.Fatal("a policy without limits rejected a request")
+		}
+	}
+}
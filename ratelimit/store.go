@@ -0,0 +1,111 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package ratelimit throttles clients with token buckets. A policy has a bucket per client IP, per signed in user and
+// one shared by everyone, and the buckets are kept in a store, which is in memory unless another backend is plugged in.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Store keeps the token buckets. Take removes a token from the bucket of the key, which starts out full, and returns
+// true when there was one. Otherwise it returns false and how long it takes until the bucket has a token again. Refund
+// puts a taken token back, up to a full bucket. Implementations must be safe for concurrent use. A backend shared by
+// several servers, e.g. Redis, makes the limits hold across all of them, while MemoryStore limits every server on its
+// own.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (bool, time.Duration, error)
+	Refund(key string, limit Limit, now time.Time) error
+}
+
+// SweepInterval is how often MemoryStore drops the buckets that have refilled completely, they are no different from
+// buckets that were never used.
+const SweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	limit   Limit
+	updated time.Time
+}
+
+// refill adds the tokens gained since the bucket was last updated, up to a full bucket.
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Count), b.tokens+elapsed*b.limit.Rate())
+		b.updated = now
+	}
+}
+
+// MemoryStore keeps the buckets in memory of the process.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Take implements Store, it never fails.
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.Sub(s.lastSweep) >= SweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Count), limit: limit, updated: now}
+		s.buckets[key] = b
+	} else {
+		b.refill(now)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens -= 1
+		return true, 0, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) / limit.Rate() * float64(time.Second))
+	return false, wait, nil
+}
+
+// Refund implements Store, it never fails.
+func (s *MemoryStore) Refund(key string, limit Limit, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if b, ok := s.buckets[key]; ok && b.limit == limit {
+		b.refill(now)
+		b.tokens = math.Min(float64(limit.Count), b.tokens+1)
+	}
+
+	return nil
+}
+
+// Len returns the number of buckets in the store.
+func (s *MemoryStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.buckets)
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Count) {
+			delete(s.buckets, key)
+		}
+	}
+
+	s.lastSweep = now
+}
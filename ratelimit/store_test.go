@@ -0,0 +1,136 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := Per(3, 3*time.Second)
+
+	// Steps are applied in order to one bucket, each at an offset from the start.
+	tests := []struct {
+		offset     time.Duration
+		allowed    bool
+		retryAfter int
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 1},
+		{500 * time.Millisecond, false, 1},
+		{time.Second, true, 0},
+		{time.Second, false, 1},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, false, 1},
+	}
+
+	store := NewMemoryStore()
+	for i, test := range tests {
+		allowed, wait, err := store.Take("key", limit, start.Add(test.offset))
+		if err != nil {
+			t.Fatalf("step %d: unexpected error %v", i, err)
+		}
+
+		if allowed != test.allowed || RetryAfter(wait) != test.retryAfter {
+			t.Errorf("step %d: Take = (%v, %v), expected (%v, %ds)", i, allowed, wait, test.allowed, test.retryAfter)
+		}
+	}
+}
+
+func TestMemoryStoreRetryAfter(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		limit      Limit
+		retryAfter int
+	}{
+		{Per(1, time.Minute), 60},
+		{Per(10, time.Minute), 6},
+		{Per(40, 10*time.Second), 1},
+		{Per(5, time.Hour), 720},
+	}
+
+	for _, test := range tests {
+		store := NewMemoryStore()
+		for n := 0; n < test.limit.Count; n += 1 {
+			store.Take("key", test.limit, start)
+		}
+
+		allowed, wait, _ := store.Take("key", test.limit, start)
+		if allowed || RetryAfter(wait) != test.retryAfter {
+			t.Errorf("limit %v: Take = (%v, %v), expected Retry-After of %ds", test.limit, allowed, wait,
+				test.retryAfter)
+		}
+	}
+}
+
+func TestMemoryStoreRefund(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := Per(1, time.Minute)
+
+	store := NewMemoryStore()
+	store.Take("key", limit, start)
+	store.Refund("key", limit, start)
+	store.Refund("key", limit, start)
+
+	if allowed, _, _ := store.Take("key", limit, start); !allowed {
+		t.Error("Take after Refund was rejected")
+	}
+
+	if allowed, _, _ := store.Take("key", limit, start); allowed {
+		t.Error("Refund filled the bucket beyond its limit")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.lastSweep = start
+	store.Take("short", Per(10, time.Second), start)
+	store.Take("long", Per(10, time.Hour), start)
+	if store.Len() != 2 {
+		t.Fatalf("Len() = %d, expected 2", store.Len())
+	}
+
+	// The short bucket has refilled by the time of the sweep, the long one has not.
+	store.Take("other", Per(10, time.Second), start.Add(SweepInterval))
+	if store.Len() != 2 {
+		t.Errorf("Len() = %d after sweep, expected 2", store.Len())
+	}
+
+	if _, ok := store.buckets["short"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Limit
+		valid    bool
+	}{
+		{"300/1m", Per(300, time.Minute), true},
+		{"40/10s", Per(40, 10*time.Second), true},
+		{"off", Limit{}, true},
+		{"OFF", Limit{}, true},
+		{"300", Limit{}, false},
+		{"0/1m", Limit{}, false},
+		{"-1/1m", Limit{}, false},
+		{"10/0s", Limit{}, false},
+		{"10/minute", Limit{}, false},
+	}
+
+	for _, test := range tests {
+		limit, err := ParseLimit(test.text)
+		if (err == nil) != test.valid || limit != test.expected {
+			t.Errorf("ParseLimit(%q) = (%v, %v), expected %v", test.text, limit, err, test.expected)
+		}
+	}
+}
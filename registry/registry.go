@@ -0,0 +1,223 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package registry keeps track of trained model versions and which one of them is serving movie features.
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"popcorn/lowrank"
+	"popcorn/model"
+	"time"
+)
+
+// ListColumns are the columns of a model version without the artifact, which can be several megabytes large.
+var ListColumns = []string{
+	"id", "created_at", "updated_at", "algorithm", "feature_dim", "hyperparameters", "root_mean_sq_error",
+	"dataset_hash", "active", "activated_at",
+}
+
+// Register stores the artifact as a new inactive model version.
+func Register(db *gorm.DB, artifact *lowrank.Artifact) (*model.ModelVersion, error) {
+	var buffer bytes.Buffer
+	if err := artifact.Write(&buffer); err != nil {
+		return nil, err
+	}
+
+	hyperparameters, err := json.Marshal(artifact.Hyperparameters)
+	if err != nil {
+		return nil, err
+	}
+
+	version := &model.ModelVersion{
+		Algorithm:       artifact.Algorithm,
+		FeatureDim:      artifact.FeatureDim,
+		Hyperparameters: hyperparameters,
+		RootMeanSqError: artifact.RootMeanSqError,
+		DatasetHash:     artifact.DatasetHash,
+		Artifact:        buffer.Bytes(),
+	}
+
+	if err := db.Create(version).Error; err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// List returns every model version without its artifact, newest first.
+func List(db *gorm.DB) ([]*model.ModelVersion, error) {
+	var versions []*model.ModelVersion
+	if err := db.Select(ListColumns).Order("id desc").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// Active returns the active model version together with its artifact. It returns gorm.ErrRecordNotFound if no version
+// has been activated yet.
+func Active(db *gorm.DB) (*model.ModelVersion, error) {
+	var version model.ModelVersion
+	if err := db.Where("active = ?", true).First(&version).Error; err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// LoadArtifact decodes the artifact of a model version.
+func LoadArtifact(version *model.ModelVersion) (*lowrank.Artifact, error) {
+	if len(version.Artifact) == 0 {
+		return nil, errors.New("model version does not have an artifact")
+	}
+
+	return lowrank.ReadArtifact(bytes.NewReader(version.Artifact))
+}
+
+// Activate makes the given model version the only active version and writes its latent features and biases to the
+// movies table in one transaction, so the server never serves a mix of two models. The activation is added to the
+// history that Rollback walks back along.
+func Activate(db *gorm.DB, id uint) (*model.ModelVersion, error) {
+	return activate(db, id, nil)
+}
+
+// Rollback re-activates the version that was served before the current one. Every rollback takes the latest activation
+// off the history, so repeated rollbacks keep going back, e.g. after activating v1, v2 and v3 the first rollback goes
+// to v2 and the second to v1.
+func Rollback(db *gorm.DB) (*model.ModelVersion, error) {
+	var history []*model.ModelActivation
+	if err := db.Where("rolled_back = ?", false).Order("id desc").Limit(2).Find(&history).Error; err != nil {
+		return nil, err
+	}
+
+	if len(history) < 2 {
+		return nil, errors.New("there is no previously activated model version to roll back to")
+	}
+
+	return activate(db, history[1].ModelVersionID, history[0])
+}
+
+// activate implements Activate and Rollback. A rollback marks the activation that it undoes as rolled back, instead of
+// adding a new one to the history.
+func activate(db *gorm.DB, id uint, undone *model.ModelActivation) (*model.ModelVersion, error) {
+	var version model.ModelVersion
+	if err := db.Where("id = ?", id).First(&version).Error; err != nil {
+		return nil, err
+	}
+
+	artifact, err := LoadArtifact(&version)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	tx := db.Begin()
+	if err := tx.Model(&model.ModelVersion{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Model(&version).Updates(map[string]interface{}{"active": true, "activated_at": now}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if undone != nil {
+		err = tx.Model(undone).Update("rolled_back", true).Error
+	} else {
+		err = tx.Create(&model.ModelActivation{ModelVersionID: version.ID}).Error
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := applyArtifact(tx, version.ID, artifact); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	version.Active = true
+	version.ActivatedAt = &now
+
+	logrus.WithField("src", "registry").Infof("model version %d (%s) is activated", version.ID, version.Algorithm)
+	return &version, nil
+}
+
+// Sync makes sure the movies table holds the features of the active model version. It is cheap when nothing has
+// changed, which lets the server poll it to pick up versions activated by cmd/model. It returns the active version
+// and whether movies were updated.
+func Sync(db *gorm.DB) (*model.ModelVersion, bool, error) {
+	var version model.ModelVersion
+	err := db.Select(ListColumns).Where("active = ?", true).First(&version).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var staleCount int
+	if err := db.Model(&model.Movie{}).Where("model_version_id <> ?", version.ID).Count(&staleCount).Error; err != nil {
+		return nil, false, err
+	}
+
+	if staleCount == 0 {
+		return &version, false, nil
+	}
+
+	active, err := Active(db)
+	if err != nil {
+		return nil, false, err
+	}
+
+	artifact, err := LoadArtifact(active)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx := db.Begin()
+	if err := applyArtifact(tx, active.ID, artifact); err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, false, err
+	}
+
+	return &version, true, nil
+}
+
+// applyArtifact writes the movie latent features and biases of an artifact to the movies table. Movies that the model
+// has never seen lose their features, because features of two different models do not live in the same space.
+func applyArtifact(tx *gorm.DB, versionID uint, artifact *lowrank.Artifact) error {
+	for movieID, feature := range artifact.MovieLatentMap {
+		err := tx.Model(&model.Movie{}).Where("id = ?", movieID).Updates(map[string]interface{}{
+			"feature":          pq.Float64Array(feature),
+			"bias":             artifact.MovieBiasMap[movieID],
+			"model_version_id": versionID,
+		}).Error
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&model.Movie{}).Where("model_version_id <> ?", versionID).Updates(map[string]interface{}{
+		"feature":          pq.Float64Array{},
+		"bias":             0,
+		"model_version_id": versionID,
+	}).Error
+}
@@ -0,0 +1,374 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package retrain updates the movie features with the ratings that users submit through the web application.
+package retrain
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"math"
+	"popcorn/kmeans"
+	"popcorn/lowrank"
+	"popcorn/model"
+	"popcorn/registry"
+	"strconv"
+)
+
+// MinMovieCountForClustering is the fewest movies with features that k-means is run on. Clustering assigns movies to
+// hundreds of centroids, with too few movies most of them would be empty.
+const MinMovieCountForClustering = 1000
+
+// Config locates the MovieLens snapshot that the current features were trained on and controls how long the warm
+// started model is trained. Learning rate is only used when the served model is biased. Implicit trains the weighted
+// implicit model on the interactions of app users as well as on the ratings, it keeps the served movie biases.
+type Config struct {
+	RatingFilePath string
+	MovieFilePath  string
+	Steps          int
+	Reg            float64
+	LearnRate      float64
+	Cluster        bool
+	Implicit       bool
+}
+
+func DefaultConfig(datasetDir string) Config {
+	return Config{
+		RatingFilePath: datasetDir + "ratings.csv",
+		MovieFilePath:  datasetDir + "movies.csv",
+		Steps:          5,
+		Reg:            0.03,
+		LearnRate:      0.005,
+		Cluster:        true,
+	}
+}
+
+// Run retrains the model on the MovieLens ratings together with every rating in the ratings table. Instead of starting
+// from random vectors, movies start from the features they are served with and app users start from their preference,
+// so a few steps are enough and the new features stay close to the old ones. The result is registered and activated as
+// a new model version, which updates the movies in place, and the movies are re-clustered. With config.Implicit the
+// skips and views that app users have left are trained on as well.
+func Run(db *gorm.DB, config Config) (*model.ModelVersion, error) {
+	var movies []model.Movie
+	if err := db.Select("id, feature, bias").Find(&movies).Error; err != nil {
+		return nil, err
+	}
+
+	featureDim := featureDimension(movies)
+	if featureDim == 0 {
+		return nil, errors.New("no movies have latent features to start from")
+	}
+
+	isBiased := false
+	for _, movie := range movies {
+		if movie.Bias != 0 {
+			isBiased = true
+			break
+		}
+	}
+
+	dataset, err := lowrank.LoadDataset(config.RatingFilePath, config.MovieFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var ratings []model.Rating
+	if err := db.Find(&ratings).Error; err != nil {
+		return nil, err
+	}
+
+	// App users and MovieLens users are numbered independently, app users are given negative IDs so they never collide.
+	for _, rating := range ratings {
+		dataset.AddTrainingRating(appUserID(rating.UserID), int(rating.MovieID), rating.Value)
+	}
+
+	var users []model.User
+	if err := db.Select("id, preference, bias").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	var artifact *lowrank.Artifact
+	if config.Implicit {
+		var interactions []model.Interaction
+		if err := db.Find(&interactions).Error; err != nil {
+			return nil, err
+		}
+
+		artifact = trainImplicit(dataset, movies, users, interactions, featureDim, config)
+		artifact.Hyperparameters["app_interactions"] = float64(len(interactions))
+	} else if isBiased {
+		artifact = trainBiased(dataset, movies, users, featureDim, config)
+	} else {
+		artifact = trainALS(dataset, movies, users, featureDim, config)
+	}
+
+	artifact.Hyperparameters["app_ratings"] = float64(len(ratings))
+	artifact.DatasetHash, err = lowrank.HashDataset(config.RatingFilePath, config.MovieFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := registry.Register(db, artifact)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := registry.Activate(db, version.ID); err != nil {
+		return nil, err
+	}
+
+	if config.Cluster {
+		if err := updateClusters(db, artifact.MovieLatentMap); err != nil {
+			return version, err
+		}
+	}
+
+	logrus.WithField("src", "retrain").Infof("model version %d is trained with %d app ratings and RMSE %1.6f",
+		version.ID, len(ratings), artifact.RootMeanSqError)
+
+	return version, nil
+}
+
+func trainALS(dataset *lowrank.Dataset, movies []model.Movie, users []model.User, featureDim int,
+	config Config) *lowrank.Artifact {
+	alsFact := lowrank.NewALSFactorizerFromDataset(dataset, featureDim)
+	warmStart(alsFact.MovieLatentMap, alsFact.UserLatentMap, movies, users, featureDim)
+	alsFact.Train(config.Steps, 1, config.Reg)
+
+	_, rootMeanSqError, _ := alsFact.Loss(config.Reg)
+	return &lowrank.Artifact{
+		ArtifactHeader: lowrank.ArtifactHeader{
+			Algorithm:       "als-incremental",
+			FeatureDim:      featureDim,
+			RootMeanSqError: rootMeanSqError,
+			Hyperparameters: map[string]float64{
+				"feature_dim": float64(featureDim),
+				"reg":         config.Reg,
+				"steps":       float64(config.Steps),
+			},
+		},
+		MovieLatentMap: alsFact.MovieLatentMap,
+		UserLatentMap:  alsFact.UserLatentMap,
+	}
+}
+
+func trainBiased(dataset *lowrank.Dataset, movies []model.Movie, users []model.User, featureDim int,
+	config Config) *lowrank.Artifact {
+	biasedFact := lowrank.NewBiasedFactorizerFromDataset(dataset, featureDim)
+	warmStart(biasedFact.MovieLatentMap, biasedFact.UserLatentMap, movies, users, featureDim)
+
+	// Served movie biases include the global mean, the factorizer keeps the two apart.
+	for _, movie := range movies {
+		if _, ok := biasedFact.MovieBiasMap[int(movie.ID)]; ok && len(movie.Feature) == featureDim {
+			biasedFact.MovieBiasMap[int(movie.ID)] = movie.Bias - biasedFact.GlobalMean
+		}
+	}
+
+	for _, user := range users {
+		if _, ok := biasedFact.UserBiasMap[appUserID(user.ID)]; ok {
+			biasedFact.UserBiasMap[appUserID(user.ID)] = user.Bias
+		}
+	}
+
+	biasedFact.Train(config.Steps, 1, config.Reg, config.LearnRate)
+
+	_, rootMeanSqError, _ := biasedFact.Loss(config.Reg)
+	return &lowrank.Artifact{
+		ArtifactHeader: lowrank.ArtifactHeader{
+			Algorithm:       "biased-incremental",
+			FeatureDim:      featureDim,
+			RootMeanSqError: rootMeanSqError,
+			Hyperparameters: map[string]float64{
+				"feature_dim": float64(featureDim),
+				"reg":         config.Reg,
+				"learn_rate":  config.LearnRate,
+				"steps":       float64(config.Steps),
+			},
+		},
+		MovieLatentMap: biasedFact.MovieLatentMap,
+		MovieBiasMap:   biasedFact.MovieOffsetMap(),
+		UserLatentMap:  biasedFact.UserLatentMap,
+	}
+}
+
+// trainImplicit trains the weighted implicit model of Hu, Koren and Volinsky on the ratings and on the skips and views
+// of app users, so that users who rarely rate shape the movie features too. Movie biases stay as they are served and
+// the bias of every user is the average offset of their ratings from them, which is the same baseline that the engine
+// folds a single user in with. RMSE is measured on the held-out MovieLens ratings.
+func trainImplicit(dataset *lowrank.Dataset, movies []model.Movie, users []model.User,
+	interactions []model.Interaction, featureDim int, config Config) *lowrank.Artifact {
+	movieBiasMap := make(map[int]float64)
+	for _, movie := range movies {
+		movieBiasMap[int(movie.ID)] = movie.Bias
+	}
+
+	weightMapByUser := make(map[int]map[int]float64)
+	for _, interaction := range interactions {
+		userID := appUserID(interaction.UserID)
+		if weightMapByUser[userID] == nil {
+			weightMapByUser[userID] = make(map[int]float64)
+		}
+
+		weightMapByUser[userID][int(interaction.MovieID)] += model.InteractionWeights[interaction.Kind]
+	}
+
+	userBiasMap := make(map[int]float64)
+	feedbackMap := make(map[int]map[int]lowrank.Feedback)
+	for userID, ratingMap := range dataset.TrainingUserMovieRatingMap {
+		var userBias float64
+		for movieID, rating := range ratingMap {
+			userBias += rating - movieBiasMap[movieID]
+		}
+
+		if len(ratingMap) > 0 {
+			userBias /= float64(len(ratingMap))
+		}
+
+		offsetMap := make(map[int]float64)
+		for movieID, rating := range ratingMap {
+			offsetMap[movieID] = rating - userBias - movieBiasMap[movieID]
+		}
+
+		userBiasMap[userID] = userBias
+		feedbackMap[userID] = lowrank.NewUserFeedback(offsetMap, weightMapByUser[userID])
+	}
+
+	// Users who have never rated anything are only known from their interactions.
+	for userID, weightMap := range weightMapByUser {
+		if _, ok := feedbackMap[userID]; !ok {
+			feedbackMap[userID] = lowrank.NewUserFeedback(nil, weightMap)
+		}
+	}
+
+	implicitFact := lowrank.NewImplicitALSFactorizer(feedbackMap, featureDim)
+	warmStart(implicitFact.MovieLatentMap, implicitFact.UserLatentMap, movies, users, featureDim)
+	implicitFact.Train(config.Steps, 1, lowrank.ImplicitReg)
+
+	var sqError, count float64
+	for userID, ratingMap := range dataset.TestRatingMap {
+		for movieID, rating := range ratingMap {
+			userLatent, userOK := implicitFact.UserLatentMap[userID]
+			movieLatent, movieOK := implicitFact.MovieLatentMap[movieID]
+			if !userOK || !movieOK {
+				continue
+			}
+
+			score, _ := lowrank.DotProduct(userLatent, movieLatent)
+			predicted := userBiasMap[userID] + movieBiasMap[movieID] + score
+			sqError += (rating - predicted) * (rating - predicted)
+			count += 1
+		}
+	}
+
+	var rootMeanSqError float64
+	if count > 0 {
+		rootMeanSqError = math.Sqrt(sqError / count)
+	}
+
+	servedBiasMap := make(map[int]float64)
+	for movieID := range implicitFact.MovieLatentMap {
+		servedBiasMap[movieID] = movieBiasMap[movieID]
+	}
+
+	return &lowrank.Artifact{
+		ArtifactHeader: lowrank.ArtifactHeader{
+			Algorithm:       "implicit-incremental",
+			FeatureDim:      featureDim,
+			RootMeanSqError: rootMeanSqError,
+			Hyperparameters: map[string]float64{
+				"feature_dim": float64(featureDim),
+				"reg":         lowrank.ImplicitReg,
+				"alpha":       lowrank.ImplicitAlpha,
+				"steps":       float64(config.Steps),
+			},
+		},
+		MovieLatentMap: implicitFact.MovieLatentMap,
+		MovieBiasMap:   servedBiasMap,
+		UserLatentMap:  implicitFact.UserLatentMap,
+	}
+}
+
+// warmStart replaces the random initial vectors of a factorizer with the served movie features and app user
+// preferences. Movies that are new to the model keep their random vectors.
+func warmStart(movieLatentMap, userLatentMap map[int][]float64, movies []model.Movie, users []model.User,
+	featureDim int) {
+	for _, movie := range movies {
+		if latent, ok := movieLatentMap[int(movie.ID)]; ok && len(movie.Feature) == featureDim {
+			copy(latent, movie.Feature)
+		}
+	}
+
+	for _, user := range users {
+		if latent, ok := userLatentMap[appUserID(user.ID)]; ok && len(user.Preference) == featureDim {
+			copy(latent, user.Preference)
+		}
+	}
+}
+
+// updateClusters runs k-means on the new features and writes the cluster of every movie together with its nearest and
+// farthest clusters, the same columns that cmd/seed loads from clusters.csv.
+func updateClusters(db *gorm.DB, movieLatentMap map[int][]float64) error {
+	if len(movieLatentMap) < MinMovieCountForClustering {
+		logrus.WithField("src", "retrain").Warnf("skipped clustering, only %d movies have features",
+			len(movieLatentMap))
+		return nil
+	}
+
+	movies := make([]*kmeans.Movie, 0, len(movieLatentMap))
+	for movieID, latent := range movieLatentMap {
+		movies = append(movies, &kmeans.Movie{MovieID: strconv.Itoa(movieID), Feature: latent})
+	}
+
+	assignments := kmeans.MovieClustering(movies)
+
+	tx := db.Begin()
+	for _, assignment := range assignments {
+		nearestClusters := make(pq.StringArray, 0, len(assignment.ClosestClusters))
+		for _, centroid := range assignment.ClosestClusters {
+			nearestClusters = append(nearestClusters, strconv.Itoa(centroid.ClusterID))
+		}
+
+		farthestClusters := make(pq.StringArray, 0, len(assignment.FarthestClusters))
+		for _, centroid := range assignment.FarthestClusters {
+			farthestClusters = append(farthestClusters, strconv.Itoa(centroid.ClusterID))
+		}
+
+		err := tx.Model(&model.Movie{}).Where("id = ?", assignment.Movie.MovieID).Updates(map[string]interface{}{
+			"cluster_id":        assignment.Centroid.ClusterID,
+			"nearest_clusters":  nearestClusters,
+			"farthest_clusters": farthestClusters,
+		}).Error
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+func appUserID(userID uint) int {
+	return -int(userID)
+}
+
+// featureDimension returns the most common length of the movie features, movies that were never rated have none.
+func featureDimension(movies []model.Movie) int {
+	dimCount := make(map[int]int)
+	for _, movie := range movies {
+		if len(movie.Feature) > 0 {
+			dimCount[len(movie.Feature)] += 1
+		}
+	}
+
+	featureDim := 0
+	for dim, count := range dimCount {
+		if count > dimCount[featureDim] {
+			featureDim = dim
+		}
+	}
+
+	return featureDim
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package retrain updates the movie features with the ratings that users submit through the web application.
+package retrain
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"popcorn/model"
+	"time"
+)
+
+// Schedule retrains the model every interval for as long as the process runs. A run is skipped when no rating has been
+// submitted since the last one, there would be nothing new to learn from. The implicit model also learns from new
+// interactions.
+func Schedule(db *gorm.DB, config Config, interval time.Duration) {
+	var lastRatingCount int
+	var lastRatingUpdate time.Time
+	var lastInteractionCount int
+	for {
+		time.Sleep(interval)
+
+		var stat struct {
+			Count     int
+			UpdatedAt *time.Time
+		}
+
+		if err := db.Model(&model.Rating{}).Select("count(*) as count, max(updated_at) as updated_at").
+			Scan(&stat).Error; err != nil {
+			logrus.WithField("src", "retrain").Error("failed to check ratings for changes", err)
+			continue
+		}
+
+		var updatedAt time.Time
+		if stat.UpdatedAt != nil {
+			updatedAt = *stat.UpdatedAt
+		}
+
+		var interactionCount int
+		if config.Implicit {
+			if err := db.Model(&model.Interaction{}).Count(&interactionCount).Error; err != nil {
+				logrus.WithField("src", "retrain").Error("failed to check interactions for changes", err)
+				continue
+			}
+		}
+
+		if stat.Count == lastRatingCount && updatedAt.Equal(lastRatingUpdate) && interactionCount == lastInteractionCount {
+			continue
+		}
+
+		if _, err := Run(db, config); err != nil {
+			logrus.WithField("src", "retrain").Error("scheduled retraining has failed", err)
+			continue
+		}
+
+		lastRatingCount, lastRatingUpdate, lastInteractionCount = stat.Count, updatedAt, interactionCount
+	}
+}
@@ -7,13 +7,25 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	"net/http"
+	"popcorn/ann"
+	"popcorn/content"
 	"popcorn/handler"
+	"popcorn/hub"
+	"popcorn/jobs"
 	"popcorn/model"
+	"popcorn/ratelimit"
+	"popcorn/search"
 )
 
-func LoadRoutes(db *gorm.DB, updateUserPreferenceQueue chan *model.User) http.Handler {
+func LoadRoutes(db *gorm.DB, preferenceQueue *jobs.PreferenceQueue, movieIndex, similarityIndex *ann.Live,
+	contentIndex *content.Live, searchIndex *search.Live, connHub *hub.Hub, rateLimitStore ratelimit.Store) http.Handler {
 	// Defining middleware
 	logMiddleware := NewServerLoggingMiddleware()
+	authMiddleware := NewAuthenticationMiddleware(db, ratelimit.New(rateLimitStore, configurePolicy(tokenPolicy)))
+	apiLimit := newRateLimitMiddleware(rateLimitStore, apiPolicy)
+	loginLimit := newRateLimitMiddleware(rateLimitStore, loginPolicy)
+	registerLimit := newRateLimitMiddleware(rateLimitStore, registerPolicy)
+	tmdbLimit := newRateLimitMiddleware(rateLimitStore, tmdbPolicy)
 
 	// Instantiate our router object
 	muxRouter := mux.NewRouter().StrictSlash(true)
@@ -21,28 +33,83 @@ func LoadRoutes(db *gorm.DB, updateUserPreferenceQueue chan *model.User) http.Ha
 	// Name-spacing API
 	api := muxRouter.PathPrefix("/api").Subrouter()
 
+	// Every API request is rate limited, the routes below add stricter limits of their own
+	api.Use(mux.MiddlewareFunc(apiLimit))
+
 	// Sessions related
-	api.Handle("/users/login", handler.NewSessionCreateHandler(db)).Methods("POST")
+	api.Handle("/users/login", loginLimit(handler.NewSessionCreateHandler(db))).Methods("POST")
 	api.Handle("/users/logout", handler.NewSessionDestroyHandler(db)).Methods("DELETE")
 	api.Handle("/users/authenticate", handler.NewTokenAuthenticateHandler(db)).Methods("GET")
+	api.Handle("/sessions", requireUser(handler.NewSessionListHandler(db))).Methods("GET")
+	api.Handle("/sessions", requireUser(handler.NewSessionRevokeAllHandler(db))).Methods("DELETE")
+	api.Handle("/sessions/{id}", requireUser(handler.NewSessionRevokeHandler(db))).Methods("DELETE")
+
+	// Users & Ratings related, users may only access their own data unless they are admins. API tokens may only be
+	// used on the endpoints that allow one of their scopes.
+	readRatings := allowScope(model.ScopeReadRatings)
+	writeRatings := allowScope(model.ScopeWriteRatings)
+	recommend := allowScope(model.ScopeRecommend)
+	api.Handle("/users/{id}/recommend", recommend(requireSelf(
+		handler.NewPersonalizedRecommendationHandler(db, preferenceQueue, movieIndex, contentIndex)))).Methods("POST")
+	api.Handle("/users/register", registerLimit(handler.NewUserCreateHandler(db))).Methods("POST")
+	api.Handle("/users/{id}/onboarding",
+		writeRatings(requireSelf(handler.NewOnboardingQuestionHandler(db)))).Methods("GET")
+	api.Handle("/users/{id}/onboarding",
+		writeRatings(requireSelf(handler.NewOnboardingAnswerHandler(db, preferenceQueue)))).Methods("POST")
+	api.Handle("/users/{id}/ratings", readRatings(requireSelf(handler.NewRatingListHandler(db)))).Methods("GET")
+	api.Handle("/ratings",
+		writeRatings(requireUser(handler.NewRatingCreateHandler(db, preferenceQueue)))).Methods("POST")
+	api.Handle("/ratings/{id}",
+		writeRatings(requireUser(handler.NewRatingUpdateHandler(db, preferenceQueue, false)))).Methods("PUT")
+	api.Handle("/ratings/{id}",
+		writeRatings(requireUser(handler.NewRatingUpdateHandler(db, preferenceQueue, true)))).Methods("PATCH")
+	api.Handle("/ratings/{id}",
+		writeRatings(requireUser(handler.NewRatingDestroyHandler(db, preferenceQueue)))).Methods("DELETE")
+	api.Handle("/users/{id}/preference-job",
+		recommend(requireSelf(handler.NewPreferenceJobRetrieveHandler(preferenceQueue)))).Methods("GET")
+	api.Handle("/users", requireAdmin(handler.NewUserListHandler(db))).Methods("GET")
+
+	// API tokens are managed by signed in users only, a token cannot create more tokens
+	api.Handle("/tokens", requireUser(handler.NewAPITokenListHandler(db))).Methods("GET")
+	api.Handle("/tokens", requireUser(handler.NewAPITokenCreateHandler(db))).Methods("POST")
+	api.Handle("/tokens/{id}", requireUser(handler.NewAPITokenRevokeHandler(db))).Methods("DELETE")
+
+	// Notifications related
+	api.Handle("/ws", requireUser(handler.NewWebSocketHandler(connHub))).Methods("GET")
+
+	// Background jobs related
+	api.Handle("/jobs/preferences", requireAdmin(handler.NewPreferenceQueueStatsHandler(preferenceQueue))).Methods("GET")
+
+	// Groups related, members may see a group and its recommendations while only its owner may change it. Responses
+	// name the members of a group and nothing else about them.
+	api.Handle("/groups/{id}/recommend",
+		recommend(requireUser(handler.NewGroupRecommendationHandler(db, preferenceQueue)))).Methods("POST")
+	api.Handle("/groups/{id}/members", requireUser(handler.NewGroupMemberUpdateHandler(db))).Methods("PUT")
+	api.Handle("/groups/{id}", requireUser(handler.NewGroupRetrieveHandler(db))).Methods("GET")
+	api.Handle("/groups/{id}", requireUser(handler.NewGroupDestroyHandler(db))).Methods("DELETE")
+	api.Handle("/groups", requireUser(handler.NewGroupCreateHandler(db))).Methods("POST")
+	api.Handle("/groups", requireAdmin(handler.NewGroupListHandler(db))).Methods("GET")
 
-	// Users & Ratings related
-	api.Handle("/users/{id}/recommend", handler.NewPersonalizedRecommendationHandler(db)).Methods("POST")
-	api.Handle("/users/register", handler.NewUserCreateHandler(db)).Methods("POST")
-	api.Handle("/users/{id}/ratings", handler.NewRatingListHandler(db)).Methods("GET")
-	api.Handle("/ratings", handler.NewRatingCreateHandler(db, updateUserPreferenceQueue)).Methods("POST")
-	api.Handle("/users", handler.NewUserListHandler(db)).Methods("GET")
+	// Users join groups by accepting invitations, nobody becomes a member of a group without agreeing to it
+	api.Handle("/invitations", requireUser(handler.NewGroupInvitationListHandler(db))).Methods("GET")
+	api.Handle("/invitations/{id}/accept",
+		requireUser(handler.NewGroupInvitationAcceptHandler(db))).Methods("POST")
+	api.Handle("/invitations/{id}", requireUser(handler.NewGroupInvitationDeclineHandler(db))).Methods("DELETE")
 
 	// Movies related
 	api.Handle("/movies/popular", handler.NewPopularMovieListHandler(db)).Methods("GET")
-	api.Handle("/movies/recommend", handler.NewMovieRecommendationHandler(db)).Methods("POST")
-	api.Handle("/movies/details/{IMDBID}", handler.NewMovieDetailHandler(db)).Methods("GET")
-	api.Handle("/movies/trailers/{IMDBID}", handler.NewMovieTrailerHandler(db)).Methods("GET")
+	api.Handle("/movies/search", handler.NewMovieSearchHandler(db, searchIndex)).Methods("GET")
+	api.Handle("/movies/recommend", handler.NewMovieRecommendationHandler(db, preferenceQueue)).Methods("POST")
+	api.Handle("/movies/details/{IMDBID}",
+		tmdbLimit(handler.NewMovieDetailHandler(db, preferenceQueue))).Methods("GET")
+	api.Handle("/movies/trailers/{IMDBID}",
+		tmdbLimit(handler.NewMovieTrailerHandler(db, preferenceQueue))).Methods("GET")
 	api.Handle("/movies", handler.NewMovieListHandler(db)).Methods("GET")
+	api.Handle("/movies/{id}/similar", handler.NewSimilarMovieListHandler(db, similarityIndex)).Methods("GET")
 	api.Handle("/movies/{id}", handler.NewMovieRetrieveHandler(db)).Methods("GET")
 
 	// Serve public folder to clients
 	muxRouter.PathPrefix("/").Handler(http.FileServer(http.Dir("public")))
 
-	return logMiddleware(muxRouter)
+	return logMiddleware(authMiddleware(muxRouter))
 }
@@ -0,0 +1,320 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package search finds movies by title. It tolerates typos, completes the last word of a query and ranks the matches by
+// how well they match together with how popular the movies are.
+package search
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Scores of a query word matching a title word. A prefix scores higher the more of the title word it covers, and every
+// typo costs a quarter of the score. A query that is a whole title, or the beginning of one, earns a bonus on top.
+const (
+	ExactScore       = 1.0
+	MinPrefixScore   = 0.6
+	MaxPrefixScore   = 0.9
+	TypoPenalty      = 0.25
+	FullTitleBonus   = 0.3
+	TitlePrefixBonus = 0.15
+)
+
+// PopularityWeight is the share of the score that comes from the number of ratings of a movie, on a log scale relative
+// to the most rated movie. It orders movies that match equally well and lets a popular movie with a typo in the query
+// outrank an obscure one that matches exactly.
+const PopularityWeight = 0.3
+
+// Movie is what the index needs to know about a movie.
+type Movie struct {
+	ID        uint
+	Title     string
+	Year      uint
+	NumRating int
+}
+
+// Result is a matching movie with its score.
+type Result struct {
+	ID    uint
+	Score float64
+}
+
+type document struct {
+	id         uint
+	names      []string
+	popularity float64
+}
+
+// Index maps every word of the titles to the movies that have it, and every trigram of a word to the words that have it
+// for finding words within a few typos of a query word.
+type Index struct {
+	docs       []document
+	words      []string
+	postingMap map[string][]int
+	trigramMap map[string][]int
+}
+
+// NewIndex indexes the titles, alternative titles and release years of the movies.
+func NewIndex(movies []Movie) *Index {
+	idx := &Index{
+		docs:       make([]document, 0, len(movies)),
+		postingMap: make(map[string][]int),
+		trigramMap: make(map[string][]int),
+	}
+
+	maxNumRating := 0
+	for _, movie := range movies {
+		if movie.NumRating > maxNumRating {
+			maxNumRating = movie.NumRating
+		}
+	}
+
+	for _, movie := range movies {
+		doc := document{id: movie.ID}
+		if maxNumRating > 0 && movie.NumRating > 0 {
+			doc.popularity = math.Log1p(float64(movie.NumRating)) / math.Log1p(float64(maxNumRating))
+		}
+
+		seen := make(map[string]bool)
+		for _, name := range Names(movie.Title) {
+			name = Normalize(name)
+			doc.names = append(doc.names, name)
+			for _, word := range strings.Fields(name) {
+				seen[word] = true
+				if number, ok := romanNumerals[word]; ok {
+					seen[number] = true
+				}
+			}
+		}
+
+		if movie.Year > 0 {
+			seen[strconv.Itoa(int(movie.Year))] = true
+		}
+
+		for word := range seen {
+			idx.postingMap[word] = append(idx.postingMap[word], len(idx.docs))
+		}
+
+		idx.docs = append(idx.docs, doc)
+	}
+
+	for word := range idx.postingMap {
+		idx.words = append(idx.words, word)
+	}
+
+	sort.Strings(idx.words)
+	for i, word := range idx.words {
+		for _, trigram := range trigrams("$" + word + "$") {
+			idx.trigramMap[trigram] = append(idx.trigramMap[trigram], i)
+		}
+	}
+
+	return idx
+}
+
+// Len returns the number of indexed movies.
+func (idx *Index) Len() int {
+	return len(idx.docs)
+}
+
+// Search returns up to n movies whose titles match every word of the query, best first. The last word of the query
+// also matches the beginning of a longer word, so results can be shown while the user is typing. Articles in the query
+// are optional unless the query has nothing else.
+func (idx *Index) Search(query string, n int) []Result {
+	words := []string{}
+	for _, word := range Tokenize(query) {
+		if !isArticle(word) {
+			words = append(words, word)
+		}
+	}
+
+	if len(words) == 0 {
+		words = Tokenize(query)
+	}
+
+	if len(words) == 0 {
+		return []Result{}
+	}
+
+	// Each word keeps the best score it has in every movie, and only movies that every word matches survive.
+	var textScores map[int]float64
+	for i, word := range words {
+		wordScores := make(map[int]float64)
+		for matched, score := range idx.matchWord(word, i == len(words)-1) {
+			for _, docIndex := range idx.postingMap[matched] {
+				if score > wordScores[docIndex] {
+					wordScores[docIndex] = score
+				}
+			}
+		}
+
+		if textScores == nil {
+			textScores = wordScores
+			continue
+		}
+
+		for docIndex, score := range textScores {
+			if wordScore, ok := wordScores[docIndex]; ok {
+				textScores[docIndex] = score + wordScore
+			} else {
+				delete(textScores, docIndex)
+			}
+		}
+	}
+
+	phrase := strings.Join(words, " ")
+	results := make([]Result, 0, len(textScores))
+	for docIndex, score := range textScores {
+		doc := idx.docs[docIndex]
+		score = score/float64(len(words)) + titleBonus(doc.names, phrase) + PopularityWeight*doc.popularity
+		results = append(results, Result{ID: doc.id, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > n {
+		results = results[:n]
+	}
+
+	return results
+}
+
+// matchWord returns the score of every indexed word that matches a query word, exactly, within a few typos, or, when
+// prefix is set, as the beginning of the indexed word.
+func (idx *Index) matchWord(word string, prefix bool) map[string]float64 {
+	scores := make(map[string]float64)
+	if _, ok := idx.postingMap[word]; ok {
+		scores[word] = ExactScore
+	}
+
+	// Numbers are years and sequel numbers, a 2 should not complete to every year of the 21st century.
+	if prefix && !isNumber(word) {
+		for i := sort.SearchStrings(idx.words, word); i < len(idx.words); i += 1 {
+			if !strings.HasPrefix(idx.words[i], word) {
+				break
+			}
+
+			if idx.words[i] != word {
+				scores[idx.words[i]] = prefixScore(word, idx.words[i])
+			}
+		}
+	}
+
+	maxTypos := maxTypos(word)
+	if maxTypos == 0 {
+		return scores
+	}
+
+	// A word within a few typos shares at least one trigram with the query word, every typo breaks at most three.
+	padded := "$" + word
+	if !prefix {
+		padded += "$"
+	}
+
+	candidates := make(map[int]bool)
+	for _, trigram := range trigrams(padded) {
+		for _, i := range idx.trigramMap[trigram] {
+			candidates[i] = true
+		}
+	}
+
+	query := []rune(word)
+	for i := range candidates {
+		candidate := idx.words[i]
+		if _, ok := scores[candidate]; ok {
+			continue
+		}
+
+		target := []rune(candidate)
+		if typos := editDistance(query, target); typos <= maxTypos {
+			scores[candidate] = ExactScore * (1 - TypoPenalty*float64(typos))
+			continue
+		}
+
+		if !prefix || len(target) <= len(query) {
+			continue
+		}
+
+		// The query word may be the beginning of the title word with a typo in it, which may have made it a letter
+		// shorter or longer than what it stands for.
+		typos := maxTypos + 1
+		for length := len(query) - 1; length <= len(query)+1 && length <= len(target); length += 1 {
+			typos = min(typos, editDistance(query, target[:length]))
+		}
+
+		if typos <= maxTypos {
+			scores[candidate] = prefixScore(word, candidate) * (1 - TypoPenalty*float64(typos))
+		}
+	}
+
+	return scores
+}
+
+func prefixScore(prefix, word string) float64 {
+	coverage := float64(len([]rune(prefix))) / float64(len([]rune(word)))
+	return MinPrefixScore + (MaxPrefixScore-MinPrefixScore)*coverage
+}
+
+// maxTypos allows one typo in words of four letters and two in words of eight. Numbers must be exact.
+func maxTypos(word string) int {
+	if isNumber(word) {
+		return 0
+	}
+
+	length := len([]rune(word))
+	switch {
+	case length >= 8:
+		return 2
+	case length >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// titleBonus rewards a query that is an entire title or the beginning of one, with or without its leading article.
+func titleBonus(names []string, phrase string) float64 {
+	bonus := 0.0
+	for _, name := range names {
+		candidates := []string{name}
+		if words := strings.SplitN(name, " ", 2); len(words) == 2 && isArticle(words[0]) {
+			candidates = append(candidates, words[1])
+		}
+
+		for _, candidate := range candidates {
+			if candidate == phrase {
+				return FullTitleBonus
+			}
+
+			if strings.HasPrefix(candidate, phrase) {
+				bonus = TitlePrefixBonus
+			}
+		}
+	}
+
+	return bonus
+}
+
+func isNumber(word string) bool {
+	_, err := strconv.Atoi(word)
+	return err == nil
+}
+
+func trigrams(text string) []string {
+	runes := []rune(text)
+	grams := make([]string, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i += 1 {
+		grams = append(grams, string(runes[i:i+3]))
+	}
+
+	return grams
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package search
+
+import "testing"
+
+var testMovies = []Movie{
+	{ID: 1, Title: "Matrix, The", Year: 1999, NumRating: 80000},
+	{ID: 2, Title: "Matrix Reloaded, The", Year: 2003, NumRating: 30000},
+	{ID: 3, Title: "Matrix Revolutions, The", Year: 2003, NumRating: 25000},
+	{ID: 4, Title: "Mattress", Year: 2012, NumRating: 3},
+	{ID: 5, Title: "Godfather, The", Year: 1972, NumRating: 60000},
+	{ID: 6, Title: "Godfather: Part II, The", Year: 1974, NumRating: 40000},
+	{ID: 7, Title: "Godfather: Part III, The", Year: 1990, NumRating: 20000},
+	{ID: 8, Title: "Lord of the Rings: The Fellowship of the Ring, The", Year: 2001, NumRating: 70000},
+	{ID: 9, Title: "City of Lost Children, The (Cité des enfants perdus, La)", Year: 1995, NumRating: 5000},
+	{ID: 10, Title: "Shawshank Redemption, The", Year: 1994, NumRating: 90000},
+	{ID: 11, Title: "Inception", Year: 2010, NumRating: 50000},
+	{ID: 12, Title: "Twelve Monkeys (a.k.a. 12 Monkeys)", Year: 1995, NumRating: 45000},
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex(testMovies)
+	if idx.Len() != len(testMovies) {
+		t.Fatalf("Len() = %d, expected %d", idx.Len(), len(testMovies))
+	}
+
+	tests := []struct {
+		query    string
+		expected []uint
+	}{
+		{"the matrix", []uint{1, 2, 3}},
+		{"matrix", []uint{1, 2, 3}},
+		{"matrx", []uint{1, 2, 3}},
+		{"matrix rel", []uint{2}},
+		{"godfather 2", []uint{6}},
+		{"godfather part iii", []uint{7}},
+		{"lord of the rign", []uint{8}},
+		{"cite des enfants", []uint{9}},
+		{"city of lost children", []uint{9}},
+		{"shawshenk", []uint{10}},
+		{"incepton", []uint{11}},
+		{"12 monkeys", []uint{12}},
+		{"matrix 2003", []uint{2, 3}},
+		{"", []uint{}},
+		{"zzzzzz", []uint{}},
+	}
+
+	for _, test := range tests {
+		results := idx.Search(test.query, 10)
+		if len(test.expected) == 0 && len(results) > 0 {
+			t.Errorf("Search(%q) returned %v, expected nothing", test.query, results)
+			continue
+		}
+
+		if len(results) < len(test.expected) {
+			t.Errorf("Search(%q) returned %v, expected %v first", test.query, results, test.expected)
+			continue
+		}
+
+		for i, id := range test.expected {
+			if results[i].ID != id {
+				t.Errorf("Search(%q) returned %v, expected %v first", test.query, results, test.expected)
+				break
+			}
+		}
+
+		for i := 1; i < len(results); i += 1 {
+			if results[i].Score > results[i-1].Score {
+				t.Errorf("Search(%q) returned %v, which is not sorted by score", test.query, results)
+				break
+			}
+		}
+	}
+}
+
+func TestIndexSearchNumbersMatchExactly(t *testing.T) {
+	idx := NewIndex(testMovies)
+	for _, result := range idx.Search("godfather 2", 10) {
+		if result.ID == 5 || result.ID == 7 {
+			t.Errorf("Search(%q) returned movie %d, numbers must not match by prefix or typo", "godfather 2", result.ID)
+		}
+	}
+}
+
+func TestIndexSearchLimit(t *testing.T) {
+	idx := NewIndex(testMovies)
+	if results := idx.Search("matrix", 2); len(results) != 2 {
+		t.Errorf("Search with n = 2 returned %d results", len(results))
+	}
+}
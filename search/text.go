@@ -0,0 +1,156 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+// Package search finds movies by title. It tolerates typos, completes the last word of a query and ranks the matches by
+// how well they match together with how popular the movies are.
+package search
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// articles that MovieLens moves to the end of a title, e.g. "Matrix, The" or "Cité des enfants perdus, La".
+var articles = []string{"The", "A", "An", "La", "Le", "Les", "L'", "El", "Los", "Las", "Il", "Der", "Die", "Das"}
+
+var (
+	parenthesisRegex = regexp.MustCompile(`\s*\(([^()]*)\)`)
+	articleRegex     = regexp.MustCompile(`^(.+), (` + strings.Join(articles, "|") + `)$`)
+)
+
+// romanNumerals of sequels are also indexed as numbers, so "godfather 2" finds "Godfather: Part II".
+var romanNumerals = map[string]string{
+	"ii": "2", "iii": "3", "iv": "4", "v": "5", "vi": "6", "vii": "7", "viii": "8", "ix": "9", "x": "10",
+}
+
+// accentFold maps accented latin letters to their plain form, so "cite" finds "Cité".
+var accentFold = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a',
+	'ç': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ñ': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ý': 'y', 'ÿ': 'y',
+}
+
+// DisplayTitle puts articles that MovieLens moved to the end back in front, for the title and for every alternative
+// title in parentheses, e.g. "City of Lost Children, The (Cité des enfants perdus, La)" becomes "The City of Lost
+// Children (La Cité des enfants perdus)".
+func DisplayTitle(title string) string {
+	names := Names(title)
+	display := names[0]
+	for _, name := range names[1:] {
+		display += " (" + name + ")"
+	}
+
+	return display
+}
+
+// Names returns the title followed by its alternative titles in parentheses, each with its article put back in front.
+func Names(title string) []string {
+	main := parenthesisRegex.ReplaceAllString(title, "")
+	names := []string{moveArticle(strings.TrimSpace(main))}
+	for _, match := range parenthesisRegex.FindAllStringSubmatch(title, -1) {
+		names = append(names, moveArticle(strings.TrimSpace(match[1])))
+	}
+
+	return names
+}
+
+func moveArticle(title string) string {
+	match := articleRegex.FindStringSubmatch(title)
+	if match == nil {
+		return title
+	}
+
+	if strings.HasSuffix(match[2], "'") {
+		return match[2] + match[1]
+	}
+
+	return match[2] + " " + match[1]
+}
+
+// Normalize lower cases the text, folds accents and replaces everything but letters and digits with a single space.
+// Apostrophes are dropped, so "Schindler's" and "schindlers" are the same word.
+func Normalize(text string) string {
+	runes := make([]rune, 0, len(text))
+	space := true
+	for _, r := range strings.ToLower(text) {
+		if folded, ok := accentFold[r]; ok {
+			r = folded
+		}
+
+		switch {
+		case r == '\'' || r == '’':
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			runes = append(runes, r)
+			space = false
+		case !space:
+			runes = append(runes, ' ')
+			space = true
+		}
+	}
+
+	return strings.TrimSpace(string(runes))
+}
+
+// Tokenize splits normalized text into words.
+func Tokenize(text string) []string {
+	return strings.Fields(Normalize(text))
+}
+
+// isArticle reports whether a normalized word is one of the articles, which do not have to match for a title to match.
+func isArticle(word string) bool {
+	for _, article := range articles {
+		if Normalize(article) == word {
+			return true
+		}
+	}
+
+	return false
+}
+
+// editDistance returns the optimal string alignment distance between two words, where swapping two adjacent letters
+// is a single typo like inserting, deleting or replacing one.
+func editDistance(a, b []rune) int {
+	prevPrev := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := 0; j <= len(b); j += 1 {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i += 1 {
+		curr[0] = i
+		for j := 1; j <= len(b); j += 1 {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				curr[j] = min(curr[j], prevPrev[j-2]+1)
+			}
+		}
+
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, value := range values[1:] {
+		if value < m {
+			m = value
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018 Popcorn
+// Author(s) Calvin Feng
+
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"matrix", "matrix", 0},
+		{"matrx", "matrix", 1},
+		{"matrixx", "matrix", 1},
+		{"matrox", "matrix", 1},
+		{"mtarix", "matrix", 1},
+		{"incepton", "inception", 1},
+		{"shawshenk", "shawshank", 1},
+		{"rign", "ring", 1},
+		{"ca", "abc", 3},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, test := range tests {
+		if actual := editDistance([]rune(test.a), []rune(test.b)); actual != test.expected {
+			t.Errorf("editDistance(%q, %q) = %d, expected %d", test.a, test.b, actual, test.expected)
+		}
+	}
+}
+
+func TestMoveArticle(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected string
+	}{
+		{"Matrix, The", "The Matrix"},
+		{"Few Good Men, A", "A Few Good Men"},
+		{"Cité des enfants perdus, La", "La Cité des enfants perdus"},
+		{"Homme et une femme, Un", "Homme et une femme, Un"},
+		{"Armée des ombres, L'", "L'Armée des ombres"},
+		{"Toy Story", "Toy Story"},
+		{"Good, the Bad and the Ugly, The", "The Good, the Bad and the Ugly"},
+		{"The End", "The End"},
+	}
+
+	for _, test := range tests {
+		if actual := moveArticle(test.title); actual != test.expected {
+			t.Errorf("moveArticle(%q) = %q, expected %q", test.title, actual, test.expected)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected []string
+	}{
+		{"Toy Story", []string{"Toy Story"}},
+		{"Matrix, The", []string{"The Matrix"}},
+		{
+			"City of Lost Children, The (Cité des enfants perdus, La)",
+			[]string{"The City of Lost Children", "La Cité des enfants perdus"},
+		},
+		{
+			"Shanghai Triad (Yao a yao yao dao waipo qiao) (Shanghai Triad, The)",
+			[]string{"Shanghai Triad", "Yao a yao yao dao waipo qiao", "The Shanghai Triad"},
+		},
+	}
+
+	for _, test := range tests {
+		if actual := Names(test.title); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Names(%q) = %q, expected %q", test.title, actual, test.expected)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"Schindler's List", "schindlers list"},
+		{"Cité des enfants", "cite des enfants"},
+		{"  Star Wars: Episode IV - A New Hope  ", "star wars episode iv a new hope"},
+		{"WALL·E", "wall e"},
+		{"...", ""},
+	}
+
+	for _, test := range tests {
+		if actual := Normalize(test.text); actual != test.expected {
+			t.Errorf("Normalize(%q) = %q, expected %q", test.text, actual, test.expected)
+		}
+	}
+}